@@ -0,0 +1,118 @@
+// Command indexer builds the product catalog and its indexes offline and
+// writes them to PRODUCT_INDEX_FILE, which the server loads at startup
+// instead of building the catalog itself.
+//
+//	indexer -in products.ndjson   # a GET /admin/products/export/ndjson export ("-" for stdin)
+//	indexer -seed 100000          # the seed catalog the server generates by default
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"text/main/product"
+)
+
+// progressEvery is how many products are read between progress reports.
+const progressEvery = 10000
+
+func main() {
+	in := flag.String("in", "", "NDJSON product export to index (\"-\" for stdin)")
+	seed := flag.Int("seed", 0, "index this many seed products instead of an export")
+	flag.Parse()
+
+	path := os.Getenv("PRODUCT_INDEX_FILE")
+	if path == "" {
+		log.Fatal("PRODUCT_INDEX_FILE must be set")
+	}
+	if (*in == "") == (*seed <= 0) {
+		log.Fatal("exactly one of -in or -seed is required")
+	}
+
+	store := product.NewStore()
+	if *seed > 0 {
+		store.SeedBulk(*seed)
+		log.Printf("Seeded %d products\n", *seed)
+	} else {
+		products, err := readExport(*in)
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", *in, err)
+		}
+		store.Load(products)
+		log.Printf("Indexed %d products\n", len(products))
+	}
+
+	if err := writeAtomic(path, store); err != nil {
+		log.Fatalf("Failed to write %s: %v", path, err)
+	}
+	log.Printf("Wrote product index to %s\n", path)
+}
+
+// readExport reads the products in an NDJSON export.
+func readExport(name string) ([]product.Product, error) {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var products []product.Product
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var p product.Product
+		if err := dec.Decode(&p); err == io.EOF {
+			return products, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("product %d: %w", len(products)+1, err)
+		}
+		if p.ID <= 0 {
+			return nil, fmt.Errorf("product %d: missing id", len(products)+1)
+		}
+		products = append(products, p)
+		if len(products)%progressEvery == 0 {
+			log.Printf("Read %d products\n", len(products))
+		}
+	}
+}
+
+// writeAtomic writes the store's snapshot to a temporary file next to path
+// and renames it into place, so the server never loads a partial index.
+func writeAtomic(path string, store *product.Store) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	w := bufio.NewWriter(tmp)
+	if err := store.WriteSnapshot(w); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,152 @@
+package csvenc
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Encode writes a slice of structs (or struct pointers) as CSV: a header row
+// followed by one row per element. Column names come from the `csv` tag, then
+// the `json` tag, then the field name; a tag of "-" skips the field. Scalars
+// are formatted directly, time.Time as RFC3339, and any other value (slices,
+// maps, nested structs) as compact JSON.
+func Encode(w io.Writer, slice interface{}) error {
+	v := reflect.ValueOf(slice)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return fmt.Errorf("csvenc: expected a slice, got %s", v.Kind())
+	}
+	elem := v.Type().Elem()
+	if elem.Kind() == reflect.Pointer {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return fmt.Errorf("csvenc: expected a slice of structs, got %s", elem)
+	}
+
+	cols := columns(elem)
+	cw := csv.NewWriter(w)
+	header := make([]string, len(cols))
+	for i, col := range cols {
+		header[i] = col.name
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	record := make([]string, len(cols))
+	for i := 0; i < v.Len(); i++ {
+		row := v.Index(i)
+		if row.Kind() == reflect.Pointer {
+			if row.IsNil() {
+				continue
+			}
+			row = row.Elem()
+		}
+		for j, col := range cols {
+			field, err := row.FieldByIndexErr(col.index)
+			if err != nil {
+				// Nil embedded pointer: leave the column empty
+				record[j] = ""
+				continue
+			}
+			s, err := format(field)
+			if err != nil {
+				return err
+			}
+			record[j] = s
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+type column struct {
+	name  string
+	index []int
+}
+
+func columns(t reflect.Type) []column {
+	var cols []column
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() {
+			continue
+		}
+		// Promote the fields of embedded structs instead of encoding the struct itself
+		if f.Anonymous && derefType(f.Type).Kind() == reflect.Struct && f.Tag.Get("csv") == "" && f.Tag.Get("json") == "" {
+			continue
+		}
+		name := tagName(f)
+		if name == "-" {
+			continue
+		}
+		cols = append(cols, column{name: name, index: f.Index})
+	}
+	return cols
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Pointer {
+		return t.Elem()
+	}
+	return t
+}
+
+func tagName(f reflect.StructField) string {
+	for _, key := range []string{"csv", "json"} {
+		if tag, ok := f.Tag.Lookup(key); ok {
+			name, _, _ := strings.Cut(tag, ",")
+			if name != "" {
+				return name
+			}
+		}
+	}
+	return f.Name
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func format(v reflect.Value) (string, error) {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			return "", nil
+		}
+		return t.Format(time.RFC3339), nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
+	case reflect.Slice, reflect.Map:
+		if v.IsNil() {
+			return "", nil
+		}
+	}
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
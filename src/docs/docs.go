@@ -0,0 +1,47 @@
+package docs
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// The spec is maintained by hand; keep it in sync with the request/response types.
+//
+//go:embed openapi.yaml
+var specYAML []byte
+
+//go:embed swagger-ui
+var swaggerUI embed.FS
+
+// SpecJSON converts the embedded OpenAPI document to JSON.
+func SpecJSON() ([]byte, error) {
+	var spec map[string]interface{}
+	if err := yaml.Unmarshal(specYAML, &spec); err != nil {
+		return nil, err
+	}
+	return json.Marshal(spec)
+}
+
+// Register mounts GET /openapi.json and the Swagger UI under /swagger-ui/.
+// Only call this when ENABLE_SWAGGER=true; the docs must not be exposed in production.
+func Register(r gin.IRoutes) error {
+	spec, err := SpecJSON()
+	if err != nil {
+		return err
+	}
+	ui, err := fs.Sub(swaggerUI, "swagger-ui")
+	if err != nil {
+		return err
+	}
+
+	r.GET("/openapi.json", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", spec)
+	})
+	r.StaticFS("/swagger-ui", http.FS(ui))
+	return nil
+}
@@ -0,0 +1,215 @@
+package docs
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"text/main/orders"
+	"text/main/product"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+)
+
+func TestSpecJSON(t *testing.T) {
+	raw, err := SpecJSON()
+	if err != nil {
+		t.Fatalf("SpecJSON: %v", err)
+	}
+	var spec struct {
+		OpenAPI string                     `json:"openapi"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		t.Fatalf("spec is not valid JSON: %v", err)
+	}
+	if spec.OpenAPI == "" {
+		t.Error("spec has no openapi version")
+	}
+	for _, path := range []string{"/health", "/products", "/orders/sync"} {
+		if _, ok := spec.Paths[path]; !ok {
+			t.Errorf("spec does not document %s", path)
+		}
+	}
+}
+
+func TestSpecIsValidOpenAPI(t *testing.T) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(specYAML)
+	if err != nil {
+		t.Fatalf("loading spec: %v", err)
+	}
+	if err := doc.Validate(loader.Context); err != nil {
+		t.Fatalf("spec is not valid OpenAPI: %v", err)
+	}
+}
+
+// TestOpenAPISchemaMatchesTypes checks that the spec's schemas have exactly
+// the JSON fields of the Go types they describe.
+func TestOpenAPISchemaMatchesTypes(t *testing.T) {
+	doc, err := openapi3.NewLoader().LoadFromData(specYAML)
+	if err != nil {
+		t.Fatalf("loading spec: %v", err)
+	}
+	tests := []struct {
+		schema string
+		value  any
+	}{
+		{"Product", product.Product{}},
+		{"PricingTier", product.PricingTier{}},
+		{"Bundle", product.Bundle{}},
+		{"BundleResponse", product.BundleResponse{}},
+		{"SearchResponse", product.SearchResponse{}},
+		{"Order", orders.Order{}},
+		{"Item", orders.Item{}},
+		{"OrderListResponse", orders.OrderListResponse{}},
+		{"OrderEvent", orders.OrderEvent{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schema, func(t *testing.T) {
+			ref, ok := doc.Components.Schemas[tt.schema]
+			if !ok {
+				t.Fatalf("spec has no %s schema", tt.schema)
+			}
+			var documented []string
+			for name := range schemaProperties(ref.Value) {
+				documented = append(documented, name)
+			}
+			slices.Sort(documented)
+			fields := jsonFields(reflect.TypeOf(tt.value))
+			slices.Sort(fields)
+			if !slices.Equal(documented, fields) {
+				t.Errorf("schema properties %v, want the JSON fields %v", documented, fields)
+			}
+		})
+	}
+}
+
+// TestSpecDocumentsEveryRoute checks that every route the product and order
+// packages register, including the /v1 and /v2 product routes, is in the spec.
+func TestSpecDocumentsEveryRoute(t *testing.T) {
+	doc, err := openapi3.NewLoader().LoadFromData(specYAML)
+	if err != nil {
+		t.Fatalf("loading spec: %v", err)
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	store := product.NewStore()
+	productHandlers := product.NewHandlers(store)
+	for _, prefix := range []string{"", "/v1", "/v2"} {
+		product.Register(r.Group(prefix), productHandlers)
+	}
+	product.RegisterAdmin(r, productHandlers)
+	product.RegisterEvents(r, productHandlers)
+	graphqlHandlers, err := product.NewGraphQLHandlers(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	product.RegisterGraphQL(r, graphqlHandlers)
+	asyncHandlers := orders.NewAsyncHandlersDisabled()
+	orders.Register(r, &asyncHandlers.Handlers)
+	orders.RegisterAsync(r, asyncHandlers)
+	orders.RegisterAdmin(r, &asyncHandlers.Handlers)
+
+	params := regexp.MustCompile(`:(\w+)`)
+	for _, route := range r.Routes() {
+		path := params.ReplaceAllString(route.Path, "{$1}")
+		item := doc.Paths.Find(path)
+		if item == nil || item.GetOperation(route.Method) == nil {
+			t.Errorf("spec does not document %s %s", route.Method, path)
+		}
+	}
+}
+
+// TestSpecSchemasAreUsed checks that every schema in components is
+// referenced from somewhere in the spec.
+func TestSpecSchemasAreUsed(t *testing.T) {
+	doc, err := openapi3.NewLoader().LoadFromData(specYAML)
+	if err != nil {
+		t.Fatalf("loading spec: %v", err)
+	}
+	for name := range doc.Components.Schemas {
+		if !bytes.Contains(specYAML, []byte(`"#/components/schemas/`+name+`"`)) {
+			t.Errorf("schema %s is not referenced", name)
+		}
+	}
+}
+
+// schemaProperties returns the properties of s, including those of the
+// schemas it combines with allOf.
+func schemaProperties(s *openapi3.Schema) openapi3.Schemas {
+	props := openapi3.Schemas{}
+	for _, part := range s.AllOf {
+		for name, p := range schemaProperties(part.Value) {
+			props[name] = p
+		}
+	}
+	for name, p := range s.Properties {
+		props[name] = p
+	}
+	return props
+}
+
+// jsonFields returns the names encoding/json uses for the fields of t,
+// including those promoted from embedded structs.
+func jsonFields(t reflect.Type) []string {
+	var names []string
+	for _, f := range reflect.VisibleFields(t) {
+		tag := f.Tag.Get("json")
+		if !f.IsExported() || tag == "-" || (f.Anonymous && tag == "") {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestRegister(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	if err := Register(r); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	tests := []struct {
+		path        string
+		contentType string
+	}{
+		{"/openapi.json", "application/json"},
+		{"/swagger-ui/", "text/html; charset=utf-8"},
+		{"/swagger-ui/swagger-ui.css", "text/css; charset=utf-8"},
+		{"/swagger-ui/swagger-ui-bundle.js", "text/javascript; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", w.Code)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+		})
+	}
+}
+
+func TestSwaggerUILoadsNothingExternal(t *testing.T) {
+	page, err := swaggerUI.ReadFile("swagger-ui/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i := strings.Index(string(page), "://"); i >= 0 {
+		t.Errorf("index.html loads %s", string(page[max(0, i-10):min(len(page), i+40)]))
+	}
+}
@@ -0,0 +1,104 @@
+package featureflags
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Flag is a percentage rollout: Percent of customers see the flag enabled.
+type Flag struct {
+	Name    string `json:"name"`
+	Percent int    `json:"percent"`
+}
+
+// FlagState is a flag together with its evaluation counters
+// (feature_flag_evaluation_total{flag, value}).
+type FlagState struct {
+	Flag
+	EnabledCount  int64 `json:"enabled_count"`
+	DisabledCount int64 `json:"disabled_count"`
+}
+
+// FlagStore holds rollout percentages and counts evaluations per flag and value.
+type FlagStore struct {
+	mu     sync.Mutex
+	flags  map[string]int
+	counts map[string]map[bool]int64
+}
+
+func NewFlagStore(flags []Flag) *FlagStore {
+	s := &FlagStore{flags: make(map[string]int), counts: make(map[string]map[bool]int64)}
+	for _, f := range flags {
+		s.flags[f.Name] = f.Percent
+	}
+	return s
+}
+
+// Parse reads a FEATURE_FLAGS value such as "cart_backend_dynamodb:10,new_search".
+// A flag without a percentage is fully enabled.
+func Parse(raw string) ([]Flag, error) {
+	var flags []Flag
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, pct, hasPct := strings.Cut(entry, ":")
+		percent := 100
+		if hasPct {
+			v, err := strconv.Atoi(strings.TrimSpace(pct))
+			if err != nil || v < 0 || v > 100 {
+				return nil, fmt.Errorf("invalid percentage for flag %q: %q", name, pct)
+			}
+			percent = v
+		}
+		flags = append(flags, Flag{Name: strings.TrimSpace(name), Percent: percent})
+	}
+	return flags, nil
+}
+
+// BoolWithWeight reports whether the flag is enabled for the customer. The
+// bucket is an FNV hash of customerID + flag name, so a customer always lands
+// on the same side of the split. Unknown flags are disabled.
+func (s *FlagStore) BoolWithWeight(name string, customerID int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enabled := false
+	if percent, ok := s.flags[name]; ok {
+		enabled = bucket(name, customerID) < uint32(percent)
+	}
+	if s.counts[name] == nil {
+		s.counts[name] = make(map[bool]int64)
+	}
+	s.counts[name][enabled]++
+	return enabled
+}
+
+// States returns every configured flag with its evaluation counters, sorted by name.
+func (s *FlagStore) States() []FlagState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := make([]FlagState, 0, len(s.flags))
+	for name, percent := range s.flags {
+		states = append(states, FlagState{
+			Flag:          Flag{Name: name, Percent: percent},
+			EnabledCount:  s.counts[name][true],
+			DisabledCount: s.counts[name][false],
+		})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+	return states
+}
+
+// bucket maps a customer/flag pair onto [0, 100).
+func bucket(name string, customerID int) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(strconv.Itoa(customerID) + name))
+	return h.Sum32() % 100
+}
@@ -0,0 +1,98 @@
+package featureflags
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    []Flag
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"cart_backend_dynamodb:10, new_search", []Flag{{"cart_backend_dynamodb", 10}, {"new_search", 100}}, false},
+		{"off:0", []Flag{{"off", 0}}, false},
+		{"bad:101", nil, true},
+		{"bad:-1", nil, true},
+		{"bad:ten", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) err = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("Parse(%q) = %v, want %v", tt.raw, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Parse(%q) = %v, want %v", tt.raw, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestBoolWithWeightIsDeterministic(t *testing.T) {
+	s := NewFlagStore([]Flag{{"rollout", 50}})
+	for id := 1; id <= 1000; id++ {
+		first := s.BoolWithWeight("rollout", id)
+		for i := 0; i < 3; i++ {
+			if got := s.BoolWithWeight("rollout", id); got != first {
+				t.Fatalf("customer %d got %v then %v", id, first, got)
+			}
+		}
+		// A fresh store buckets the customer the same way
+		if got := NewFlagStore([]Flag{{"rollout", 50}}).BoolWithWeight("rollout", id); got != first {
+			t.Fatalf("customer %d got %v from a new store, want %v", id, got, first)
+		}
+	}
+}
+
+func TestBoolWithWeightDistribution(t *testing.T) {
+	const customers = 100_000
+	tests := []struct {
+		name    string
+		percent int
+	}{
+		{"off", 0},
+		{"ten percent", 10},
+		{"half", 50},
+		{"on", 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewFlagStore([]Flag{{"rollout", tt.percent}})
+			enabled := 0
+			for id := 1; id <= customers; id++ {
+				if s.BoolWithWeight("rollout", id) {
+					enabled++
+				}
+			}
+			got := float64(enabled) / customers * 100
+			if math.Abs(got-float64(tt.percent)) > 1 {
+				t.Errorf("%.2f%% of customers enabled, want %d%% ± 1", got, tt.percent)
+			}
+		})
+	}
+}
+
+func TestStates(t *testing.T) {
+	s := NewFlagStore([]Flag{{"b", 100}, {"a", 0}})
+	s.BoolWithWeight("b", 1)
+	s.BoolWithWeight("b", 2)
+	s.BoolWithWeight("a", 1)
+	if s.BoolWithWeight("unknown", 1) {
+		t.Error("unknown flag is enabled")
+	}
+	states := s.States()
+	if len(states) != 2 || states[0].Name != "a" || states[1].Name != "b" {
+		t.Fatalf("States() = %+v, want a then b", states)
+	}
+	if states[0].DisabledCount != 1 || states[1].EnabledCount != 2 {
+		t.Errorf("counters = %+v", states)
+	}
+}
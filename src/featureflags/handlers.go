@@ -0,0 +1,15 @@
+package featureflags
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Register mounts the feature flag admin routes. Mount them behind
+// middleware.RequireAdminKey.
+func Register(r gin.IRoutes, s *FlagStore) {
+	r.GET("/admin/feature-flags", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"flags": s.States()})
+	})
+}
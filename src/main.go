@@ -1,31 +1,234 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"strconv"
+	"text/main/docs"
+	"text/main/featureflags"
+	"text/main/middleware"
 	"text/main/orders"
+	"text/main/pkg/currency"
+	"text/main/pkg/pii"
 	product "text/main/product"
+	"text/main/validate"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/firehose"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 func main() {
-	router := gin.Default()
+	// gin.Default's logger and recovery, with sensitive query values masked in the log line
+	router := gin.New()
+	// X-Forwarded-For is only believed from TRUSTED_PROXIES (e.g. the ALB
+	// subnets); without it the client IP is the connection's peer address
+	trustedProxies, err := middleware.ParseCIDRList(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	if err := router.SetTrustedProxies(middleware.CIDRStrings(trustedProxies)); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	router.Use(gin.LoggerWithFormatter(middleware.MaskedLogFormatter), gin.Recovery())
+	router.Use(middleware.MaskQueryParams(middleware.ParseMaskedParams(os.Getenv("MASK_QUERY_PARAMS"))))
+	router.Use(middleware.RequestID(), middleware.ContentNegotiation(), validate.Middleware())
+	// Customer tier and ID headers are only believed from TRUSTED_PROXIES
+	router.Use(middleware.GatewayIdentity(trustedProxies))
+	if len(trustedProxies) == 0 {
+		log.Println("WARNING: TRUSTED_PROXIES not set, X-Customer-ID is ignored: only ADMIN_API_KEY callers can list or cancel customers' orders")
+	}
+	// Expensive admin operations are limited per route across all admin
+	// callers; the limiter sits behind the admin key check so requests
+	// without the key cannot use up the quota
+	adminLimits := os.Getenv("ADMIN_RATE_LIMITS")
+	if adminLimits == "" {
+		adminLimits = middleware.DefaultAdminRateLimits
+	}
+	routeLimits, err := middleware.ParseRouteLimits(adminLimits)
+	if err != nil {
+		log.Fatalf("Invalid ADMIN_RATE_LIMITS: %v", err)
+	}
+	adminRateLimiter := middleware.GlobalRateLimiter(routeLimits)
+	// Body logging is opt-in; SCRUB_FIELDS (default customer_id,email,address) are redacted
+	if os.Getenv("LOG_BODIES") == "true" {
+		router.Use(middleware.AccessLog(pii.NewScrubber(pii.ParseFields(os.Getenv("SCRUB_FIELDS")))))
+	}
+
+	// W3C trace context and baggage (e.g. customer.id) are carried from
+	// POST /orders/async to the SQS order processor in the tracecontext
+	// message attribute
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	// ADMIN_API_KEY (sent as X-API-Key) guards admin routes; they are closed without it
+	adminAPIKey := os.Getenv("ADMIN_API_KEY")
+
+	// Exchange rates for non-USD pricing
+	rates, err := currency.ParseRates(os.Getenv("EXCHANGE_RATES_JSON"))
+	if err != nil {
+		log.Fatalf("Invalid EXCHANGE_RATES_JSON: %v", err)
+	}
+	converter := currency.NewConverter(rates)
+	if url := os.Getenv("EXCHANGE_RATE_URL"); url != "" {
+		converter.RefreshEvery(url, time.Hour)
+	}
+	currency.SetDefault(converter)
 
 	// Initialize product handlers
 	store := product.NewStore()
-	store.SeedBulk(100000)
+	// A catalog prebuilt by cmd/indexer skips building the indexes at startup
+	if path := os.Getenv("PRODUCT_INDEX_FILE"); path != "" {
+		if err := store.LoadSnapshotFile(path); err != nil {
+			log.Fatalf("Failed to load product index %s: %v", path, err)
+		}
+		log.Printf("Loaded product index from %s\n", path)
+	} else {
+		store.SeedBulk(100000)
+	}
+	if path := os.Getenv("ANALYTICS_FILE"); path != "" {
+		store.Analytics().PersistEvery(path, 5*time.Minute)
+	}
+	store.ExpireReservationsEvery(time.Minute)
+	// Low stock alerts go to SNS; undelivered alerts are spooled to disk and retried
+	if topic := os.Getenv("LOW_STOCK_SNS_TOPIC"); topic != "" {
+		sess, err := session.NewSession(&aws.Config{Region: aws.String(os.Getenv("AWS_REGION"))})
+		if err != nil {
+			log.Fatalf("Failed to create AWS session for low stock alerts: %v", err)
+		}
+		spool := os.Getenv("LOW_STOCK_SPOOL_FILE")
+		if spool == "" {
+			spool = "low-stock-alerts.ndjson"
+		}
+		product.NewLowStockPublisher(sns.New(sess), topic, spool).Run(store.StockAlerts(), time.Minute)
+	}
 	productHandlers := product.NewHandlers(store)
-	product.Register(router, productHandlers)
+	productHandlers.SetAdminAPIKey(adminAPIKey)
+	// Relevance-ranked search; products become searchable as indexing progresses
+	if esURL := os.Getenv("ELASTICSEARCH_URL"); esURL != "" {
+		index := os.Getenv("ELASTICSEARCH_INDEX")
+		if index == "" {
+			index = "products"
+		}
+		search := product.NewElasticsearchStore(store, esURL, index)
+		go func() {
+			n, err := search.IndexAll(context.Background())
+			if err != nil {
+				log.Printf("WARNING: Elasticsearch indexing stopped after %d products: %v\n", n, err)
+				return
+			}
+			log.Printf("Indexed %d products in Elasticsearch index %s\n", n, index)
+		}()
+		productHandlers.SetSearch(search)
+	}
+	// Unversioned routes are deprecated and served as v1 unless negotiated otherwise
+	product.Register(router.Group("", middleware.APIVersion(), middleware.VersionMiddleware()), productHandlers)
+	product.Register(router.Group("/v1", middleware.PinVersion(1)), productHandlers)
+	product.Register(router.Group("/v2", middleware.PinVersion(2)), productHandlers)
+	product.RegisterAdmin(router.Group("", middleware.RequireAdminKey(adminAPIKey), adminRateLimiter), productHandlers)
+	product.RegisterEvents(router, productHandlers)
+	graphqlHandlers, err := product.NewGraphQLHandlers(store)
+	if err != nil {
+		log.Fatalf("Invalid GraphQL schema: %v", err)
+	}
+	product.RegisterGraphQL(router, graphqlHandlers)
 
-	// Initialize order handlers
-	orderHandlers := orders.NewHandlers()
-	orders.Register(router, orderHandlers)
+	// Initialize order handlers (IP filtering and per-tier rate limits apply to orders only; products stay open)
+	allowlist, err := middleware.ParseCIDRList(os.Getenv("IP_ALLOWLIST"))
+	if err != nil {
+		log.Fatalf("Invalid IP_ALLOWLIST: %v", err)
+	}
+	blocklist, err := middleware.ParseCIDRList(os.Getenv("IP_BLOCKLIST"))
+	if err != nil {
+		log.Fatalf("Invalid IP_BLOCKLIST: %v", err)
+	}
+	// Async orders publish to SNS_TOPIC_ARN with one SNS client for all
+	// requests; without a topic they are rejected with 503
+	asyncHandlers := orders.NewAsyncHandlersDisabled()
+	if topicARN := os.Getenv("SNS_TOPIC_ARN"); topicARN != "" {
+		asyncHandlers, err = orders.NewAsyncHandlers(topicARN)
+		if err != nil {
+			log.Fatalf("Invalid SNS_TOPIC_ARN: %v", err)
+		}
+	} else {
+		log.Println("WARNING: SNS_TOPIC_ARN not set, POST /orders/async will return 503")
+	}
+	orderHandlers := &asyncHandlers.Handlers
+	// The admin key also allows listing every customer's orders
+	orderHandlers.SetAdminAPIKey(adminAPIKey)
+	orderHandlers.Idempotency().ExpireEvery(time.Hour)
+	orderHandlers.Orders().ExpireEvery(time.Hour)
+	// Accepted orders take stock from the catalog
+	orderHandlers.SetInventory(store)
+	// Route async orders to fulfillment-center topics (e.g. by product category)
+	routingRules, err := orders.ParseRoutingRules(os.Getenv("ROUTING_RULES_JSON"))
+	if err != nil {
+		log.Fatalf("Invalid ROUTING_RULES_JSON: %v", err)
+	}
+	if len(routingRules) > 0 {
+		orderRouter, err := orders.NewRouter(routingRules, os.Getenv("SNS_TOPIC_ARN"))
+		if err != nil {
+			log.Fatalf("Invalid ROUTING_RULES_JSON: %v", err)
+		}
+		orderHandlers.SetRouting(orderRouter, func(productID string) (string, bool) {
+			id, err := strconv.ParseInt(productID, 10, 32)
+			if err != nil {
+				return "", false
+			}
+			p, ok := store.Get(int32(id))
+			return p.Category, ok
+		})
+	}
+	// Watch the dead letter queue (depth is logged and sent to CloudWatch)
+	if dlqURL := os.Getenv("DLQ_URL"); dlqURL != "" {
+		sess, err := session.NewSession(&aws.Config{Region: aws.String(os.Getenv("AWS_REGION"))})
+		if err != nil {
+			log.Fatalf("Failed to create AWS session for DLQ monitor: %v", err)
+		}
+		monitor := orders.NewDLQMonitor(sqs.New(sess), cloudwatch.New(sess), dlqURL)
+		monitor.MonitorEvery(time.Minute)
+		orderHandlers.SetDLQMonitor(monitor)
+	}
+	orderMiddleware := []gin.HandlerFunc{middleware.IPFilter(allowlist, blocklist)}
+	// Per-tier rate limits are opt-in: load tests run many users from one IP
+	if os.Getenv("TIER_RATE_LIMITS") == "true" {
+		orderMiddleware = append(orderMiddleware, middleware.TieredRateLimiter(middleware.DefaultTierLimits, middleware.TierFromContext))
+	}
+	orderRoutes := router.Group("", orderMiddleware...)
+	orders.Register(orderRoutes, orderHandlers)
+	orders.RegisterAsync(orderRoutes, asyncHandlers)
+	orders.RegisterAdmin(router.Group("", middleware.IPFilter(allowlist, blocklist), middleware.RequireAdminKey(adminAPIKey), adminRateLimiter), orderHandlers)
+
+	// Feature flags (e.g. FEATURE_FLAGS=cart_backend_dynamodb:10)
+	flags, err := featureflags.Parse(os.Getenv("FEATURE_FLAGS"))
+	if err != nil {
+		log.Fatalf("Invalid FEATURE_FLAGS: %v", err)
+	}
+	featureflags.Register(router.Group("", middleware.RequireAdminKey(adminAPIKey), adminRateLimiter), featureflags.NewFlagStore(flags))
 
 	// Start order processor (polls SQS and processes orders asynchronously)
 	processor, err := orders.NewOrderProcessor()
 	if err != nil {
 		log.Printf("WARNING: Failed to initialize order processor: %v\n", err)
 	} else if processor != nil {
+		processor.SetWebhooks(orderHandlers.Webhooks())
+		processor.SetStore(orderHandlers.Orders())
+		if stream := os.Getenv("FIREHOSE_DELIVERY_STREAM"); stream != "" {
+			sess, err := session.NewSession(&aws.Config{Region: aws.String(os.Getenv("AWS_REGION"))})
+			if err != nil {
+				log.Fatalf("Failed to create AWS session for Firehose: %v", err)
+			}
+			archive := orders.NewFirehoseProducer(firehose.New(sess), stream)
+			archive.FlushEvery(10 * time.Second)
+			processor.SetArchive(archive)
+		}
 		processor.Start()
 		log.Println("Order processor started successfully")
 	}
@@ -35,6 +238,15 @@ func main() {
 		c.String(200, "ok")
 	})
 
+	// API docs are opt-in and must stay disabled in production
+	if os.Getenv("ENABLE_SWAGGER") == "true" {
+		if err := docs.Register(router); err != nil {
+			log.Printf("WARNING: Failed to load OpenAPI spec: %v\n", err)
+		} else {
+			log.Println("Swagger UI enabled at /swagger-ui/")
+		}
+	}
+
 	log.Println("Starting server on :8080")
 	router.Run(":8080")
 }
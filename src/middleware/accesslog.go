@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"strings"
+	"text/main/pkg/pii"
+	"text/main/response"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxLoggedBody caps how much of each body is captured for the access log.
+const maxLoggedBody = 64 << 10
+
+// AccessLog logs each request with its JSON request and response bodies after
+// passing them through scrubber. Non-JSON bodies (CSV uploads, msgpack) are
+// not logged, nor are bodies larger than 64 KB.
+func AccessLog(scrubber *pii.Scrubber) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		var reqBody []byte
+		if isJSON(c.ContentType()) && c.Request.Body != nil {
+			reqBody, _ = io.ReadAll(io.LimitReader(c.Request.Body, maxLoggedBody+1))
+			c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(reqBody), c.Request.Body))
+		}
+		w := &bodyLogWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+
+		c.Next()
+
+		path := c.GetString(MaskedURLKey)
+		if path == "" {
+			path = c.Request.URL.Path
+		}
+		log.Printf("%s %s %d %v request_id=%s request=%s response=%s\n",
+			c.Request.Method, path, w.Status(), time.Since(start),
+			c.GetString(response.RequestIDKey),
+			loggableBody(scrubber, reqBody),
+			loggableBody(scrubber, w.jsonBody()))
+	}
+}
+
+func loggableBody(scrubber *pii.Scrubber, body []byte) string {
+	if len(body) == 0 {
+		return "-"
+	}
+	if len(body) > maxLoggedBody {
+		return "[TRUNCATED]"
+	}
+	return string(scrubber.ScrubJSON(body))
+}
+
+func isJSON(contentType string) bool {
+	return strings.HasSuffix(contentType, "json")
+}
+
+// bodyLogWriter tees the response body into a bounded buffer.
+type bodyLogWriter struct {
+	gin.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (w *bodyLogWriter) Write(b []byte) (int, error) {
+	if w.buf.Len() <= maxLoggedBody {
+		w.buf.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyLogWriter) WriteString(s string) (int, error) {
+	if w.buf.Len() <= maxLoggedBody {
+		w.buf.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *bodyLogWriter) jsonBody() []byte {
+	if !isJSON(strings.TrimSpace(strings.SplitN(w.Header().Get("Content-Type"), ";", 2)[0])) {
+		return nil
+	}
+	return w.buf.Bytes()
+}
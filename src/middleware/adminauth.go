@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"text/main/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAPIKeyHeader carries the admin API key (ADMIN_API_KEY).
+const AdminAPIKeyHeader = "X-API-Key"
+
+// HasAdminKey reports whether the request carries key in X-API-Key, comparing
+// in constant time. An empty key matches nothing.
+func HasAdminKey(c *gin.Context, key string) bool {
+	return key != "" && subtle.ConstantTimeCompare([]byte(c.GetHeader(AdminAPIKeyHeader)), []byte(key)) == 1
+}
+
+// RequireAdminKey rejects requests without key in X-API-Key with 401. When
+// no key is configured every request is rejected with 403, so admin routes
+// are closed unless ADMIN_API_KEY is set.
+func RequireAdminKey(key string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key == "" {
+			response.WriteError(c, http.StatusForbidden, response.ErrCodeForbidden, "admin API is disabled: ADMIN_API_KEY is not set", nil)
+			return
+		}
+		if !HasAdminKey(c, key) {
+			c.Header("WWW-Authenticate", AdminAPIKeyHeader)
+			response.WriteError(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "a valid X-API-Key is required", nil)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/main/response"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// DefaultAdminRateLimits allows one catalog rebuild every 5 minutes. It is
+// used when ADMIN_RATE_LIMITS is not set.
+const DefaultAdminRateLimits = "GET:/admin/products/rebuild:1/5m"
+
+// RouteLimit allows Requests requests to a route every Per, across all callers.
+type RouteLimit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// ParseRouteLimits parses a comma-separated list of METHOD:path:requests/period
+// entries such as "GET:/admin/products/rebuild:1/5m". Paths are route
+// patterns (e.g. /admin/experiments/:id/results), and periods are Go durations. Limits are
+// keyed by "METHOD:path".
+func ParseRouteLimits(raw string) (map[string]RouteLimit, error) {
+	limits := make(map[string]RouteLimit)
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		method, rest, ok := strings.Cut(entry, ":")
+		i := strings.LastIndex(rest, ":")
+		if !ok || method == "" || i <= 0 {
+			return nil, fmt.Errorf("invalid route limit %q, want METHOD:path:requests/period", entry)
+		}
+		path, spec := rest[:i], rest[i+1:]
+		count, period, ok := strings.Cut(spec, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid limit %q for %s %s, want requests/period", spec, method, path)
+		}
+		requests, err := strconv.Atoi(count)
+		if err != nil || requests < 1 {
+			return nil, fmt.Errorf("invalid request count %q for %s %s", count, method, path)
+		}
+		per, err := time.ParseDuration(period)
+		if err != nil || per <= 0 {
+			return nil, fmt.Errorf("invalid period %q for %s %s", period, method, path)
+		}
+		limits[strings.ToUpper(method)+":"+path] = RouteLimit{Requests: requests, Per: per}
+	}
+	return limits, nil
+}
+
+// GlobalRateLimiter limits expensive routes regardless of who calls them:
+// each route in limits (see ParseRouteLimits) has a single token bucket that
+// holds Requests tokens and refills them over Per. Requests beyond the limit
+// get 429 with Retry-After. Routes not in limits are not limited.
+func GlobalRateLimiter(limits map[string]RouteLimit) gin.HandlerFunc {
+	// The map is only read after this point, so it needs no lock
+	limiters := make(map[string]*rate.Limiter, len(limits))
+	for route, limit := range limits {
+		limiters[route] = rate.NewLimiter(rate.Every(limit.Per/time.Duration(limit.Requests)), limit.Requests)
+	}
+
+	return func(c *gin.Context) {
+		route := c.Request.Method + ":" + c.FullPath()
+		limiter, ok := limiters[route]
+		if !ok {
+			c.Next()
+			return
+		}
+
+		reservation := limiter.Reserve()
+		if delay := reservation.Delay(); delay > 0 {
+			reservation.Cancel()
+			retryAfter := int(math.Ceil(delay.Seconds()))
+			log.Printf("Rate limited %s, retry after %ds\n", route, retryAfter)
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			response.WriteError(c, http.StatusTooManyRequests, response.ErrCodeRateLimited, "rate limit exceeded", gin.H{"route": route})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseRouteLimits(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{DefaultAdminRateLimits, "map[GET:/admin/products/rebuild:{1 5m0s}]", false},
+		{"post:/a:2/1m, GET:/admin/experiments/:id/results:10/1h", "map[GET:/admin/experiments/:id/results:{10 1h0m0s} POST:/a:{2 1m0s}]", false},
+		{"", "map[]", false},
+		{"GET/admin:1/5m", "", true},
+		{"GET:/admin:1", "", true},
+		{"GET:/admin:0/5m", "", true},
+		{"GET:/admin:x/5m", "", true},
+		{"GET:/admin:1/soon", "", true},
+		{"GET:/admin:1/-5m", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRouteLimits(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRouteLimits(%q) err = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && fmt.Sprint(got) != tt.want {
+			t.Errorf("ParseRouteLimits(%q) = %v, want %s", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestGlobalRateLimiter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limits, err := ParseRouteLimits("GET:/admin/products/rebuild:1/5m,GET:/admin/experiments/:id/results:1/5m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(GlobalRateLimiter(limits))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/admin/products/rebuild", ok)
+	r.GET("/admin/experiments/:id/results", ok)
+	r.GET("/admin/products/rebuild/status", ok)
+
+	send := func(path, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	steps := []struct {
+		name       string
+		path       string
+		remoteAddr string
+		want       int
+	}{
+		{"first rebuild", "/admin/products/rebuild", "10.0.0.1:1", http.StatusOK},
+		{"second rebuild", "/admin/products/rebuild", "10.0.0.1:1", http.StatusTooManyRequests},
+		{"rebuild from another caller", "/admin/products/rebuild", "10.0.0.2:1", http.StatusTooManyRequests},
+		{"another limited route", "/admin/experiments/a/results", "10.0.0.1:1", http.StatusOK},
+		// The limit is per route pattern, not per path
+		{"same pattern, other path", "/admin/experiments/b/results", "10.0.0.1:1", http.StatusTooManyRequests},
+		{"unlimited route", "/admin/products/rebuild/status", "10.0.0.1:1", http.StatusOK},
+		{"unlimited route again", "/admin/products/rebuild/status", "10.0.0.1:1", http.StatusOK},
+	}
+	for _, step := range steps {
+		w := send(step.path, step.remoteAddr)
+		if w.Code != step.want {
+			t.Fatalf("%s: status = %d, want %d", step.name, w.Code, step.want)
+		}
+		if w.Code != http.StatusTooManyRequests {
+			continue
+		}
+		// Roughly the 5 minutes until the bucket refills
+		retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+		if err != nil || retryAfter < 299 || retryAfter > 300 {
+			t.Errorf("%s: Retry-After = %q, want about 300", step.name, w.Header().Get("Retry-After"))
+		}
+	}
+}
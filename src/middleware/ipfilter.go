@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"text/main/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IPFilter rejects requests with 403 when the client IP matches the blocklist,
+// or when an allowlist is configured and the client IP is not on it.
+// Empty lists disable the corresponding check. The client IP is gin's
+// ClientIP, which only honours X-Forwarded-For from the engine's trusted
+// proxies (see CIDRStrings).
+func IPFilter(allowlist []net.IPNet, blocklist []net.IPNet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := net.ParseIP(c.ClientIP())
+		if ip == nil {
+			response.WriteError(c, http.StatusForbidden, response.ErrCodeForbidden, "forbidden", nil)
+			return
+		}
+		if len(blocklist) > 0 && containsIP(blocklist, ip) {
+			response.WriteError(c, http.StatusForbidden, response.ErrCodeForbidden, "forbidden", nil)
+			return
+		}
+		if len(allowlist) > 0 && !containsIP(allowlist, ip) {
+			response.WriteError(c, http.StatusForbidden, response.ErrCodeForbidden, "forbidden", nil)
+			return
+		}
+		c.Next()
+	}
+}
+
+// ParseCIDRList parses a comma-separated list such as "10.0.0.0/8,192.168.0.0/16".
+// Bare addresses are treated as single-host networks (/32 or /128).
+func ParseCIDRList(raw string) ([]net.IPNet, error) {
+	var nets []net.IPNet
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", entry)
+			}
+			if v4 := ip.To4(); v4 != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, *network)
+	}
+	return nets, nil
+}
+
+// CIDRStrings formats nets for gin's Engine.SetTrustedProxies.
+func CIDRStrings(nets []net.IPNet) []string {
+	out := make([]string, len(nets))
+	for i, n := range nets {
+		out[i] = n.String()
+	}
+	return out
+}
+
+func containsIP(nets []net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseCIDRList(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    []string
+		wantErr bool
+	}{
+		{"empty", "", []string{}, false},
+		{"networks", "10.0.0.0/8, 192.168.0.0/16", []string{"10.0.0.0/8", "192.168.0.0/16"}, false},
+		{"host address in a CIDR is masked to its network", "1.2.3.4/24", []string{"1.2.3.0/24"}, false},
+		{"bare IPv4 is a single host", "1.2.3.4", []string{"1.2.3.4/32"}, false},
+		{"bare IPv6 is a single host", "2001:DB8::1", []string{"2001:db8::1/128"}, false},
+		{"IPv6 network is normalised", "2001:0db8:0000::/32", []string{"2001:db8::/32"}, false},
+		{"blank entries are skipped", "1.2.3.0/24,,", []string{"1.2.3.0/24"}, false},
+		{"invalid address", "1.2.3", nil, true},
+		{"invalid prefix", "1.2.3.0/33", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nets, err := ParseCIDRList(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := CIDRStrings(nets)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestContainsIP(t *testing.T) {
+	nets, err := ParseCIDRList("10.0.0.0/8,1.2.3.4,2001:db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.0.0.0", true},
+		{"10.255.255.255", true},
+		{"11.0.0.1", false},
+		{"1.2.3.4", true},
+		{"1.2.3.5", false},
+		{"::ffff:10.1.2.3", true}, // IPv4-mapped IPv6
+		{"2001:db8:1::5", true},
+		{"2001:db9::1", false},
+	}
+	for _, tt := range tests {
+		if got := containsIP(nets, net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("containsIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestIPFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	allow, _ := ParseCIDRList("10.0.0.0/8")
+	block, _ := ParseCIDRList("10.9.0.0/16")
+	proxies, _ := ParseCIDRList("192.168.1.1")
+
+	tests := []struct {
+		name       string
+		allow      []net.IPNet
+		block      []net.IPNet
+		remoteAddr string
+		forwarded  string
+		want       int
+	}{
+		{"no lists", nil, nil, "8.8.8.8:1234", "", http.StatusOK},
+		{"allowed", allow, nil, "10.1.2.3:1234", "", http.StatusOK},
+		{"not allowed", allow, nil, "8.8.8.8:1234", "", http.StatusForbidden},
+		{"blocked inside the allowlist", allow, block, "10.9.1.1:1234", "", http.StatusForbidden},
+		{"blocked", nil, block, "10.9.1.1:1234", "", http.StatusForbidden},
+		{"forwarded by a trusted proxy", allow, nil, "192.168.1.1:1234", "10.1.2.3", http.StatusOK},
+		{"blocked client behind a trusted proxy", nil, block, "192.168.1.1:1234", "10.9.1.1", http.StatusForbidden},
+		{"forwarded by an untrusted peer is ignored", allow, nil, "8.8.8.8:1234", "10.1.2.3", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			if err := r.SetTrustedProxies(CIDRStrings(proxies)); err != nil {
+				t.Fatal(err)
+			}
+			r.GET("/orders", IPFilter(tt.allow, tt.block), func(c *gin.Context) { c.Status(http.StatusOK) })
+			req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
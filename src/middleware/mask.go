@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaskedURLKey holds the log-safe copy of the request URL set by MaskQueryParams.
+const MaskedURLKey = "masked_url"
+
+// Masked replaces sensitive query and path values in logs.
+const Masked = "[MASKED]"
+
+// DefaultMaskedParams is used when MASK_QUERY_PARAMS is unset.
+var DefaultMaskedParams = []string{"api_key", "token", "secret"}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ParseMaskedParams reads a MASK_QUERY_PARAMS value such as "api_key,token".
+// An empty value yields DefaultMaskedParams.
+func ParseMaskedParams(raw string) []string {
+	var params []string
+	for _, p := range strings.Split(raw, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			params = append(params, p)
+		}
+	}
+	if len(params) == 0 {
+		return DefaultMaskedParams
+	}
+	return params
+}
+
+// MaskURL returns a copy of u with the values of the given query parameters
+// (case-insensitive) and any UUID path segments replaced by [MASKED].
+// u itself is not modified.
+func MaskURL(u *url.URL, params []string) *url.URL {
+	masked := *u
+
+	segments := strings.Split(masked.EscapedPath(), "/")
+	changed := false
+	for i, s := range segments {
+		if uuidPattern.MatchString(s) {
+			segments[i] = Masked
+			changed = true
+		}
+	}
+	if changed {
+		masked.RawPath = strings.Join(segments, "/")
+		if path, err := url.PathUnescape(masked.RawPath); err == nil {
+			masked.Path = path
+		}
+	}
+
+	if masked.RawQuery != "" && len(params) > 0 {
+		sensitive := make(map[string]struct{}, len(params))
+		for _, p := range params {
+			sensitive[strings.ToLower(p)] = struct{}{}
+		}
+		// Rewrite pair by pair so unmasked parameters keep their order and encoding
+		pairs := strings.Split(masked.RawQuery, "&")
+		for i, pair := range pairs {
+			key, _, _ := strings.Cut(pair, "=")
+			name, err := url.QueryUnescape(key)
+			if err != nil {
+				name = key
+			}
+			if _, ok := sensitive[strings.ToLower(name)]; ok {
+				pairs[i] = key + "=" + Masked
+			}
+		}
+		masked.RawQuery = strings.Join(pairs, "&")
+	}
+	return &masked
+}
+
+// MaskQueryParams stores a masked copy of the request URL under MaskedURLKey
+// for the loggers. The request itself is untouched, so handlers still see the
+// original values.
+func MaskQueryParams(params []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(MaskedURLKey, MaskURL(c.Request.URL, params).RequestURI())
+		c.Next()
+	}
+}
+
+// loggedURL returns the masked URL when MaskQueryParams ran, else fallback.
+func loggedURL(keys map[string]any, fallback string) string {
+	if masked, ok := keys[MaskedURLKey].(string); ok {
+		return masked
+	}
+	return fallback
+}
+
+// MaskedLogFormatter is gin's default log line with the path taken from the
+// masked URL copy.
+func MaskedLogFormatter(param gin.LogFormatterParams) string {
+	return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		param.StatusCode,
+		param.Latency,
+		param.ClientIP,
+		param.Method,
+		loggedURL(param.Keys, param.Path),
+		param.ErrorMessage,
+	)
+}
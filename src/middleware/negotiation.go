@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"strconv"
+	"strings"
+	"text/main/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContentNegotiation picks the response format from the Accept header, in the
+// client's order of preference, and stores it for response.Write. Requests
+// that accept none of the supported formats get JSON.
+func ContentNegotiation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(response.FormatKey, negotiateFormat(c.GetHeader("Accept")))
+		c.Next()
+	}
+}
+
+func negotiateFormat(accept string) string {
+	best, bestQ := response.FormatJSON, -1.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, q := parseMediaRange(part)
+		format := ""
+		switch mediaType {
+		case "application/json", "application/vnd.api+json", "*/*", "application/*":
+			format = response.FormatJSON
+		case "application/msgpack", "application/x-msgpack":
+			format = response.FormatMsgPack
+		case "text/csv":
+			format = response.FormatCSV
+		}
+		if format != "" && q > 0 && q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	return best
+}
+
+func parseMediaRange(part string) (string, float64) {
+	params := strings.Split(part, ";")
+	mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+	q := 1.0
+	for _, p := range params[1:] {
+		key, value, ok := strings.Cut(strings.TrimSpace(p), "=")
+		if ok && strings.TrimSpace(key) == "q" {
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				q = parsed
+			}
+		}
+	}
+	return mediaType, q
+}
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/main/pkg/pii"
+	"text/main/response"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// CustomerTierHeader is set by the API gateway after API key lookup.
+	CustomerTierHeader = "X-Customer-Tier"
+	CustomerIDHeader   = "X-Customer-ID"
+
+	// CustomerTierKey and CustomerIDKey are the gin context keys holding the
+	// identity GatewayIdentity accepted.
+	CustomerTierKey = "customer_tier"
+	CustomerIDKey   = "customer_id"
+
+	// TierFree is also used for missing or unknown tiers.
+	TierFree       = "free"
+	TierPaid       = "paid"
+	TierEnterprise = "enterprise"
+
+	limiterIdleTTL = time.Hour
+)
+
+// DefaultTierLimits allows 10 requests/minute for free customers, 100 for
+// paid and no limit for enterprise.
+var DefaultTierLimits = map[string]rate.Limit{
+	TierFree:       rate.Every(time.Minute / 10),
+	TierPaid:       rate.Every(time.Minute / 100),
+	TierEnterprise: rate.Inf,
+}
+
+// GatewayIdentity accepts X-Customer-Tier and X-Customer-ID only on requests
+// whose peer is one of gateways (the API gateway or load balancer that sets
+// them after API key lookup), storing them under CustomerTierKey and
+// CustomerIDKey. Clients connecting directly cannot choose their own tier.
+func GatewayIdentity(gateways []net.IPNet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ip := net.ParseIP(c.RemoteIP()); ip != nil && containsIP(gateways, ip) {
+			if tier := strings.ToLower(strings.TrimSpace(c.GetHeader(CustomerTierHeader))); tier != "" {
+				c.Set(CustomerTierKey, tier)
+			}
+			if id := strings.TrimSpace(c.GetHeader(CustomerIDHeader)); id != "" {
+				c.Set(CustomerIDKey, id)
+			}
+		}
+		c.Next()
+	}
+}
+
+// TierFromContext returns the tier accepted by GatewayIdentity, defaulting
+// to free.
+func TierFromContext(c *gin.Context) string {
+	if tier := c.GetString(CustomerTierKey); tier != "" {
+		return tier
+	}
+	return TierFree
+}
+
+type customerLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen atomic.Int64
+}
+
+// TieredRateLimiter applies a token bucket per customer (the gateway's
+// X-Customer-ID, see GatewayIdentity, or the client IP when absent) and tier. Each bucket holds one minute's worth of
+// requests, so a free customer can make 10 requests back to back and is then
+// refilled at one every 6 seconds. Tiers missing from tiers are limited as
+// free. Limiters unused for an hour are evicted.
+func TieredRateLimiter(tiers map[string]rate.Limit, customerTierFn func(*gin.Context) string) gin.HandlerFunc {
+	var limiters sync.Map // customer ID + "|" + tier -> *customerLimiter
+
+	go func() {
+		for range time.Tick(10 * time.Minute) {
+			cutoff := time.Now().Add(-limiterIdleTTL).UnixNano()
+			limiters.Range(func(key, value any) bool {
+				if value.(*customerLimiter).lastSeen.Load() < cutoff {
+					limiters.Delete(key)
+				}
+				return true
+			})
+		}
+	}()
+
+	return func(c *gin.Context) {
+		tier := customerTierFn(c)
+		limit, ok := tiers[tier]
+		if !ok {
+			tier = TierFree
+			limit = tiers[TierFree]
+		}
+		if limit == rate.Inf {
+			c.Next()
+			return
+		}
+
+		customerID := c.GetString(CustomerIDKey)
+		if customerID == "" {
+			customerID = c.ClientIP()
+		}
+		value, ok := limiters.Load(customerID + "|" + tier)
+		if !ok {
+			burst := int(float64(limit) * time.Minute.Seconds())
+			if burst < 1 {
+				burst = 1
+			}
+			value, _ = limiters.LoadOrStore(customerID+"|"+tier, &customerLimiter{limiter: rate.NewLimiter(limit, burst)})
+		}
+		cl := value.(*customerLimiter)
+		cl.lastSeen.Store(time.Now().UnixNano())
+
+		reservation := cl.limiter.Reserve()
+		if delay := reservation.Delay(); delay > 0 {
+			reservation.Cancel()
+			retryAfter := int(math.Ceil(delay.Seconds()))
+			log.Printf("Rate limited customer %s (tier %s), retry after %ds\n", pii.Mask(customerID), tier, retryAfter)
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			response.WriteError(c, http.StatusTooManyRequests, response.ErrCodeRateLimited, "rate limit exceeded", gin.H{"tier": tier})
+			return
+		}
+		c.Next()
+	}
+}
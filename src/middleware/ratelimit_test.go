@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTieredRateLimiter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	gateways, _ := ParseCIDRList("10.0.0.1")
+
+	tests := []struct {
+		name        string
+		tier        string
+		requests    int
+		wantAllowed int
+	}{
+		{"free is blocked on the 11th request", TierFree, 11, 10},
+		{"paid is not blocked at 11", TierPaid, 11, 11},
+		{"paid is blocked on the 101st request", TierPaid, 101, 100},
+		{"enterprise is unlimited", TierEnterprise, 500, 500},
+		{"unknown tiers are limited as free", "gold", 11, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(GatewayIdentity(gateways), TieredRateLimiter(DefaultTierLimits, TierFromContext))
+			r.GET("/orders", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			allowed := 0
+			var last *httptest.ResponseRecorder
+			for i := 0; i < tt.requests; i++ {
+				req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+				req.RemoteAddr = "10.0.0.1:1234"
+				req.Header.Set(CustomerIDHeader, "42")
+				req.Header.Set(CustomerTierHeader, tt.tier)
+				last = httptest.NewRecorder()
+				r.ServeHTTP(last, req)
+				if last.Code == http.StatusOK {
+					allowed++
+				}
+			}
+			if allowed != tt.wantAllowed {
+				t.Fatalf("%d of %d requests allowed, want %d", allowed, tt.requests, tt.wantAllowed)
+			}
+			if allowed < tt.requests {
+				if last.Code != http.StatusTooManyRequests || last.Header().Get("Retry-After") == "" {
+					t.Errorf("blocked request got %d with Retry-After %q", last.Code, last.Header().Get("Retry-After"))
+				}
+			}
+		})
+	}
+}
+
+func TestTieredRateLimiterIsPerCustomer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	gateways, _ := ParseCIDRList("10.0.0.1")
+	r := gin.New()
+	r.Use(GatewayIdentity(gateways), TieredRateLimiter(DefaultTierLimits, TierFromContext))
+	r.GET("/orders", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	send := func(remoteAddr, customerID, tier string) int {
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set(CustomerIDHeader, customerID)
+		req.Header.Set(CustomerTierHeader, tier)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	for i := 0; i < 10; i++ {
+		send("10.0.0.1:1234", "1", TierFree)
+	}
+	if code := send("10.0.0.1:1234", "1", TierFree); code != http.StatusTooManyRequests {
+		t.Errorf("customer 1's 11th request got %d, want 429", code)
+	}
+	if code := send("10.0.0.1:1234", "2", TierFree); code != http.StatusOK {
+		t.Errorf("customer 2's first request got %d, want 200", code)
+	}
+	// Clients not behind the gateway cannot claim a tier; they are limited
+	// as free by IP
+	for i := 0; i < 10; i++ {
+		send("8.8.8.8:1234", "3", TierEnterprise)
+	}
+	if code := send("8.8.8.8:1234", "4", TierEnterprise); code != http.StatusTooManyRequests {
+		t.Errorf("direct client's 11th request got %d, want 429", code)
+	}
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIVersionKey is the gin context key holding the negotiated API version (int).
+const APIVersionKey = "api_version"
+
+// APIVersion negotiates the API version from either the
+// "Accept: application/vnd.api+json;version=N" header or the ?api_version=N
+// query parameter. The query parameter wins when both are present.
+func APIVersion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if v, ok := parseVersion(c.Query("api_version")); ok {
+			c.Set(APIVersionKey, v)
+		} else if v, ok := versionFromAccept(c.GetHeader("Accept")); ok {
+			c.Set(APIVersionKey, v)
+		}
+		c.Next()
+	}
+}
+
+// VersionMiddleware serves unversioned paths. It defaults the API version to 1
+// when none was negotiated and flags the route as deprecated.
+func VersionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, exists := c.Get(APIVersionKey); !exists {
+			c.Set(APIVersionKey, 1)
+		}
+		c.Header("Deprecation", "true")
+		c.Next()
+	}
+}
+
+// PinVersion fixes the API version for a path-versioned group such as /v1 or /v2.
+func PinVersion(version int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(APIVersionKey, version)
+		c.Next()
+	}
+}
+
+func versionFromAccept(accept string) (int, bool) {
+	for _, mediaType := range strings.Split(accept, ",") {
+		params := strings.Split(mediaType, ";")
+		if strings.TrimSpace(params[0]) != "application/vnd.api+json" {
+			continue
+		}
+		for _, param := range params[1:] {
+			key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if found && strings.TrimSpace(key) == "version" {
+				return parseVersion(strings.TrimSpace(value))
+			}
+		}
+	}
+	return 0, false
+}
+
+func parseVersion(raw string) (int, bool) {
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 1 {
+		return 0, false
+	}
+	return v, true
+}
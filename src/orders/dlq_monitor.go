@@ -0,0 +1,124 @@
+package orders
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+// CloudWatch metric emitted with the dead letter queue depth.
+const (
+	DLQMetricNamespace = "Orders"
+	DLQMetricName      = "DLQDepth"
+)
+
+// DeadLetterConfig describes where orders go after repeated failures.
+// MaxReceiveCount is how many times a message is received before it is moved
+// to the queue at DeadLetterARN.
+type DeadLetterConfig struct {
+	MaxReceiveCount int
+	DeadLetterARN   string
+}
+
+// RedrivePolicy returns the SQS RedrivePolicy attribute for c.
+func (c DeadLetterConfig) RedrivePolicy() (string, error) {
+	policy, err := json.Marshal(map[string]any{
+		"deadLetterTargetArn": c.DeadLetterARN,
+		"maxReceiveCount":     c.MaxReceiveCount,
+	})
+	return string(policy), err
+}
+
+// DLQStatus is returned by GET /admin/dlq/status.
+type DLQStatus struct {
+	QueueURL     string `json:"queue_url"`
+	MessageCount int64  `json:"message_count"`
+	// LastCheckedAt is null until the first successful check.
+	LastCheckedAt *time.Time `json:"last_checked_at"`
+}
+
+// DLQMonitor tracks how many orders are sitting in the dead letter queue
+// and publishes the depth to CloudWatch.
+type DLQMonitor struct {
+	sqs      sqsiface.SQSAPI
+	metrics  cloudwatchiface.CloudWatchAPI
+	queueURL string
+
+	mu     sync.Mutex
+	status DLQStatus
+}
+
+func NewDLQMonitor(sqsClient sqsiface.SQSAPI, metrics cloudwatchiface.CloudWatchAPI, queueURL string) *DLQMonitor {
+	return &DLQMonitor{
+		sqs:      sqsClient,
+		metrics:  metrics,
+		queueURL: queueURL,
+		status:   DLQStatus{QueueURL: queueURL},
+	}
+}
+
+// Check reads ApproximateNumberOfMessages from the DLQ, emits Orders/DLQDepth
+// and warns when any orders have been dead-lettered.
+func (m *DLQMonitor) Check(ctx context.Context) (DLQStatus, error) {
+	out, err := m.sqs.GetQueueAttributesWithContext(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(m.queueURL),
+		AttributeNames: []*string{aws.String(sqs.QueueAttributeNameApproximateNumberOfMessages)},
+	})
+	if err != nil {
+		return m.Status(), err
+	}
+	depth, err := strconv.ParseInt(aws.StringValue(out.Attributes[sqs.QueueAttributeNameApproximateNumberOfMessages]), 10, 64)
+	if err != nil {
+		return m.Status(), err
+	}
+	now := time.Now().UTC()
+
+	m.mu.Lock()
+	m.status.MessageCount = depth
+	m.status.LastCheckedAt = &now
+	status := m.status
+	m.mu.Unlock()
+
+	if depth > 0 {
+		log.Printf("WARNING: %d orders in dead letter queue %s\n", depth, m.queueURL)
+	}
+	_, err = m.metrics.PutMetricDataWithContext(ctx, &cloudwatch.PutMetricDataInput{
+		Namespace: aws.String(DLQMetricNamespace),
+		MetricData: []*cloudwatch.MetricDatum{{
+			MetricName: aws.String(DLQMetricName),
+			Timestamp:  aws.Time(now),
+			Unit:       aws.String(cloudwatch.StandardUnitCount),
+			Value:      aws.Float64(float64(depth)),
+		}},
+	})
+	return status, err
+}
+
+// Status returns the result of the last check.
+func (m *DLQMonitor) Status() DLQStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+// MonitorEvery checks the queue immediately and then once per interval in
+// the background.
+func (m *DLQMonitor) MonitorEvery(interval time.Duration) {
+	go func() {
+		for {
+			if _, err := m.Check(context.Background()); err != nil {
+				log.Printf("ERROR: DLQ check failed: %v\n", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
@@ -0,0 +1,149 @@
+package orders
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/firehose"
+	"github.com/aws/aws-sdk-go/service/firehose/firehoseiface"
+)
+
+// PutRecordBatch limits.
+const (
+	maxFirehoseBatchRecords = 500
+	maxFirehoseBatchBytes   = 4 << 20
+	// maxFirehoseBuffered bounds how many records are kept when Firehose is failing.
+	maxFirehoseBuffered = 10 * maxFirehoseBatchRecords
+)
+
+// ArchiveRecord is one newline-delimited JSON line in the S3 archive.
+type ArchiveRecord struct {
+	OrderID     string    `json:"order_id"`
+	CustomerID  int       `json:"customer_id"`
+	Total       float64   `json:"total"`
+	ProcessedAt time.Time `json:"processed_at"`
+	Items       []Item    `json:"items"`
+}
+
+// FirehoseProducer batches processed orders into PutRecordBatch calls on a
+// Kinesis Firehose delivery stream. It is safe for concurrent use; a nil
+// producer discards records.
+type FirehoseProducer struct {
+	client firehoseiface.FirehoseAPI
+	stream string
+
+	mu     sync.Mutex
+	buffer [][]byte
+	size   int
+}
+
+func NewFirehoseProducer(client firehoseiface.FirehoseAPI, stream string) *FirehoseProducer {
+	return &FirehoseProducer{client: client, stream: stream}
+}
+
+// PutRecord buffers the order for archival, sending a batch once 500 records
+// or 4 MB are waiting.
+func (p *FirehoseProducer) PutRecord(ctx context.Context, order Order, processedAt time.Time) error {
+	if p == nil {
+		return nil
+	}
+	data, err := json.Marshal(ArchiveRecord{
+		OrderID:     order.OrderID,
+		CustomerID:  order.CustomerID,
+		Total:       order.Total(),
+		ProcessedAt: processedAt.UTC(),
+		Items:       order.Items,
+	})
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.size+len(data) > maxFirehoseBatchBytes {
+		if err := p.flushLocked(ctx); err != nil {
+			log.Printf("ERROR: Firehose flush failed: %v\n", err)
+		}
+	}
+	if len(p.buffer) >= maxFirehoseBuffered {
+		log.Printf("WARNING: Firehose buffer full, dropping archive record for order %s\n", order.OrderID)
+		return nil
+	}
+	p.buffer = append(p.buffer, data)
+	p.size += len(data)
+	if len(p.buffer) >= maxFirehoseBatchRecords {
+		return p.flushLocked(ctx)
+	}
+	return nil
+}
+
+// Flush sends all buffered records.
+func (p *FirehoseProducer) Flush(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.flushLocked(ctx)
+}
+
+// FlushEvery sends buffered records in the background so quiet periods do
+// not hold records indefinitely.
+func (p *FirehoseProducer) FlushEvery(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			if err := p.Flush(context.Background()); err != nil {
+				log.Printf("ERROR: Firehose flush failed: %v\n", err)
+			}
+		}
+	}()
+}
+
+// flushLocked sends up to 500 records / 4 MB per call. Records Firehose
+// rejects stay buffered for the next flush.
+func (p *FirehoseProducer) flushLocked(ctx context.Context) error {
+	for len(p.buffer) > 0 {
+		n, size := 0, 0
+		for n < len(p.buffer) && n < maxFirehoseBatchRecords && size+len(p.buffer[n]) <= maxFirehoseBatchBytes {
+			size += len(p.buffer[n])
+			n++
+		}
+		records := make([]*firehose.Record, n)
+		for i := range records {
+			records[i] = &firehose.Record{Data: p.buffer[i]}
+		}
+
+		out, err := p.client.PutRecordBatchWithContext(ctx, &firehose.PutRecordBatchInput{
+			DeliveryStreamName: aws.String(p.stream),
+			Records:            records,
+		})
+		if err != nil {
+			return err
+		}
+
+		var failed [][]byte
+		if aws.Int64Value(out.FailedPutCount) > 0 {
+			for i, r := range out.RequestResponses {
+				if r.ErrorCode != nil {
+					failed = append(failed, p.buffer[i])
+				}
+			}
+			log.Printf("WARNING: Firehose rejected %d of %d records; will retry\n", len(failed), n)
+		}
+		p.buffer = append(failed, p.buffer[n:]...)
+		p.size = 0
+		for _, b := range p.buffer {
+			p.size += len(b)
+		}
+		if len(failed) > 0 {
+			// Leave the rejected records for the next scheduled flush
+			return nil
+		}
+	}
+	return nil
+}
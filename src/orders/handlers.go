@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"sync/atomic"
+	"text/main/response"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -15,6 +17,17 @@ import (
 // This creates the bottleneck needed to demonstrate async benefits
 var paymentSemaphore chan struct{}
 
+// syncQueueDepth counts sync orders waiting for a payment worker. Once it
+// reaches maxQueueDepth (MAX_QUEUE_DEPTH, default 100) and every worker is
+// busy, new sync orders are turned away with 503 instead of queueing.
+var (
+	syncQueueDepth atomic.Int64
+	maxQueueDepth  int64 = 100
+)
+
+// syncRetryAfter is the Retry-After (seconds) sent with a 503.
+const syncRetryAfter = "3"
+
 func init() {
 	// Read worker count from environment (default to 1)
 	workerCount := 1
@@ -27,25 +40,77 @@ func init() {
 	// Initialize semaphore with worker count capacity
 	paymentSemaphore = make(chan struct{}, workerCount)
 	log.Printf("Payment processor initialized with %d concurrent workers\n", workerCount)
+
+	if envDepth := os.Getenv("MAX_QUEUE_DEPTH"); envDepth != "" {
+		if depth, err := strconv.ParseInt(envDepth, 10, 64); err == nil && depth >= 0 {
+			maxQueueDepth = depth
+		}
+	}
 }
 
-type Handlers struct{}
+type Handlers struct {
+	router      *Router
+	categoryOf  CategoryLookup
+	webhooks    *WebhookRegistry
+	dlq         *DLQMonitor
+	orders      *Store
+	idempotency *IdempotencyStore
+	inventory   Inventory
+	adminAPIKey string
+}
 
 func NewHandlers() *Handlers {
-	return &Handlers{}
+	return &Handlers{
+		webhooks:    NewWebhookRegistry(),
+		orders:      NewStore(),
+		idempotency: NewIdempotencyStore(IdempotencyTTL),
+	}
+}
+
+// Webhooks returns the registry notified of this service's order events.
+func (h *Handlers) Webhooks() *WebhookRegistry {
+	return h.webhooks
+}
+
+// Orders returns the store recording the orders these handlers accept.
+func (h *Handlers) Orders() *Store {
+	return h.orders
+}
+
+// Idempotency returns the responses replayed for repeated Idempotency-Keys.
+func (h *Handlers) Idempotency() *IdempotencyStore {
+	return h.idempotency
+}
+
+// SetAdminAPIKey lets requests carrying key in X-API-Key list every
+// customer's orders. An empty key disables it.
+func (h *Handlers) SetAdminAPIKey(key string) {
+	h.adminAPIKey = key
+}
+
+// SetDLQMonitor enables GET /admin/dlq/status.
+func (h *Handlers) SetDLQMonitor(monitor *DLQMonitor) {
+	h.dlq = monitor
+}
+
+// SetRouting makes CreateOrderAsync publish to the topic chosen by router
+// instead of SNS_TOPIC_ARN. lookup supplies the item categories rules match on.
+func (h *Handlers) SetRouting(router *Router, lookup CategoryLookup) {
+	h.router = router
+	h.categoryOf = lookup
 }
 
 // POST /orders/sync - Synchronous order processing
 func (h *Handlers) CreateOrderSync(c *gin.Context) {
 	var order Order
 	if err := c.ShouldBindJSON(&order); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Message: "invalid JSON body: " + err.Error()})
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidJSON, "invalid JSON body: "+err.Error(), nil)
 		return
 	}
 
 	// Validate order has items
 	if len(order.Items) == 0 {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Message: "order must contain at least one item"})
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeEmptyOrder, "order must contain at least one item", nil)
 		return
 	}
 
@@ -54,6 +119,19 @@ func (h *Handlers) CreateOrderSync(c *gin.Context) {
 		order.CreatedAt = time.Now()
 	}
 
+	// Shed load rather than pile up goroutines behind a saturated processor
+	if len(paymentSemaphore) == cap(paymentSemaphore) && syncQueueDepth.Load() >= maxQueueDepth {
+		c.Header("Retry-After", syncRetryAfter)
+		response.WriteError(c, http.StatusServiceUnavailable, response.ErrCodeOverloaded, "payment processor is at capacity, retry later", nil)
+		return
+	}
+
+	if err := h.accept(order, StatusPending); err != nil {
+		writeAcceptError(c, err)
+		return
+	}
+	h.webhooks.Notify(OrderEvent{Type: EventOrderCreated, Order: order})
+
 	// Record start time for processing duration
 	start := time.Now()
 
@@ -66,12 +144,24 @@ func (h *Handlers) CreateOrderSync(c *gin.Context) {
 
 	processingTime := time.Since(start)
 
+	// Cancelled while waiting for a payment worker; nothing was charged
+	if result.Cancelled {
+		response.WriteError(c, http.StatusConflict, response.ErrCodeOrderCancelled, "order was cancelled before payment", nil)
+		return
+	}
+
 	// Check if payment was successful
 	if !result.Success {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Message: result.Error})
+		h.orders.SetStatus(order.OrderID, StatusFailed)
+		h.returnStock(order)
+		h.webhooks.Notify(OrderEvent{Type: EventOrderFailed, Order: order})
+		response.WriteError(c, http.StatusInternalServerError, response.ErrCodePaymentFailed, result.Error, nil)
 		return
 	}
 
+	h.orders.SetStatus(order.OrderID, StatusCompleted)
+	h.webhooks.Notify(OrderEvent{Type: EventOrderCompleted, Order: order})
+
 	// Return success response
 	response := OrderResponse{
 		OrderID:        order.OrderID,
@@ -87,6 +177,8 @@ func (h *Handlers) CreateOrderSync(c *gin.Context) {
 type PaymentResult struct {
 	Success bool
 	Error   string
+	// Cancelled is set when the order was cancelled before a worker took it
+	Cancelled bool
 }
 
 // processPaymentAsync simulates payment processing using a semaphore to create a real bottleneck
@@ -96,17 +188,27 @@ func (h *Handlers) processPaymentAsync(order Order) <-chan PaymentResult {
 	// Create a buffered channel with capacity of 1 for the result
 	resultChan := make(chan PaymentResult, 1)
 
+	// Count this order as queued until it holds a worker
+	syncQueueDepth.Add(1)
+
 	// Spawn a goroutine to simulate payment processing
 	go func() {
 		// CRITICAL: Acquire semaphore - blocks if another payment is processing
 		// This simulates a single-threaded payment processor bottleneck
 		paymentSemaphore <- struct{}{}
+		syncQueueDepth.Add(-1)
 
 		// Ensure we release the semaphore when done
 		defer func() {
 			<-paymentSemaphore // Release the semaphore
 		}()
 
+		// The order may have been cancelled while it waited for the worker
+		if !h.orders.StartProcessing(order.OrderID) {
+			resultChan <- PaymentResult{Cancelled: true}
+			return
+		}
+
 		// Now do the 3-second payment processing
 		// Only ONE request can be here at a time due to the semaphore
 		timer := time.NewTimer(3 * time.Second)
@@ -140,6 +242,25 @@ func (h *Handlers) processPaymentAsync(order Order) <-chan PaymentResult {
 //     return resultChan
 // }
 
+// GET /orders/sync/status - Payment worker utilisation
+func (h *Handlers) SyncStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, SyncStatus{
+		WorkersBusy:   len(paymentSemaphore),
+		Workers:       cap(paymentSemaphore),
+		QueueDepth:    syncQueueDepth.Load(),
+		MaxQueueDepth: maxQueueDepth,
+	})
+}
+
+// GET /admin/dlq/status - Dead letter queue depth from the last check
+func (h *Handlers) DLQStatus(c *gin.Context) {
+	if h.dlq == nil {
+		response.WriteError(c, http.StatusServiceUnavailable, response.ErrCodeMessagingUnavailable, "DLQ monitoring not configured", nil)
+		return
+	}
+	c.JSON(http.StatusOK, h.dlq.Status())
+}
+
 // Health check endpoint
 func (h *Handlers) HealthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
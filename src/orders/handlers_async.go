@@ -6,69 +6,152 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"text/main/middleware"
+	"text/main/response"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sns"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// AsyncHandlers publishes orders to SNS with a client shared by every request.
+// Without a client (see NewAsyncHandlersDisabled) async orders get 503.
+type AsyncHandlers struct {
+	Handlers
+	snsClient   *sns.SNS
+	snsTopicARN string
+}
+
+// NewAsyncHandlers creates the AWS session and SNS client once at startup.
+// snsTopicARN is the default topic for async orders and must be an SNS topic
+// ARN.
+func NewAsyncHandlers(snsTopicARN string) (*AsyncHandlers, error) {
+	if err := validateTopicARN(snsTopicARN); err != nil {
+		return nil, err
+	}
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String(os.Getenv("AWS_REGION")),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating AWS session: %w", err)
+	}
+	return &AsyncHandlers{
+		Handlers:    *NewHandlers(),
+		snsClient:   sns.New(sess),
+		snsTopicARN: snsTopicARN,
+	}, nil
+}
+
+// NewAsyncHandlersDisabled is used when no SNS topic is configured: the other
+// order routes work, and POST /orders/async returns 503.
+func NewAsyncHandlersDisabled() *AsyncHandlers {
+	return &AsyncHandlers{Handlers: *NewHandlers()}
+}
+
+// validateTopicARN accepts arn:<partition>:sns:<region>:<account>:<topic>.
+func validateTopicARN(topicARN string) error {
+	if topicARN == "" {
+		return fmt.Errorf("SNS topic ARN is required")
+	}
+	parsed, err := arn.Parse(topicARN)
+	if err != nil {
+		return fmt.Errorf("invalid SNS topic ARN %q: %w", topicARN, err)
+	}
+	if parsed.Service != "sns" || parsed.Region == "" || parsed.AccountID == "" || parsed.Resource == "" {
+		return fmt.Errorf("invalid SNS topic ARN %q: want arn:<partition>:sns:<region>:<account>:<topic>", topicARN)
+	}
+	return nil
+}
+
 // POST /orders/async - Asynchronous order processing
-func (h *Handlers) CreateOrderAsync(c *gin.Context) {
+func (h *AsyncHandlers) CreateOrderAsync(c *gin.Context) {
+	if h.snsClient == nil {
+		response.WriteError(c, http.StatusServiceUnavailable, response.ErrCodeMessagingUnavailable, "messaging service not configured", nil)
+		return
+	}
+
 	var order Order
 	if err := c.ShouldBindJSON(&order); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Message: "invalid JSON body: " + err.Error()})
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidJSON, "invalid JSON body: "+err.Error(), nil)
 		return
 	}
 
 	// Validate order has items
 	if len(order.Items) == 0 {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Message: "order must contain at least one item"})
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeEmptyOrder, "order must contain at least one item", nil)
 		return
 	}
 
-	// Get SNS topic ARN from environment
-	snsTopicARN := os.Getenv("SNS_TOPIC_ARN")
-	if snsTopicARN == "" {
-		log.Println("ERROR: SNS_TOPIC_ARN environment variable not set")
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "messaging service not configured"})
-		return
-	}
+	// The customer ID and request ID travel with the order as baggage so the
+	// processor's spans can be grouped per customer and matched to this request
+	requestID := c.GetString(response.RequestIDKey)
+	ctx := withOrderBaggage(c.Request.Context(), order.CustomerID, requestID)
+	ctx, span := tracer().Start(ctx, "orders.publish", trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(orderAttributes(ctx)...))
+	defer span.End()
 
-	// Create AWS session
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(os.Getenv("AWS_REGION")),
-	})
+	// Marshal order to JSON
+	orderJSON, err := json.Marshal(order)
 	if err != nil {
-		log.Printf("ERROR: Failed to create AWS session: %v\n", err)
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "failed to initialize messaging service"})
+		log.Printf("ERROR: Failed to marshal order: %v\n", err)
+		response.WriteError(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to process order", nil)
 		return
 	}
 
-	// Create SNS client
-	snsClient := sns.New(sess)
+	// Pick the fulfillment center's topic from the routing rules
+	snsTopicARN := h.snsTopicARN
+	if h.router != nil {
+		snsTopicARN = h.router.Route(order, categories(order, h.categoryOf))
+	}
 
-	// Marshal order to JSON
-	orderJSON, err := json.Marshal(order)
-	if err != nil {
-		log.Printf("ERROR: Failed to marshal order: %v\n", err)
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "failed to process order"})
+	// Record the order before publishing so a processor on this instance
+	// always finds it
+	if err := h.accept(order, StatusQueued); err != nil {
+		writeAcceptError(c, err)
 		return
 	}
 
-	// Publish message to SNS
-	_, err = snsClient.Publish(&sns.PublishInput{
-		TopicArn: aws.String(snsTopicARN),
-		Message:  aws.String(string(orderJSON)),
-		Subject:  aws.String(fmt.Sprintf("Order %s", order.OrderID)),
+	// Publish message to SNS. Orders the queue cannot deliver or process are
+	// kept in a dead letter queue (see DeadLetterConfig and DLQMonitor), which
+	// the messaging module configures with:
+	//
+	//	resource "aws_sqs_queue" "orders_dlq" {
+	//	  name                      = "order-processing-dlq"
+	//	  message_retention_seconds = 1209600 # 14 days
+	//	}
+	//
+	//	# in aws_sqs_queue.orders: processing failures move after 5 receives
+	//	redrive_policy = jsonencode({
+	//	  deadLetterTargetArn = aws_sqs_queue.orders_dlq.arn
+	//	  maxReceiveCount     = 5
+	//	})
+	//
+	//	# in aws_sns_topic_subscription.orders: undeliverable SNS messages
+	//	redrive_policy = jsonencode({
+	//	  deadLetterTargetArn = aws_sqs_queue.orders_dlq.arn
+	//	})
+	//
+	// The DLQ's queue policy must also allow sns.amazonaws.com to SendMessage.
+	_, err = h.snsClient.Publish(&sns.PublishInput{
+		TopicArn:          aws.String(snsTopicARN),
+		Message:           aws.String(string(orderJSON)),
+		Subject:           aws.String(fmt.Sprintf("Order %s", order.OrderID)),
+		MessageAttributes: messageAttributes(order, middleware.TierFromContext(c), requestID, injectTraceContext(ctx)),
 	})
 	if err != nil {
+		span.RecordError(err)
+		h.orders.SetStatus(order.OrderID, StatusFailed)
+		h.returnStock(order)
 		log.Printf("ERROR: Failed to publish to SNS: %v\n", err)
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "failed to queue order for processing"})
+		response.WriteError(c, http.StatusInternalServerError, response.ErrCodeMessagingUnavailable, "failed to queue order for processing", nil)
 		return
 	}
 
-	log.Printf("Order %s queued for async processing\n", order.OrderID)
+	log.Printf("Order %s queued for async processing correlation_id=%s\n", order.OrderID, requestID)
+	h.webhooks.Notify(OrderEvent{Type: EventOrderCreated, Order: order})
 
 	// Return 202 Accepted immediately
 	c.JSON(http.StatusAccepted, gin.H{
@@ -77,3 +160,52 @@ func (h *Handlers) CreateOrderAsync(c *gin.Context) {
 		"message":  "Order queued for processing",
 	})
 }
+
+// messageAttributes lets SQS subscriptions filter orders without reading the
+// body. For example, a queue that only handles large orders from paying
+// customers would use the subscription filter policy:
+//
+//	{
+//	  "customer_tier": ["paid", "enterprise"],
+//	  "order_total_bucket": ["high"]
+//	}
+//
+// correlationID and traceContext, when non-empty, are sent as the
+// correlation_id and tracecontext attributes (see injectTraceContext).
+func messageAttributes(order Order, tier, correlationID, traceContext string) map[string]*sns.MessageAttributeValue {
+	attrs := map[string]*sns.MessageAttributeValue{
+		"customer_tier": {
+			DataType:    aws.String("String"),
+			StringValue: aws.String(tier),
+		},
+		"order_total_bucket": {
+			DataType:    aws.String("String"),
+			StringValue: aws.String(totalBucket(order.Total())),
+		},
+	}
+	if correlationID != "" {
+		attrs[correlationIDKey] = &sns.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(correlationID),
+		}
+	}
+	if traceContext != "" {
+		attrs[traceContextAttribute] = &sns.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(traceContext),
+		}
+	}
+	return attrs
+}
+
+// totalBucket classifies an order total: low (< $50), medium ($50-$500) or high (> $500).
+func totalBucket(total float64) string {
+	switch {
+	case total < 50:
+		return "low"
+	case total <= 500:
+		return "medium"
+	default:
+		return "high"
+	}
+}
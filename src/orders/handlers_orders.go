@@ -0,0 +1,218 @@
+package orders
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"text/main/middleware"
+	"text/main/response"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAPIKeyHeader carries the admin API key (see Handlers.SetAdminAPIKey).
+const AdminAPIKeyHeader = middleware.AdminAPIKeyHeader
+
+const (
+	defaultOrderPageSize = 20
+	maxOrderPageSize     = 100
+)
+
+var orderStatuses = map[string]bool{
+	StatusPending: true, StatusQueued: true, StatusProcessing: true,
+	StatusCompleted: true, StatusFailed: true, StatusCancelled: true,
+}
+
+// OrderListResponse is returned by GET /orders. TotalCount counts every
+// matching order; NextCursor, when set, is the after_id of the next page.
+type OrderListResponse struct {
+	Orders     []Order `json:"orders"`
+	TotalCount int     `json:"total_count"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// isAdmin reports whether the request carries the admin API key. Without a
+// configured key nobody is an admin.
+func (h *Handlers) isAdmin(c *gin.Context) bool {
+	return middleware.HasAdminKey(c, h.adminAPIKey)
+}
+
+// GET /orders - Order history, oldest first
+//
+// customer_id limits the listing to one customer and must be the customer
+// the gateway identified unless the caller is an admin; listing every
+// customer's orders needs the admin API key. Pages are walked with after_id (the
+// previous page's next_cursor) and limit.
+func (h *Handlers) ListOrders(c *gin.Context) {
+	customerID := 0
+	if raw := c.Query("customer_id"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 {
+			response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "customer_id must be a positive integer", nil)
+			return
+		}
+		customerID = v
+		if !h.isCustomer(c, customerID) {
+			response.WriteError(c, http.StatusForbidden, response.ErrCodeForbidden, "customer_id must be your own customer ID", nil)
+			return
+		}
+	} else if !h.isAdmin(c) {
+		response.WriteError(c, http.StatusForbidden, response.ErrCodeForbidden, "customer_id is required without an admin API key", nil)
+		return
+	}
+	status := c.Query("status")
+	if status != "" && !orderStatuses[status] {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "status must be one of pending, queued, processing, completed, failed, cancelled", nil)
+		return
+	}
+	limit := defaultOrderPageSize
+	if raw := c.Query("limit"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 || v > maxOrderPageSize {
+			response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "limit must be between 1 and 100", nil)
+			return
+		}
+		limit = v
+	}
+
+	matching := h.orders.ListOrders(customerID, status)
+	start := 0
+	if afterID := c.Query("after_id"); afterID != "" {
+		start = -1
+		for i, o := range matching {
+			if o.OrderID == afterID {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "after_id is not an order in this listing", nil)
+			return
+		}
+	}
+	end := min(start+limit, len(matching))
+	resp := OrderListResponse{Orders: matching[start:end], TotalCount: len(matching)}
+	if end < len(matching) {
+		resp.NextCursor = matching[end-1].OrderID
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// searchDateLayout is the format of GET /admin/orders' from and to.
+const searchDateLayout = "2006-01-02"
+
+// GET /admin/orders - Search every customer's orders, oldest first
+//
+// customer_id, status, from and to (inclusive created_at dates) and q (words
+// that must all appear in the notes, case-insensitive) narrow the search.
+// Pages are selected with limit and offset. Mount behind the admin API key.
+func (h *Handlers) SearchOrders(c *gin.Context) {
+	var filter OrderFilter
+	if raw := c.Query("customer_id"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 {
+			response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "customer_id must be a positive integer", nil)
+			return
+		}
+		filter.CustomerID = v
+	}
+	filter.Status = c.Query("status")
+	if filter.Status != "" && !orderStatuses[filter.Status] {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "status must be one of pending, queued, processing, completed, failed, cancelled", nil)
+		return
+	}
+	if raw := c.Query("from"); raw != "" {
+		from, err := time.Parse(searchDateLayout, raw)
+		if err != nil {
+			response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "from must be a date like 2024-01-31", nil)
+			return
+		}
+		filter.From = from
+	}
+	if raw := c.Query("to"); raw != "" {
+		to, err := time.Parse(searchDateLayout, raw)
+		if err != nil {
+			response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "to must be a date like 2024-12-31", nil)
+			return
+		}
+		// to is inclusive, so the bound is the start of the next day
+		filter.To = to.AddDate(0, 0, 1)
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "from must not be after to", nil)
+		return
+	}
+	filter.Query = c.Query("q")
+	limit := defaultOrderPageSize
+	if raw := c.Query("limit"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 || v > maxOrderPageSize {
+			response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "limit must be between 1 and 100", nil)
+			return
+		}
+		limit = v
+	}
+	offset := 0
+	if raw := c.Query("offset"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 0 {
+			response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "offset must be a non-negative integer", nil)
+			return
+		}
+		offset = v
+	}
+
+	matching := h.orders.Search(filter)
+	start := min(offset, len(matching))
+	end := min(start+limit, len(matching))
+	c.JSON(http.StatusOK, OrderListResponse{Orders: matching[start:end], TotalCount: len(matching)})
+}
+
+// isCustomer reports whether the caller may act for customerID: the gateway
+// identified them as that customer (see middleware.GatewayIdentity), or the
+// request carries the admin API key. Refusals of callers the gateway did not
+// identify are logged, since they also happen when no gateway is configured.
+func (h *Handlers) isCustomer(c *gin.Context, customerID int) bool {
+	id := c.GetString(middleware.CustomerIDKey)
+	if id == strconv.Itoa(customerID) || h.isAdmin(c) {
+		return true
+	}
+	if id == "" {
+		log.Printf("WARNING: %s %s refused: no X-Customer-ID from a gateway in TRUSTED_PROXIES\n", c.Request.Method, c.FullPath())
+	}
+	return false
+}
+
+// ownsOrder reports whether the caller may act on order (see isCustomer).
+func (h *Handlers) ownsOrder(c *gin.Context, order Order) bool {
+	return h.isCustomer(c, order.CustomerID)
+}
+
+// POST /orders/:orderId/cancel - Cancel a pending or queued order
+//
+// Only the customer who placed the order, or an admin, may cancel it; other
+// callers get 404 so order IDs cannot be probed. Orders a payment worker has
+// picked up (processing), completed, failed and already cancelled orders get
+// 409. Neither the sync handler nor the processor pays for a cancelled
+// order, and its stock is returned.
+func (h *Handlers) CancelOrder(c *gin.Context) {
+	orderID := c.Param("orderId")
+	if existing, ok := h.orders.Get(orderID); !ok || !h.ownsOrder(c, existing) {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeOrderNotFound, "order not found", nil)
+		return
+	}
+	order, err := h.orders.Cancel(orderID)
+	if errors.Is(err, ErrOrderNotFound) {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeOrderNotFound, "order not found", nil)
+		return
+	}
+	if err != nil {
+		response.WriteError(c, http.StatusConflict, response.ErrCodeOrderNotCancellable, err.Error(), nil)
+		return
+	}
+	h.returnStock(order)
+	h.webhooks.Notify(OrderEvent{Type: EventOrderCancelled, Order: order})
+	c.JSON(http.StatusOK, order)
+}
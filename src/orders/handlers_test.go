@@ -0,0 +1,232 @@
+package orders
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"text/main/middleware"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testAdminKey = "test-admin-key"
+
+// newTestRouter serves the order routes over h. httptest requests come from
+// 192.0.2.1, which it trusts as the API gateway, so X-Customer-ID
+// identifies the caller.
+func newTestRouter(h *Handlers) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h.SetAdminAPIKey(testAdminKey)
+	gateways, _ := middleware.ParseCIDRList("192.0.2.1")
+	r := gin.New()
+	r.Use(middleware.GatewayIdentity(gateways))
+	Register(r, h)
+	return r
+}
+
+func serve(r http.Handler, method, path, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header.Set(k, v[0])
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func orderJSON(t *testing.T, order Order) string {
+	t.Helper()
+	body, err := json.Marshal(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+// saturatePayments occupies every payment worker and fills the sync queue
+// to maxQueueDepth until the test ends.
+func saturatePayments(t *testing.T) {
+	t.Helper()
+	for i := 0; i < cap(paymentSemaphore); i++ {
+		paymentSemaphore <- struct{}{}
+	}
+	syncQueueDepth.Add(maxQueueDepth)
+	t.Cleanup(func() {
+		syncQueueDepth.Add(-maxQueueDepth)
+		for i := 0; i < cap(paymentSemaphore); i++ {
+			<-paymentSemaphore
+		}
+	})
+}
+
+func TestCreateOrderSyncShedsLoadWhenQueueIsFull(t *testing.T) {
+	saturatePayments(t)
+	h := NewHandlers()
+	r := newTestRouter(h)
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		done <- serve(r, http.MethodPost, "/orders/sync", orderJSON(t, testOrder("order-1")), nil)
+	}()
+	select {
+	case w := <-done:
+		if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != syncRetryAfter {
+			t.Errorf("status = %d, Retry-After = %q, want 503 and %s", w.Code, w.Header().Get("Retry-After"), syncRetryAfter)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("POST /orders/sync blocked on a full queue")
+	}
+	if _, saved := h.Orders().Get("order-1"); saved {
+		t.Error("a shed order was saved")
+	}
+
+	w := serve(r, http.MethodGet, "/orders/sync/status", "", nil)
+	var status SyncStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	want := SyncStatus{WorkersBusy: cap(paymentSemaphore), Workers: cap(paymentSemaphore), QueueDepth: maxQueueDepth, MaxQueueDepth: maxQueueDepth}
+	if status != want {
+		t.Errorf("status = %+v, want %+v", status, want)
+	}
+}
+
+func TestCancelOrder(t *testing.T) {
+	customer := func(id string) http.Header { return http.Header{middleware.CustomerIDHeader: {id}} }
+	tests := []struct {
+		name       string
+		orderID    string
+		status     string
+		header     http.Header
+		wantStatus int
+		// wantStored is the order's status afterwards
+		wantStored string
+	}{
+		{"owner", "order-1", StatusQueued, customer("42"), http.StatusOK, StatusCancelled},
+		{"admin", "order-1", StatusPending, http.Header{AdminAPIKeyHeader: {testAdminKey}}, http.StatusOK, StatusCancelled},
+		{"another customer", "order-1", StatusQueued, customer("7"), http.StatusNotFound, StatusQueued},
+		{"no identity", "order-1", StatusQueued, nil, http.StatusNotFound, StatusQueued},
+		{"wrong admin key", "order-1", StatusQueued, http.Header{AdminAPIKeyHeader: {"guess"}}, http.StatusNotFound, StatusQueued},
+		{"unknown order", "order-9", StatusQueued, customer("42"), http.StatusNotFound, StatusQueued},
+		{"completed", "order-1", StatusCompleted, customer("42"), http.StatusConflict, StatusCompleted},
+		{"another customer's completed order", "order-1", StatusCompleted, customer("7"), http.StatusNotFound, StatusCompleted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandlers()
+			h.Orders().Save(testOrder("order-1"), tt.status)
+			r := newTestRouter(h)
+
+			w := serve(r, http.MethodPost, "/orders/"+tt.orderID+"/cancel", "", tt.header)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if stored, _ := h.Orders().Get("order-1"); stored.Status != tt.wantStored {
+				t.Errorf("order status = %s, want %s", stored.Status, tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestListOrdersOnlyListsTheCallersOrders(t *testing.T) {
+	customer := func(id string) http.Header { return http.Header{middleware.CustomerIDHeader: {id}} }
+	tests := []struct {
+		name       string
+		query      string
+		header     http.Header
+		wantStatus int
+		wantOrders int
+	}{
+		{"own orders", "?customer_id=42", customer("42"), http.StatusOK, 2},
+		{"another customer's orders", "?customer_id=7", customer("42"), http.StatusForbidden, 0},
+		{"no identity", "?customer_id=7", nil, http.StatusForbidden, 0},
+		{"wrong admin key", "?customer_id=7", http.Header{AdminAPIKeyHeader: {"guess"}}, http.StatusForbidden, 0},
+		{"admin, one customer", "?customer_id=7", http.Header{AdminAPIKeyHeader: {testAdminKey}}, http.StatusOK, 1},
+		{"admin, every customer", "", http.Header{AdminAPIKeyHeader: {testAdminKey}}, http.StatusOK, 3},
+		{"every customer without admin", "", customer("42"), http.StatusForbidden, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandlers()
+			h.Orders().Save(testOrder("order-1"), StatusQueued)
+			h.Orders().Save(testOrder("order-2"), StatusCompleted)
+			other := testOrder("order-3")
+			other.CustomerID = 7
+			h.Orders().Save(other, StatusQueued)
+			r := newTestRouter(h)
+
+			w := serve(r, http.MethodGet, "/orders"+tt.query, "", tt.header)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var resp OrderListResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Orders) != tt.wantOrders {
+				t.Errorf("got %d orders, want %d", len(resp.Orders), tt.wantOrders)
+			}
+		})
+	}
+}
+
+func TestSearchOrders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewHandlers()
+	for i, notes := range []string{"gift wrap", "leave at door", "gift, leave at door"} {
+		order := testOrder(fmt.Sprintf("order-%d", i+1))
+		order.CreatedAt = time.Date(2024, time.March, i+1, 9, 0, 0, 0, time.UTC)
+		order.Notes = notes
+		h.Orders().Save(order, StatusQueued)
+	}
+	r := gin.New()
+	RegisterAdmin(r, h)
+
+	tests := []struct {
+		query     string
+		status    int
+		wantIDs   []string
+		wantTotal int
+	}{
+		{"", http.StatusOK, []string{"order-1", "order-2", "order-3"}, 3},
+		{"?q=gift", http.StatusOK, []string{"order-1", "order-3"}, 2},
+		{"?customer_id=42&status=queued&from=2024-03-02&to=2024-03-02", http.StatusOK, []string{"order-2"}, 1},
+		{"?limit=1&offset=1", http.StatusOK, []string{"order-2"}, 3},
+		{"?offset=5", http.StatusOK, []string{}, 3},
+		{"?from=2024-03-03&to=2024-03-01", http.StatusBadRequest, nil, 0},
+		{"?from=March", http.StatusBadRequest, nil, 0},
+		{"?status=shipped", http.StatusBadRequest, nil, 0},
+		{"?limit=0", http.StatusBadRequest, nil, 0},
+		{"?offset=-1", http.StatusBadRequest, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := serve(r, http.MethodGet, "/admin/orders"+tt.query, "", nil)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var resp OrderListResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			ids := []string{}
+			for _, o := range resp.Orders {
+				ids = append(ids, o.OrderID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.wantIDs) || resp.TotalCount != tt.wantTotal {
+				t.Errorf("got %v of %d, want %v of %d", ids, resp.TotalCount, tt.wantIDs, tt.wantTotal)
+			}
+		})
+	}
+}
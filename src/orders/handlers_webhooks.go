@@ -0,0 +1,60 @@
+package orders
+
+import (
+	"net/http"
+	"net/url"
+	"text/main/response"
+	"text/main/validate"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterWebhookRequest is the body of POST /admin/webhooks. RetryCount
+// defaults to MaxWebhookRetries when omitted.
+type RegisterWebhookRequest struct {
+	URL        string   `json:"url" binding:"required,url"`
+	Secret     string   `json:"secret" binding:"required,min=16"`
+	Events     []string `json:"events" binding:"required,min=1"`
+	RetryCount *int     `json:"retry_count"`
+}
+
+// POST /admin/webhooks
+func (h *Handlers) RegisterWebhook(c *gin.Context) {
+	var body RegisterWebhookRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		if validate.Reject(c, err) {
+			return
+		}
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidJSON, "invalid JSON body", nil)
+		return
+	}
+	if u, err := url.Parse(body.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "url must be http or https", nil)
+		return
+	}
+
+	retries := MaxWebhookRetries
+	if body.RetryCount != nil {
+		retries = *body.RetryCount
+	}
+	webhook, err := h.webhooks.Register(Webhook{URL: body.URL, Secret: body.Secret, Events: body.Events, RetryCount: retries})
+	if err != nil {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, err.Error(), nil)
+		return
+	}
+	c.JSON(http.StatusCreated, webhook)
+}
+
+// GET /admin/webhooks
+func (h *Handlers) ListWebhooks(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"webhooks": h.webhooks.List()})
+}
+
+// DELETE /admin/webhooks/:id
+func (h *Handlers) UnregisterWebhook(c *gin.Context) {
+	if !h.webhooks.Unregister(c.Param("id")) {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeWebhookNotFound, "webhook not found", nil)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
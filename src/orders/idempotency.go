@@ -0,0 +1,87 @@
+package orders
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// IdempotencyTTL is how long a response is replayed for its Idempotency-Key.
+const IdempotencyTTL = 24 * time.Hour
+
+// idempotentResponse is a response recorded for an Idempotency-Key. Until the
+// first request finishes, done is false and only bodyHash is set.
+type idempotentResponse struct {
+	bodyHash    [sha256.Size]byte
+	done        bool
+	status      int
+	contentType string
+	body        []byte
+	expiresAt   time.Time
+}
+
+// IdempotencyStore remembers order creation responses by Idempotency-Key so
+// retried requests are answered without creating the order again.
+type IdempotencyStore struct {
+	ttl     time.Duration
+	entries sync.Map // key -> *idempotentResponse
+}
+
+func NewIdempotencyStore(ttl time.Duration) *IdempotencyStore {
+	return &IdempotencyStore{ttl: ttl}
+}
+
+// begin claims key for a request whose body hashes to bodyHash. If the key is
+// already claimed it returns the existing entry and false instead.
+func (s *IdempotencyStore) begin(key string, bodyHash [sha256.Size]byte, now time.Time) (*idempotentResponse, bool) {
+	claim := &idempotentResponse{bodyHash: bodyHash, expiresAt: now.Add(s.ttl)}
+	for {
+		existing, loaded := s.entries.LoadOrStore(key, claim)
+		if !loaded {
+			return claim, true
+		}
+		entry := existing.(*idempotentResponse)
+		if entry.expiresAt.After(now) {
+			return entry, false
+		}
+		s.entries.CompareAndDelete(key, existing)
+	}
+}
+
+// finish records the response to key's request. Entries are replaced rather
+// than updated so concurrent readers never see a partial response.
+func (s *IdempotencyStore) finish(key string, claim *idempotentResponse, status int, contentType string, body []byte) {
+	s.entries.CompareAndSwap(key, claim, &idempotentResponse{
+		bodyHash:    claim.bodyHash,
+		done:        true,
+		status:      status,
+		contentType: contentType,
+		body:        body,
+		expiresAt:   claim.expiresAt,
+	})
+}
+
+// abandon releases key so the request can be retried.
+func (s *IdempotencyStore) abandon(key string, claim *idempotentResponse) {
+	s.entries.CompareAndDelete(key, claim)
+}
+
+// ExpireEvery drops expired responses in the background.
+func (s *IdempotencyStore) ExpireEvery(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			s.expire(time.Now())
+		}
+	}()
+}
+
+func (s *IdempotencyStore) expire(now time.Time) int {
+	expired := 0
+	s.entries.Range(func(key, value any) bool {
+		if !value.(*idempotentResponse).expiresAt.After(now) && s.entries.CompareAndDelete(key, value) {
+			expired++
+		}
+		return true
+	})
+	return expired
+}
@@ -0,0 +1,86 @@
+package orders
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"text/main/product"
+	"text/main/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Inventory is the catalog stock orders draw on; *product.Store implements
+// it. Stock is taken when an order is accepted and returned if the order is
+// cancelled or its payment fails, so every completed order has taken it.
+type Inventory interface {
+	BatchReserveStock(items []product.ReservationItem) ([]product.ReservationItem, error)
+	RestoreStock(items []product.ReservationItem)
+}
+
+// SetInventory makes accepted orders take stock from inventory.
+func (h *Handlers) SetInventory(inventory Inventory) {
+	h.inventory = inventory
+}
+
+// stockItems returns the items of order that name a catalog product by its
+// numeric ID. Other product IDs (e.g. "PROD-001") have no catalog stock.
+func stockItems(order Order) []product.ReservationItem {
+	var items []product.ReservationItem
+	for _, item := range order.Items {
+		id, err := strconv.ParseInt(item.ProductID, 10, 32)
+		if err != nil {
+			continue
+		}
+		items = append(items, product.ReservationItem{ProductID: int32(id), Quantity: item.Quantity})
+	}
+	return items
+}
+
+// accept takes the order's stock and saves it with status. When the order
+// replaces an earlier attempt with the same ID, that attempt's stock is
+// returned. Nothing is taken if it fails.
+func (h *Handlers) accept(order Order, status string) error {
+	if err := h.takeStock(order); err != nil {
+		return err
+	}
+	replaced, ok, err := h.orders.Save(order, status)
+	if err != nil {
+		h.returnStock(order)
+		return err
+	}
+	if ok {
+		h.returnStock(replaced)
+	}
+	return nil
+}
+
+// takeStock decrements stock for every catalog item of order, or for none
+// of them if any is missing or short.
+func (h *Handlers) takeStock(order Order) error {
+	items := stockItems(order)
+	if h.inventory == nil || len(items) == 0 {
+		return nil
+	}
+	_, err := h.inventory.BatchReserveStock(items)
+	return err
+}
+
+// returnStock gives back the stock takeStock took for order.
+func (h *Handlers) returnStock(order Order) {
+	items := stockItems(order)
+	if h.inventory == nil || len(items) == 0 {
+		return
+	}
+	h.inventory.RestoreStock(items)
+}
+
+// writeAcceptError reports why accept turned an order away.
+func writeAcceptError(c *gin.Context, err error) {
+	var failed *product.ReservationError
+	if errors.As(err, &failed) {
+		response.WriteError(c, http.StatusConflict, response.ErrCodeInsufficientStock, product.ErrPartialReservation.Error(), failed)
+		return
+	}
+	response.WriteError(c, http.StatusConflict, response.ErrCodeOrderExists, err.Error(), nil)
+}
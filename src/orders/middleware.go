@@ -0,0 +1,128 @@
+package orders
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"text/main/middleware"
+	"text/main/response"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// IdempotencyKeyHeader lets clients retry order creation safely.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set to "true" on replayed responses.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	// maxIdempotentBodyBytes caps the request body read into memory to
+	// hash and replay.
+	maxIdempotentBodyBytes = 1 << 20
+)
+
+// Idempotency replays the recorded response when a request repeats an
+// Idempotency-Key seen within the store's TTL. Keys are scoped to the route
+// and the caller (see idempotencyOwner), so the same key may be used for
+// /orders/sync and /orders/async, and two customers who pick the same key
+// never see each other's responses. Reusing a
+// key with a different body is rejected with 422, and a retry that arrives
+// while the first request is still running gets 409. 5xx responses are not
+// recorded, so a retry after a server error is processed again. Bodies over
+// 1 MB are rejected with 413. Requests without the header pass through
+// unchanged.
+func Idempotency(store *IdempotencyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidIdempotencyKey, "Idempotency-Key must be at most 255 characters", nil)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotentBodyBytes))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				response.WriteError(c, http.StatusRequestEntityTooLarge, response.ErrCodeRequestTooLarge, "request body exceeds 1 MB limit", nil)
+				return
+			}
+			response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "failed to read request body", nil)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		scopedKey := c.Request.Method + " " + c.FullPath() + " " + idempotencyOwner(c, body) + " " + key
+		claim, claimed := store.begin(scopedKey, sha256.Sum256(body), time.Now())
+		if !claimed {
+			switch {
+			case claim.bodyHash != sha256.Sum256(body):
+				response.WriteError(c, http.StatusUnprocessableEntity, response.ErrCodeIdempotencyKeyReused, "Idempotency-Key was already used with a different request body", nil)
+			case !claim.done:
+				c.Header("Retry-After", "1")
+				response.WriteError(c, http.StatusConflict, response.ErrCodeIdempotencyKeyInUse, "a request with this Idempotency-Key is still being processed", nil)
+			default:
+				c.Header(IdempotentReplayedHeader, "true")
+				c.Data(claim.status, claim.contentType, claim.body)
+				c.Abort()
+			}
+			return
+		}
+
+		w := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		// Release the key if the handler panics so retries are not locked out
+		defer func() {
+			if !w.recorded {
+				store.abandon(scopedKey, claim)
+			}
+		}()
+
+		c.Next()
+
+		if w.Status() >= http.StatusInternalServerError {
+			return
+		}
+		store.finish(scopedKey, claim, w.Status(), w.Header().Get("Content-Type"), w.buf.Bytes())
+		w.recorded = true
+	}
+}
+
+// idempotencyOwner identifies who an Idempotency-Key belongs to: the
+// customer middleware.GatewayIdentity accepted or, for callers not behind
+// the gateway, the customer_id in the order body.
+func idempotencyOwner(c *gin.Context, body []byte) string {
+	if id := c.GetString(middleware.CustomerIDKey); id != "" {
+		return "customer:" + id
+	}
+	var order struct {
+		CustomerID int `json:"customer_id"`
+	}
+	json.Unmarshal(body, &order)
+	return "order-customer:" + strconv.Itoa(order.CustomerID)
+}
+
+// recordingWriter keeps a copy of the response body.
+type recordingWriter struct {
+	gin.ResponseWriter
+	buf      bytes.Buffer
+	recorded bool
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.buf.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.buf.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,54 @@
+package orders
+
+import (
+	"net/http"
+	"testing"
+	"text/main/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdempotencyKeysAreScopedToTheCustomer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	gateways, _ := middleware.ParseCIDRList("192.0.2.1")
+	calls := 0
+	r := gin.New()
+	r.Use(middleware.GatewayIdentity(gateways))
+	r.POST("/orders", Idempotency(NewIdempotencyStore(IdempotencyTTL)), func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusAccepted, gin.H{"call": calls})
+	})
+
+	key := func(customerID string) http.Header {
+		h := http.Header{IdempotencyKeyHeader: {"order-1"}}
+		if customerID != "" {
+			h.Set(middleware.CustomerIDHeader, customerID)
+		}
+		return h
+	}
+	steps := []struct {
+		name   string
+		body   string
+		header http.Header
+		// wantCall is the handler call whose response comes back
+		wantCall     string
+		wantReplayed bool
+	}{
+		{"customer 1", `{"customer_id":1}`, key(""), `{"call":1}`, false},
+		{"customer 2, same key", `{"customer_id":2}`, key(""), `{"call":2}`, false},
+		{"customer 1 retries", `{"customer_id":1}`, key(""), `{"call":1}`, true},
+		{"customer 2 retries", `{"customer_id":2}`, key(""), `{"call":2}`, true},
+		// The gateway identity wins over the body, so the same body from two
+		// gateway customers gets two orders
+		{"gateway customer 7", `{"customer_id":1}`, key("7"), `{"call":3}`, false},
+		{"gateway customer 8, same body", `{"customer_id":1}`, key("8"), `{"call":4}`, false},
+		{"gateway customer 7 retries", `{"customer_id":1}`, key("7"), `{"call":3}`, true},
+	}
+	for _, step := range steps {
+		w := serve(r, http.MethodPost, "/orders", step.body, step.header)
+		replayed := w.Header().Get(IdempotentReplayedHeader) == "true"
+		if w.Code != http.StatusAccepted || w.Body.String() != step.wantCall || replayed != step.wantReplayed {
+			t.Fatalf("%s: %d %s replayed=%v, want 202 %s replayed=%v", step.name, w.Code, w.Body, replayed, step.wantCall, step.wantReplayed)
+		}
+	}
+}
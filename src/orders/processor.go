@@ -1,20 +1,72 @@
 package orders
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"os"
+	"text/main/pkg/pii"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// visibilityTimeout is how long (seconds) each extension hides a message
+	// being processed; it matches the queue default.
+	visibilityTimeout = 30
+	// visibilityExtendInterval is how often in-flight messages are extended,
+	// leaving headroom before visibilityTimeout runs out.
+	visibilityExtendInterval = 20 * time.Second
 )
 
 // OrderProcessor continuously polls SQS and processes orders
 type OrderProcessor struct {
-	sqsClient *sqs.SQS
+	sqsClient SQSClient
 	queueURL  string
+	webhooks  *WebhookRegistry
+	archive   *FirehoseProducer
+	orders    *Store
+	// clock paces payments, receive retries and visibility extensions
+	clock clock
+}
+
+// clock is the time source the processor waits on; tests substitute one
+// that does not really sleep.
+type clock interface {
+	Sleep(d time.Duration)
+	// NewTicker returns a channel that receives every d until stop is called.
+	NewTicker(d time.Duration) (ticks <-chan time.Time, stop func())
+}
+
+type realClock struct{}
+
+func (realClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+func (realClock) NewTicker(d time.Duration) (<-chan time.Time, func()) {
+	t := time.NewTicker(d)
+	return t.C, t.Stop
+}
+
+// SetStore makes the processor mark the orders it completes in store.
+// Orders placed through another instance are not in it and are skipped.
+func (p *OrderProcessor) SetStore(store *Store) {
+	p.orders = store
+}
+
+// SetArchive makes the processor archive every processed order to Firehose.
+func (p *OrderProcessor) SetArchive(producer *FirehoseProducer) {
+	p.archive = producer
+}
+
+// SetWebhooks makes the processor send order.completed events to registry.
+func (p *OrderProcessor) SetWebhooks(registry *WebhookRegistry) {
+	p.webhooks = registry
 }
 
 // NewOrderProcessor creates a new order processor
@@ -34,13 +86,17 @@ func NewOrderProcessor() (*OrderProcessor, error) {
 		return nil, err
 	}
 
-	// Create SQS client
-	sqsClient := sqs.New(sess)
+	return NewOrderProcessorWithClient(sqs.New(sess), queueURL), nil
+}
 
+// NewOrderProcessorWithClient creates an order processor that polls queueURL
+// through client.
+func NewOrderProcessorWithClient(client SQSClient, queueURL string) *OrderProcessor {
 	return &OrderProcessor{
-		sqsClient: sqsClient,
+		sqsClient: client,
 		queueURL:  queueURL,
-	}, nil
+		clock:     realClock{},
+	}
 }
 
 // Start begins the order processing loop
@@ -53,12 +109,12 @@ func (p *OrderProcessor) Start() {
 	log.Printf("Starting order processor, polling queue: %s\n", p.queueURL)
 
 	// Run in a separate goroutine
-	go p.pollLoop()
+	go p.pollLoop(context.Background())
 }
 
-// pollLoop continuously polls SQS for messages
-func (p *OrderProcessor) pollLoop() {
-	for {
+// pollLoop continuously polls SQS for messages until ctx is done
+func (p *OrderProcessor) pollLoop(ctx context.Context) {
+	for ctx.Err() == nil {
 		// Receive messages from SQS (up to 10 messages, 20-second wait)
 		result, err := p.sqsClient.ReceiveMessage(&sqs.ReceiveMessageInput{
 			QueueUrl:            aws.String(p.queueURL),
@@ -68,7 +124,7 @@ func (p *OrderProcessor) pollLoop() {
 		})
 		if err != nil {
 			log.Printf("ERROR: Failed to receive messages from SQS: %v\n", err)
-			time.Sleep(5 * time.Second) // Wait before retry
+			p.clock.Sleep(5 * time.Second) // Wait before retry
 			continue
 		}
 
@@ -79,53 +135,127 @@ func (p *OrderProcessor) pollLoop() {
 	}
 }
 
-// processMessage processes a single order message
+// processMessage processes a single order message. Its log lines carry the
+// correlation_id of the request that placed the order.
 func (p *OrderProcessor) processMessage(message *sqs.Message) {
-	log.Printf("Processing message: %s\n", *message.MessageId)
-
-	// Extract SNS message body
+	// Extract SNS message body. SNS message attributes arrive inside the
+	// envelope, not as SQS message attributes.
 	var snsMessage struct {
-		Message string `json:"Message"`
+		Message           string `json:"Message"`
+		MessageAttributes map[string]struct {
+			Value string `json:"Value"`
+		} `json:"MessageAttributes"`
 	}
 	if err := json.Unmarshal([]byte(*message.Body), &snsMessage); err != nil {
-		log.Printf("ERROR: Failed to unmarshal SNS message: %v\n", err)
+		log.Printf("ERROR: Failed to unmarshal SNS message %s: %v\n", *message.MessageId, err)
 		// Still delete the message as it's malformed
 		p.deleteMessage(message)
 		return
 	}
+	correlationID := snsMessage.MessageAttributes[correlationIDKey].Value
+	log.Printf("Processing message: %s correlation_id=%s\n", *message.MessageId, correlationID)
 
 	// Parse order from SNS message
 	var order Order
 	if err := json.Unmarshal([]byte(snsMessage.Message), &order); err != nil {
-		log.Printf("ERROR: Failed to unmarshal order: %v\n", err)
+		log.Printf("ERROR: Failed to unmarshal order: %v correlation_id=%s\n", err, correlationID)
 		// Delete malformed message
 		p.deleteMessage(message)
 		return
 	}
 
-	log.Printf("Processing order %s with %d items\n", order.OrderID, len(order.Items))
+	log.Printf("Processing order %s for customer %s with %d items correlation_id=%s\n", order.OrderID, pii.Mask(order.CustomerID), len(order.Items), correlationID)
+
+	// Continue the trace started by CreateOrderAsync, baggage included. The
+	// correlation_id attribute also covers publishers that send no baggage.
+	ctx := extractTraceContext(context.Background(), snsMessage.MessageAttributes[traceContextAttribute].Value)
+	if correlationID != "" && baggage.FromContext(ctx).Member(correlationIDKey).Value() == "" {
+		ctx = withOrderBaggage(ctx, order.CustomerID, correlationID)
+	}
+	ctx, span := tracer().Start(ctx, "orders.process", trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(append(orderAttributes(ctx), attribute.String("order.id", order.OrderID))...))
+	defer span.End()
+
+	// Orders cancelled while queued are dropped without payment
+	if p.orders != nil {
+		if stored, ok := p.orders.Get(order.OrderID); ok && stored.Status == StatusCancelled {
+			log.Printf("Order %s was cancelled, skipping correlation_id=%s\n", order.OrderID, correlationID)
+			p.deleteMessage(message)
+			return
+		}
+	}
 
 	// Process the order (includes 3-second payment delay)
-	// This simulates payment processing with the same bottleneck as sync
-	p.processOrder(order)
+	// This simulates payment processing with the same bottleneck as sync.
+	// Waiting for a payment worker can outlast the visibility timeout, so keep
+	// the message hidden until we are done with it.
+	stop := p.extendVisibility(message)
+	paid := p.processOrder(order, correlationID)
+	stop()
+	if !paid {
+		p.deleteMessage(message)
+		return
+	}
+	if p.orders != nil {
+		p.orders.SetStatus(order.OrderID, StatusCompleted)
+	}
+	p.webhooks.Notify(OrderEvent{Type: EventOrderCompleted, Order: order})
+	if err := p.archive.PutRecord(ctx, order, time.Now()); err != nil {
+		span.RecordError(err)
+		log.Printf("ERROR: Failed to archive order %s: %v correlation_id=%s\n", order.OrderID, err, correlationID)
+	}
 
 	// Delete message from queue after successful processing
 	p.deleteMessage(message)
 
-	log.Printf("Order %s completed and removed from queue\n", order.OrderID)
+	log.Printf("Order %s completed and removed from queue correlation_id=%s\n", order.OrderID, correlationID)
 }
 
-// processOrder simulates order processing with payment delay
-func (p *OrderProcessor) processOrder(order Order) {
+// processOrder simulates order processing with payment delay. It reports
+// false, without paying, for orders cancelled while waiting for a worker.
+func (p *OrderProcessor) processOrder(order Order, correlationID string) bool {
 	// Acquire semaphore - blocks if another payment is processing
 	// This maintains the same bottleneck as the sync endpoint
 	paymentSemaphore <- struct{}{}
 	defer func() { <-paymentSemaphore }()
 
+	if p.orders != nil && !p.orders.StartProcessing(order.OrderID) {
+		log.Printf("Order %s was cancelled, skipping correlation_id=%s\n", order.OrderID, correlationID)
+		return false
+	}
+
 	// Simulate 3-second payment processing
-	log.Printf("Order %s: Processing payment...\n", order.OrderID)
-	time.Sleep(3 * time.Second)
-	log.Printf("Order %s: Payment completed\n", order.OrderID)
+	log.Printf("Order %s: Processing payment... correlation_id=%s\n", order.OrderID, correlationID)
+	p.clock.Sleep(3 * time.Second)
+	log.Printf("Order %s: Payment completed correlation_id=%s\n", order.OrderID, correlationID)
+	return true
+}
+
+// extendVisibility keeps message hidden from other consumers, extending its
+// visibility timeout every visibilityExtendInterval until the returned stop
+// function is called.
+func (p *OrderProcessor) extendVisibility(message *sqs.Message) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticks, stopTicker := p.clock.NewTicker(visibilityExtendInterval)
+		defer stopTicker()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticks:
+				_, err := p.sqsClient.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+					QueueUrl:          aws.String(p.queueURL),
+					ReceiptHandle:     message.ReceiptHandle,
+					VisibilityTimeout: aws.Int64(visibilityTimeout),
+				})
+				if err != nil {
+					log.Printf("ERROR: Failed to extend visibility of message %s: %v\n", *message.MessageId, err)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
 }
 
 // deleteMessage removes a message from the SQS queue
@@ -0,0 +1,466 @@
+package orders
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// MockSQSClient is an in-memory SQSClient. ReceiveMessage hands out queued
+// messages, blocking while the queue is empty, and returns injected errors
+// first. Deletes and visibility changes are recorded and signalled on
+// Events.
+type MockSQSClient struct {
+	mu       sync.Mutex
+	queue    []*sqs.Message
+	closed   bool
+	wake     chan struct{}
+	received int
+
+	// ReceiveErrs are returned, in order, by the next ReceiveMessage calls.
+	ReceiveErrs []error
+	// DeleteErr, if set, is returned by every DeleteMessage call.
+	DeleteErr error
+	// Deleted holds the receipt handles of deleted messages.
+	Deleted []string
+	// VisibilityTimeouts holds the timeout of every ChangeMessageVisibility call.
+	VisibilityTimeouts []int64
+	// Events receives "delete" or "visibility" after each such call.
+	Events chan string
+}
+
+func NewMockSQSClient(messages ...*sqs.Message) *MockSQSClient {
+	return &MockSQSClient{queue: messages, wake: make(chan struct{}, 1), Events: make(chan string, 100)}
+}
+
+// Push queues more messages.
+func (m *MockSQSClient) Push(messages ...*sqs.Message) {
+	m.mu.Lock()
+	m.queue = append(m.queue, messages...)
+	m.mu.Unlock()
+	m.signal()
+}
+
+// Close makes blocked and later ReceiveMessage calls fail.
+func (m *MockSQSClient) Close() {
+	m.mu.Lock()
+	m.closed = true
+	m.mu.Unlock()
+	m.signal()
+}
+
+func (m *MockSQSClient) signal() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (m *MockSQSClient) ReceiveMessage(in *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+	for {
+		m.mu.Lock()
+		if len(m.ReceiveErrs) > 0 {
+			err := m.ReceiveErrs[0]
+			m.ReceiveErrs = m.ReceiveErrs[1:]
+			m.mu.Unlock()
+			return nil, err
+		}
+		if m.closed {
+			m.mu.Unlock()
+			return nil, errors.New("mock queue closed")
+		}
+		if len(m.queue) > 0 {
+			n := min(len(m.queue), int(aws.Int64Value(in.MaxNumberOfMessages)))
+			out := &sqs.ReceiveMessageOutput{Messages: m.queue[:n]}
+			m.queue = m.queue[n:]
+			m.received += n
+			m.mu.Unlock()
+			return out, nil
+		}
+		m.mu.Unlock()
+		<-m.wake
+	}
+}
+
+func (m *MockSQSClient) DeleteMessage(in *sqs.DeleteMessageInput) (*sqs.DeleteMessageOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.DeleteErr != nil {
+		return nil, m.DeleteErr
+	}
+	m.Deleted = append(m.Deleted, aws.StringValue(in.ReceiptHandle))
+	m.Events <- "delete"
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (m *MockSQSClient) ChangeMessageVisibility(in *sqs.ChangeMessageVisibilityInput) (*sqs.ChangeMessageVisibilityOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.VisibilityTimeouts = append(m.VisibilityTimeouts, aws.Int64Value(in.VisibilityTimeout))
+	m.Events <- "visibility"
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+// sortedHandles returns the deleted receipt handles in sorted order.
+func sortedHandles(m *MockSQSClient) []string {
+	handles := m.deletedHandles()
+	sort.Strings(handles)
+	return handles
+}
+
+// deletedHandles returns a copy of Deleted.
+func (m *MockSQSClient) deletedHandles() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.Deleted...)
+}
+
+// fakeClock records sleeps instead of sleeping. When hold is set each Sleep
+// reports itself on sleeping and waits for hold to be closed. Ticks are
+// delivered by sending on ticks.
+type fakeClock struct {
+	mu       sync.Mutex
+	slept    []time.Duration
+	sleeping chan time.Duration
+	hold     chan struct{}
+	ticks    chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{sleeping: make(chan time.Duration, 100), ticks: make(chan time.Time)}
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	c.slept = append(c.slept, d)
+	hold := c.hold
+	c.mu.Unlock()
+	c.sleeping <- d
+	if hold != nil {
+		<-hold
+	}
+}
+
+func (c *fakeClock) NewTicker(time.Duration) (<-chan time.Time, func()) {
+	return c.ticks, func() {}
+}
+
+func (c *fakeClock) sleeps() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.slept...)
+}
+
+// newTestProcessor returns a processor over client that records orders in
+// a new Store and waits on clock.
+func newTestProcessor(client SQSClient, clock *fakeClock) (*OrderProcessor, *Store) {
+	p := NewOrderProcessorWithClient(client, "https://sqs.us-west-2.amazonaws.com/123456789012/orders")
+	p.clock = clock
+	store := NewStore()
+	p.SetStore(store)
+	return p, store
+}
+
+// orderMessage wraps order in an SNS envelope as SQS delivers it.
+func orderMessage(t *testing.T, receipt string, order Order) *sqs.Message {
+	t.Helper()
+	orderJSON, err := json.Marshal(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(map[string]any{
+		"Message":           string(orderJSON),
+		"MessageAttributes": map[string]any{correlationIDKey: map[string]string{"Value": "req-" + receipt}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rawMessage(receipt, string(body))
+}
+
+func rawMessage(receipt, body string) *sqs.Message {
+	return &sqs.Message{MessageId: aws.String("msg-" + receipt), ReceiptHandle: aws.String(receipt), Body: aws.String(body)}
+}
+
+func testOrder(id string) Order {
+	return Order{OrderID: id, CustomerID: 42, Status: StatusQueued, Items: []Item{{ProductID: "PROD-001", Quantity: 1, Price: 10}}}
+}
+
+// waitFor fails the test unless want arrives on events within a second.
+func waitFor(t *testing.T, events <-chan string, want string) {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case got := <-events:
+			if got == want {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s", want)
+		}
+	}
+}
+
+func TestPollLoopProcessesAndDeletes(t *testing.T) {
+	client := NewMockSQSClient()
+	client.ReceiveErrs = []error{errors.New("throttled")}
+	clock := newFakeClock()
+	p, store := newTestProcessor(client, clock)
+	orders := []Order{testOrder("ORD-1"), testOrder("ORD-2")}
+	for _, o := range orders {
+		store.Save(o, StatusQueued)
+	}
+	client.Push(orderMessage(t, "r1", orders[0]), orderMessage(t, "r2", orders[1]))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.pollLoop(ctx)
+		close(done)
+	}()
+	waitFor(t, client.Events, "delete")
+	waitFor(t, client.Events, "delete")
+	cancel()
+	client.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("pollLoop did not stop")
+	}
+
+	if got := fmt.Sprint(sortedHandles(client)); got != "[r1 r2]" {
+		t.Errorf("deleted = %s, want [r1 r2]", got)
+	}
+	for _, o := range orders {
+		if stored, _ := store.Get(o.OrderID); stored.Status != StatusCompleted {
+			t.Errorf("order %s status = %s, want completed", o.OrderID, stored.Status)
+		}
+	}
+	// The receive error is retried after 5s, then each payment takes 3s
+	sleeps := clock.sleeps()
+	if len(sleeps) < 3 || sleeps[0] != 5*time.Second {
+		t.Errorf("sleeps = %v, want a 5s retry then two 3s payments", sleeps)
+	}
+}
+
+func TestProcessMessageDeletesMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"not JSON", "{"},
+		{"envelope without an order", `{"Message":"not an order"}`},
+		{"order of the wrong shape", `{"Message":"{\"order_id\":7}"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewMockSQSClient()
+			clock := newFakeClock()
+			p, _ := newTestProcessor(client, clock)
+
+			p.processMessage(rawMessage("bad", tt.body))
+
+			if got := client.deletedHandles(); len(got) != 1 || got[0] != "bad" {
+				t.Errorf("deleted = %v, want [bad]", got)
+			}
+			if sleeps := clock.sleeps(); len(sleeps) != 0 {
+				t.Errorf("malformed message was paid for: sleeps = %v", sleeps)
+			}
+		})
+	}
+}
+
+func TestProcessMessageExtendsVisibility(t *testing.T) {
+	client := NewMockSQSClient()
+	clock := newFakeClock()
+	clock.hold = make(chan struct{})
+	p, store := newTestProcessor(client, clock)
+	order := testOrder("ORD-SLOW")
+	store.Save(order, StatusQueued)
+
+	done := make(chan struct{})
+	go func() {
+		p.processMessage(orderMessage(t, "slow", order))
+		close(done)
+	}()
+	// While payment is in progress, every tick extends the message's visibility
+	<-clock.sleeping
+	for range 2 {
+		clock.ticks <- time.Now()
+		waitFor(t, client.Events, "visibility")
+	}
+	if len(client.deletedHandles()) != 0 {
+		t.Error("message deleted before payment finished")
+	}
+	close(clock.hold)
+	<-done
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if fmt.Sprint(client.VisibilityTimeouts) != fmt.Sprint([]int64{visibilityTimeout, visibilityTimeout}) {
+		t.Errorf("visibility timeouts = %v, want two of %d", client.VisibilityTimeouts, visibilityTimeout)
+	}
+	if fmt.Sprint(client.Deleted) != "[slow]" {
+		t.Errorf("deleted = %v, want [slow]", client.Deleted)
+	}
+}
+
+func TestProcessMessageSkipsCancelled(t *testing.T) {
+	client := NewMockSQSClient()
+	clock := newFakeClock()
+	p, store := newTestProcessor(client, clock)
+	order := testOrder("ORD-CANCEL")
+	store.Save(order, StatusQueued)
+	store.Cancel(order.OrderID)
+
+	p.processMessage(orderMessage(t, "c", order))
+
+	if got := client.deletedHandles(); len(got) != 1 || got[0] != "c" {
+		t.Errorf("deleted = %v, want [c]", got)
+	}
+	if sleeps := clock.sleeps(); len(sleeps) != 0 {
+		t.Errorf("cancelled order was paid for: sleeps = %v", sleeps)
+	}
+	if stored, _ := store.Get(order.OrderID); stored.Status != StatusCancelled {
+		t.Errorf("status = %s, want cancelled", stored.Status)
+	}
+}
+
+// TestProcessOrderSkipsCancelledWhileWaiting covers an order cancelled after
+// processMessage checked it but before a payment worker was free.
+func TestProcessOrderSkipsCancelledWhileWaiting(t *testing.T) {
+	clock := newFakeClock()
+	p, store := newTestProcessor(NewMockSQSClient(), clock)
+	order := testOrder("ORD-LATE-CANCEL")
+	store.Save(order, StatusQueued)
+	store.Cancel(order.OrderID)
+
+	if p.processOrder(order, "req-late") {
+		t.Error("processOrder paid for a cancelled order")
+	}
+	if sleeps := clock.sleeps(); len(sleeps) != 0 {
+		t.Errorf("sleeps = %v, want none", sleeps)
+	}
+}
+
+func TestDeleteMessageErrorIsLogged(t *testing.T) {
+	client := NewMockSQSClient()
+	client.DeleteErr = errors.New("access denied")
+	p, _ := newTestProcessor(client, newFakeClock())
+
+	// A failed delete leaves the message for SQS to redeliver, and after
+	// repeated receives to move to the dead letter queue
+	p.deleteMessage(rawMessage("r", "{}"))
+	if got := client.deletedHandles(); len(got) != 0 {
+		t.Errorf("deleted = %v after a failed delete", got)
+	}
+}
+
+// captureLog sends the standard logger's output to the returned buffer
+// until the test ends.
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	flags := log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+	})
+	return &buf
+}
+
+func TestProcessMessageLogsCorrelationID(t *testing.T) {
+	tests := []struct {
+		name    string
+		message func(t *testing.T) *sqs.Message
+	}{
+		{"completed", func(t *testing.T) *sqs.Message { return orderMessage(t, "trace", testOrder("ORD-TRACE")) }},
+		{"malformed order", func(*testing.T) *sqs.Message {
+			return rawMessage("trace", `{"Message":"{","MessageAttributes":{"correlation_id":{"Value":"req-trace"}}}`)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store := newTestProcessor(NewMockSQSClient(), newFakeClock())
+			store.Save(testOrder("ORD-TRACE"), StatusQueued)
+			logs := captureLog(t)
+
+			p.processMessage(tt.message(t))
+
+			lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+			if len(lines) < 2 {
+				t.Fatalf("logged %q, want at least 2 lines", lines)
+			}
+			for _, line := range lines {
+				if !strings.HasSuffix(line, "correlation_id=req-trace") {
+					t.Errorf("log line %q does not end with correlation_id=req-trace", line)
+				}
+			}
+		})
+	}
+}
+
+func TestMessageAttributes(t *testing.T) {
+	order := testOrder("ORD-1")
+	tests := []struct {
+		name          string
+		correlationID string
+		traceContext  string
+		want          string
+	}{
+		{"both", "req-1", `{"baggage":"a=b"}`, "[correlation_id customer_tier order_total_bucket tracecontext]"},
+		{"no correlation ID", "", `{"baggage":"a=b"}`, "[customer_tier order_total_bucket tracecontext]"},
+		{"neither", "", "", "[customer_tier order_total_bucket]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attrs := messageAttributes(order, "paid", tt.correlationID, tt.traceContext)
+			names := make([]string, 0, len(attrs))
+			for name := range attrs {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			if got := fmt.Sprint(names); got != tt.want {
+				t.Fatalf("attributes = %s, want %s", got, tt.want)
+			}
+			if tt.correlationID != "" && aws.StringValue(attrs[correlationIDKey].StringValue) != tt.correlationID {
+				t.Errorf("correlation_id = %q, want %q", aws.StringValue(attrs[correlationIDKey].StringValue), tt.correlationID)
+			}
+		})
+	}
+}
+
+func TestTraceContextCarriesOrderBaggage(t *testing.T) {
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	t.Cleanup(func() { otel.SetTextMapPropagator(prev) })
+
+	ctx := withOrderBaggage(context.Background(), 42, "req 1;x")
+	got := orderAttributes(extractTraceContext(context.Background(), injectTraceContext(ctx)))
+	if fmt.Sprint(got) != fmt.Sprint(orderAttributes(ctx)) || got[0].Value.AsString() != "42" || got[1].Value.AsString() != "req 1;x" {
+		t.Errorf("attributes after the SNS hop = %v, want customer.id 42 and correlation_id \"req 1;x\"", got)
+	}
+
+	// Missing or unreadable trace context leaves the context as it was
+	for _, encoded := range []string{"", "{"} {
+		if got := orderAttributes(extractTraceContext(ctx, encoded)); fmt.Sprint(got) != fmt.Sprint(orderAttributes(ctx)) {
+			t.Errorf("extractTraceContext(%q) changed the baggage to %v", encoded, got)
+		}
+	}
+}
@@ -4,6 +4,23 @@ import "github.com/gin-gonic/gin"
 
 // Register mounts order routes on the provided router group or engine.
 func Register(r gin.IRoutes, h *Handlers) {
-	r.POST("/orders/sync", h.CreateOrderSync)
-	r.POST("/orders/async", h.CreateOrderAsync)
+	r.POST("/orders/sync", Idempotency(h.idempotency), h.CreateOrderSync)
+	r.GET("/orders/sync/status", h.SyncStatus)
+	r.GET("/orders", h.ListOrders)
+	r.POST("/orders/:orderId/cancel", h.CancelOrder)
+}
+
+// RegisterAsync mounts the SNS-backed async order route.
+func RegisterAsync(r gin.IRoutes, h *AsyncHandlers) {
+	r.POST("/orders/async", Idempotency(h.idempotency), h.CreateOrderAsync)
+}
+
+// RegisterAdmin mounts fulfillment partner and queue administration routes.
+// Mount them behind middleware.RequireAdminKey.
+func RegisterAdmin(r gin.IRoutes, h *Handlers) {
+	r.POST("/admin/webhooks", h.RegisterWebhook)
+	r.GET("/admin/webhooks", h.ListWebhooks)
+	r.DELETE("/admin/webhooks/:id", h.UnregisterWebhook)
+	r.GET("/admin/dlq/status", h.DLQStatus)
+	r.GET("/admin/orders", h.SearchOrders)
 }
@@ -0,0 +1,136 @@
+package orders
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rule sends orders matching Condition to Destination (an SNS topic ARN).
+//
+// A condition is "<field> <op> <value>" where field is category, customer_id,
+// status or order_id and op is ==, != or contains. Comparisons are
+// case-insensitive. An order has one category per item, so
+// "category == Electronics" matches if any item is Electronics and
+// "category != Electronics" only if none is.
+type Rule struct {
+	Condition   string `json:"condition"`
+	Destination string `json:"destination"`
+}
+
+// CategoryLookup resolves an order item's product ID to its catalog category.
+type CategoryLookup func(productID string) (string, bool)
+
+var routingFields = map[string]bool{"category": true, "customer_id": true, "status": true, "order_id": true}
+
+type condition struct {
+	field, op, value string
+}
+
+// Router picks the destination for an order from the first matching rule.
+type Router struct {
+	rules              []Rule
+	conditions         []condition
+	defaultDestination string
+}
+
+// ParseRoutingRules decodes a ROUTING_RULES_JSON value such as
+// [{"condition":"category == Electronics","destination":"arn:..."}].
+func ParseRoutingRules(raw string) ([]Rule, error) {
+	var rules []Rule
+	if strings.TrimSpace(raw) == "" {
+		return rules, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil, fmt.Errorf("invalid routing rules: %w", err)
+	}
+	return rules, nil
+}
+
+// NewRouter validates rules; every rule needs a parseable condition and a
+// non-empty destination.
+func NewRouter(rules []Rule, defaultDestination string) (*Router, error) {
+	r := &Router{rules: rules, defaultDestination: defaultDestination}
+	for i, rule := range rules {
+		if strings.TrimSpace(rule.Destination) == "" {
+			return nil, fmt.Errorf("routing rule %d: destination is required", i)
+		}
+		cond, err := parseCondition(rule.Condition)
+		if err != nil {
+			return nil, fmt.Errorf("routing rule %d: %w", i, err)
+		}
+		r.conditions = append(r.conditions, cond)
+	}
+	return r, nil
+}
+
+func parseCondition(expr string) (condition, error) {
+	for _, op := range []string{"==", "!=", " contains "} {
+		field, value, found := strings.Cut(expr, op)
+		if !found {
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		if !routingFields[field] {
+			return condition{}, fmt.Errorf("unknown field %q in %q", field, expr)
+		}
+		return condition{field: field, op: strings.TrimSpace(op), value: strings.ToLower(strings.TrimSpace(value))}, nil
+	}
+	return condition{}, fmt.Errorf("condition %q must use ==, != or contains", expr)
+}
+
+// Route returns the destination of the first rule matching the order, or the
+// default destination.
+func (r *Router) Route(order Order, productCategories []string) string {
+	for i, cond := range r.conditions {
+		if cond.matches(order, productCategories) {
+			return r.rules[i].Destination
+		}
+	}
+	return r.defaultDestination
+}
+
+func (c condition) matches(order Order, productCategories []string) bool {
+	var values []string
+	switch c.field {
+	case "category":
+		values = productCategories
+	case "customer_id":
+		values = []string{strconv.Itoa(order.CustomerID)}
+	case "status":
+		values = []string{order.Status}
+	case "order_id":
+		values = []string{order.OrderID}
+	}
+
+	if c.op == "!=" {
+		for _, v := range values {
+			if strings.ToLower(v) == c.value {
+				return false
+			}
+		}
+		return true
+	}
+	for _, v := range values {
+		v = strings.ToLower(v)
+		if (c.op == "==" && v == c.value) || (c.op == "contains" && strings.Contains(v, c.value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// categories resolves the distinct categories of the order's items; unknown
+// products are skipped.
+func categories(order Order, lookup CategoryLookup) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, item := range order.Items {
+		if category, ok := lookup(item.ProductID); ok && category != "" && !seen[category] {
+			seen[category] = true
+			out = append(out, category)
+		}
+	}
+	return out
+}
@@ -0,0 +1,11 @@
+package orders
+
+import "github.com/aws/aws-sdk-go/service/sqs"
+
+// SQSClient is the subset of the SQS API the order processor uses. *sqs.SQS
+// satisfies it; tests and local runs can supply their own implementation.
+type SQSClient interface {
+	ReceiveMessage(*sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(*sqs.DeleteMessageInput) (*sqs.DeleteMessageOutput, error)
+	ChangeMessageVisibility(*sqs.ChangeMessageVisibilityInput) (*sqs.ChangeMessageVisibilityOutput, error)
+}
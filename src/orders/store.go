@@ -0,0 +1,240 @@
+package orders
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Order statuses recorded by Store.
+const (
+	// StatusPending sync orders are waiting for payment.
+	StatusPending = "pending"
+	// StatusQueued async orders are published and waiting for the processor.
+	StatusQueued = "queued"
+	// StatusProcessing orders hold a payment worker and can no longer be
+	// cancelled.
+	StatusProcessing = "processing"
+	StatusCompleted  = "completed"
+	StatusFailed     = "failed"
+	// StatusCancelled is final: later status updates leave it unchanged.
+	StatusCancelled = "cancelled"
+)
+
+var (
+	ErrOrderNotFound       = errors.New("order not found")
+	ErrOrderNotCancellable = errors.New("only pending or queued orders can be cancelled")
+	ErrOrderExists         = errors.New("an order with this order_id already exists")
+)
+
+const (
+	// DefaultMaxOrders caps how many orders a Store keeps; the oldest are
+	// dropped first.
+	DefaultMaxOrders = 100000
+	// DefaultOrderRetention is how long a Store keeps an order after saving it.
+	DefaultOrderRetention = 7 * 24 * time.Hour
+)
+
+// storedOrder is an order with the time this instance saved it, which
+// retention is based on (created_at is client-supplied).
+type storedOrder struct {
+	Order
+	savedAt time.Time
+}
+
+// Store keeps the orders accepted by this instance in memory, in the order
+// they arrived, with their latest status. It holds at most maxOrders orders,
+// each for at most maxAge.
+type Store struct {
+	mu     sync.RWMutex
+	orders []storedOrder
+	// index maps order IDs to their position in orders
+	index     map[string]int
+	maxOrders int
+	maxAge    time.Duration
+}
+
+func NewStore() *Store {
+	return &Store{index: make(map[string]int), maxOrders: DefaultMaxOrders, maxAge: DefaultOrderRetention}
+}
+
+// SetRetention changes how many orders are kept and for how long.
+func (s *Store) SetRetention(maxOrders int, maxAge time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxOrders = maxOrders
+	s.maxAge = maxAge
+	s.dropLocked(time.Now())
+}
+
+// Save records order with the given status. An existing order with the same
+// ID is only replaced while it is still pending or queued and belongs to the
+// same customer, and is then returned with ok set; otherwise Save returns
+// ErrOrderExists, so a reused ID can neither overwrite another customer's
+// order nor revive a finished one.
+func (s *Store) Save(order Order, status string) (replaced Order, ok bool, err error) {
+	order.Status = status
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i, ok := s.index[order.OrderID]; ok {
+		existing := s.orders[i]
+		if existing.CustomerID != order.CustomerID || (existing.Status != StatusPending && existing.Status != StatusQueued) {
+			return Order{}, false, ErrOrderExists
+		}
+		s.orders[i] = storedOrder{Order: order, savedAt: existing.savedAt}
+		return existing.Order, true, nil
+	}
+	s.index[order.OrderID] = len(s.orders)
+	s.orders = append(s.orders, storedOrder{Order: order, savedAt: now})
+	// Drop a tenth of the capacity at once so a full store compacts rarely
+	if len(s.orders) > s.maxOrders {
+		s.dropOldestLocked(len(s.orders) - s.maxOrders + s.maxOrders/10)
+	}
+	return Order{}, false, nil
+}
+
+// ExpireEvery drops orders older than the retention period in the background.
+func (s *Store) ExpireEvery(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			s.mu.Lock()
+			s.dropLocked(time.Now())
+			s.mu.Unlock()
+		}
+	}()
+}
+
+// dropLocked drops expired orders and any beyond maxOrders. Callers must
+// hold the write lock.
+func (s *Store) dropLocked(now time.Time) {
+	n := sort.Search(len(s.orders), func(i int) bool { return now.Sub(s.orders[i].savedAt) < s.maxAge })
+	s.dropOldestLocked(max(n, len(s.orders)-s.maxOrders))
+}
+
+// dropOldestLocked removes the n oldest orders and rebuilds the index.
+// Callers must hold the write lock.
+func (s *Store) dropOldestLocked(n int) {
+	if n <= 0 {
+		return
+	}
+	n = min(n, len(s.orders))
+	for _, o := range s.orders[:n] {
+		delete(s.index, o.OrderID)
+	}
+	s.orders = slices.Delete(s.orders, 0, n)
+	for i, o := range s.orders {
+		s.index[o.OrderID] = i
+	}
+}
+
+// SetStatus updates a stored order's status and reports whether it exists.
+// Cancelled orders keep their status.
+func (s *Store) SetStatus(orderID, status string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, ok := s.index[orderID]
+	if !ok {
+		return false
+	}
+	if s.orders[i].Status != StatusCancelled {
+		s.orders[i].Status = status
+	}
+	return true
+}
+
+// Cancel marks a pending or queued order cancelled and returns it. It
+// returns ErrOrderNotFound for unknown orders and ErrOrderNotCancellable
+// for orders that are already completed, failed or cancelled.
+func (s *Store) Cancel(orderID string) (Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, ok := s.index[orderID]
+	if !ok {
+		return Order{}, ErrOrderNotFound
+	}
+	if status := s.orders[i].Status; status != StatusPending && status != StatusQueued {
+		return Order{}, ErrOrderNotCancellable
+	}
+	s.orders[i].Status = StatusCancelled
+	return s.orders[i].Order, nil
+}
+
+// StartProcessing moves order orderID to processing once a payment worker has
+// picked it up, and reports whether it may be paid for. Cancelled orders
+// return false. Orders not in the store (placed through another instance)
+// return true.
+func (s *Store) StartProcessing(orderID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, ok := s.index[orderID]
+	if !ok {
+		return true
+	}
+	if s.orders[i].Status == StatusCancelled {
+		return false
+	}
+	s.orders[i].Status = StatusProcessing
+	return true
+}
+
+// Get returns the stored order.
+func (s *Store) Get(orderID string) (Order, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i, ok := s.index[orderID]
+	if !ok {
+		return Order{}, false
+	}
+	return s.orders[i].Order, true
+}
+
+// ListOrders returns the orders of customerID (0 for every customer) with
+// the given status ("" for any), oldest first.
+func (s *Store) ListOrders(customerID int, status string) []Order {
+	return s.Search(OrderFilter{CustomerID: customerID, Status: status})
+}
+
+// OrderFilter selects orders for Search. Zero fields match every order.
+type OrderFilter struct {
+	CustomerID int
+	Status     string
+	// From and To bound created_at to [From, To)
+	From, To time.Time
+	// Query matches orders whose notes contain every word of it,
+	// case-insensitively
+	Query string
+}
+
+// Matches reports whether o passes every filter in f.
+func (f OrderFilter) Matches(o Order) bool {
+	if (f.CustomerID != 0 && o.CustomerID != f.CustomerID) || (f.Status != "" && o.Status != f.Status) {
+		return false
+	}
+	if (!f.From.IsZero() && o.CreatedAt.Before(f.From)) || (!f.To.IsZero() && !o.CreatedAt.Before(f.To)) {
+		return false
+	}
+	notes := strings.ToLower(o.Notes)
+	for _, word := range strings.Fields(strings.ToLower(f.Query)) {
+		if !strings.Contains(notes, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// Search returns the orders matching f, oldest first.
+func (s *Store) Search(f OrderFilter) []Order {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []Order{}
+	for _, o := range s.orders {
+		if f.Matches(o.Order) {
+			out = append(out, o.Order)
+		}
+	}
+	return out
+}
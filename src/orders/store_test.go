@@ -0,0 +1,49 @@
+package orders
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestStoreSearch(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, time.January, d, 12, 0, 0, 0, time.UTC) }
+	s := NewStore()
+	for _, o := range []Order{
+		{OrderID: "order-1", CustomerID: 42, CreatedAt: day(1), Notes: "Gift wrap, please"},
+		{OrderID: "order-2", CustomerID: 42, CreatedAt: day(2), Notes: "Leave at door"},
+		{OrderID: "order-3", CustomerID: 7, CreatedAt: day(3), Notes: "GIFT for mum, leave at door"},
+		{OrderID: "order-4", CustomerID: 42, CreatedAt: day(4)},
+	} {
+		s.Save(o, StatusQueued)
+	}
+	s.SetStatus("order-2", StatusCompleted)
+
+	tests := []struct {
+		name   string
+		filter OrderFilter
+		want   string
+	}{
+		{"everything", OrderFilter{}, "[order-1 order-2 order-3 order-4]"},
+		{"customer", OrderFilter{CustomerID: 42}, "[order-1 order-2 order-4]"},
+		{"status", OrderFilter{Status: StatusCompleted}, "[order-2]"},
+		{"from", OrderFilter{From: day(3)}, "[order-3 order-4]"},
+		{"to is exclusive", OrderFilter{To: day(2)}, "[order-1]"},
+		{"date range", OrderFilter{From: day(2), To: day(4)}, "[order-2 order-3]"},
+		{"notes ignore case", OrderFilter{Query: "gift"}, "[order-1 order-3]"},
+		{"every word must match", OrderFilter{Query: "door gift"}, "[order-3]"},
+		{"customer and notes", OrderFilter{CustomerID: 42, Query: "door"}, "[order-2]"},
+		{"no match", OrderFilter{CustomerID: 7, Status: StatusCompleted}, "[]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []string
+			for _, o := range s.Search(tt.filter) {
+				ids = append(ids, o.OrderID)
+			}
+			if got := fmt.Sprint(ids); got != tt.want {
+				t.Errorf("Search(%+v) = %s, want %s", tt.filter, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package orders
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// tracerName identifies spans started by this package.
+	tracerName = "text/main/orders"
+	// customerIDKey is the baggage member and span attribute carrying the
+	// order's customer ID across the SNS/SQS hop.
+	customerIDKey = "customer.id"
+	// traceContextAttribute is the SNS message attribute holding the
+	// propagated trace context and baggage, encoded as a JSON object.
+	traceContextAttribute = "tracecontext"
+	// correlationIDKey is the SNS message attribute, baggage member and span
+	// attribute carrying the X-Request-ID of the request that placed the
+	// order, so its processing can be matched to the API logs.
+	correlationIDKey = "correlation_id"
+)
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// withOrderBaggage adds customerID and correlationID to ctx's baggage so
+// they follow the order to the processor. An empty correlationID is left
+// out. Values are taken as is (the request ID is caller supplied); the
+// propagator percent-encodes them.
+func withOrderBaggage(ctx context.Context, customerID int, correlationID string) context.Context {
+	bag := baggage.FromContext(ctx)
+	members := map[string]string{customerIDKey: strconv.Itoa(customerID)}
+	if correlationID != "" {
+		members[correlationIDKey] = correlationID
+	}
+	for key, value := range members {
+		member, err := baggage.NewMemberRaw(key, value)
+		if err != nil {
+			log.Printf("WARNING: Failed to create %s baggage: %v\n", key, err)
+			continue
+		}
+		if bag, err = bag.SetMember(member); err != nil {
+			log.Printf("WARNING: Failed to set %s baggage: %v\n", key, err)
+		}
+	}
+	return baggage.ContextWithBaggage(ctx, bag)
+}
+
+// orderAttributes returns ctx's customer.id and correlation_id baggage as
+// span attributes.
+func orderAttributes(ctx context.Context) []attribute.KeyValue {
+	bag := baggage.FromContext(ctx)
+	return []attribute.KeyValue{
+		attribute.String(customerIDKey, bag.Member(customerIDKey).Value()),
+		attribute.String(correlationIDKey, bag.Member(correlationIDKey).Value()),
+	}
+}
+
+// injectTraceContext encodes ctx's trace context and baggage with the global
+// propagator (see otel.SetTextMapPropagator). It returns "" when there is
+// nothing to propagate.
+func injectTraceContext(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return ""
+	}
+	encoded, err := json.Marshal(carrier)
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
+
+// extractTraceContext is the inverse of injectTraceContext. Unreadable values
+// are ignored so a bad attribute never blocks order processing.
+func extractTraceContext(ctx context.Context, encoded string) context.Context {
+	if encoded == "" {
+		return ctx
+	}
+	carrier := propagation.MapCarrier{}
+	if err := json.Unmarshal([]byte(encoded), &carrier); err != nil {
+		log.Printf("WARNING: Ignoring unreadable %s attribute: %v\n", traceContextAttribute, err)
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
@@ -9,6 +9,8 @@ type Order struct {
 	Status     string    `json:"status" binding:"required"`
 	Items      []Item    `json:"items" binding:"required"`
 	CreatedAt  time.Time `json:"created_at"`
+	// Notes are free-text customer instructions, e.g. "Leave at door".
+	Notes string `json:"notes,omitempty" binding:"max=500"`
 }
 
 // Item represents an item within an order.
@@ -18,6 +20,15 @@ type Item struct {
 	Price     float64 `json:"price" binding:"required,min=0"`
 }
 
+// Total is the sum of price * quantity over all items.
+func (o Order) Total() float64 {
+	total := 0.0
+	for _, item := range o.Items {
+		total += item.Price * float64(item.Quantity)
+	}
+	return total
+}
+
 // OrderResponse is returned after successful order processing.
 type OrderResponse struct {
 	OrderID        string `json:"order_id"`
@@ -26,7 +37,10 @@ type OrderResponse struct {
 	Message        string `json:"message"`
 }
 
-// ErrorResponse is a basic error payload.
-type ErrorResponse struct {
-	Message string `json:"message"`
+// SyncStatus reports payment worker load for the sync order endpoint.
+type SyncStatus struct {
+	WorkersBusy   int   `json:"workers_busy"`
+	Workers       int   `json:"workers"`
+	QueueDepth    int64 `json:"queue_depth"`
+	MaxQueueDepth int64 `json:"max_queue_depth"`
 }
@@ -0,0 +1,259 @@
+package orders
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Order event types a webhook can subscribe to.
+const (
+	EventOrderCreated   = "order.created"
+	EventOrderCompleted = "order.completed"
+	EventOrderFailed    = "order.failed"
+	EventOrderCancelled = "order.cancelled"
+)
+
+var webhookEvents = map[string]bool{EventOrderCreated: true, EventOrderCompleted: true, EventOrderFailed: true, EventOrderCancelled: true}
+
+const (
+	// WebhookSignatureHeader carries "sha256=" + hex(HMAC-SHA256(secret, body)).
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	// MaxWebhookRetries is the default and maximum number of redeliveries.
+	MaxWebhookRetries = 3
+)
+
+// Webhook is a registered fulfillment partner endpoint.
+type Webhook struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Secret string   `json:"-"`
+	Events []string `json:"events"`
+	// RetryCount is how many times a failed delivery is retried (5s, 25s, 125s apart).
+	RetryCount int `json:"retry_count"`
+}
+
+func (w *Webhook) subscribes(eventType string) bool {
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderEvent is the JSON body POSTed to webhooks.
+type OrderEvent struct {
+	Type      string    `json:"type"`
+	Order     Order     `json:"order"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// WebhookRegistry stores webhooks in memory and delivers order events to them.
+// A nil registry ignores events.
+type WebhookRegistry struct {
+	webhooks sync.Map // id -> *Webhook
+	client   *http.Client
+	// backoff returns the delay before retry n (0-based)
+	backoff func(n int) time.Duration
+	// lookupIP resolves webhook hosts at registration
+	lookupIP func(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+func NewWebhookRegistry() *WebhookRegistry {
+	return &WebhookRegistry{
+		client:   &http.Client{Timeout: 10 * time.Second, Transport: publicOnlyTransport()},
+		backoff:  func(n int) time.Duration { return 5 * time.Second * time.Duration(pow5(n)) },
+		lookupIP: net.DefaultResolver.LookupIPAddr,
+	}
+}
+
+// errInternalDestination rejects webhooks pointing into our own network.
+var errInternalDestination = errors.New("url must resolve to a public address")
+
+// carrierGradeNAT (100.64.0.0/10) is shared address space, not public.
+var carrierGradeNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// internalIP reports whether ip is loopback, link-local (including the EC2
+// metadata service at 169.254.169.254), private, unspecified, multicast or
+// shared address space.
+func internalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsPrivate() ||
+		ip.IsUnspecified() || carrierGradeNAT.Contains(ip)
+}
+
+// publicOnlyTransport refuses to connect to internal addresses, so webhooks
+// cannot reach them through DNS changes after registration or redirects.
+// Environment proxies are ignored for the same reason.
+func publicOnlyTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || internalIP(ip) {
+				return fmt.Errorf("webhook destination %s: %w", host, errInternalDestination)
+			}
+			return nil
+		},
+	}
+	return &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     90 * time.Second,
+	}
+}
+
+// checkDestination resolves rawURL's host and rejects it when any of its
+// addresses is internal.
+func (r *WebhookRegistry) checkDestination(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("url must be http or https")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := r.lookupIP(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("url host %q does not resolve", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if internalIP(addr.IP) {
+			return errInternalDestination
+		}
+	}
+	return nil
+}
+
+func pow5(n int) int {
+	p := 1
+	for i := 0; i < n; i++ {
+		p *= 5
+	}
+	return p
+}
+
+// Register validates and stores w, assigning its ID.
+func (r *WebhookRegistry) Register(w Webhook) (*Webhook, error) {
+	if len(w.Events) == 0 {
+		return nil, fmt.Errorf("at least one event is required")
+	}
+	for _, e := range w.Events {
+		if !webhookEvents[e] {
+			return nil, fmt.Errorf("unknown event %q", e)
+		}
+	}
+	if w.RetryCount < 0 || w.RetryCount > MaxWebhookRetries {
+		return nil, fmt.Errorf("retry_count must be between 0 and %d", MaxWebhookRetries)
+	}
+	if err := r.checkDestination(w.URL); err != nil {
+		return nil, err
+	}
+	w.ID = newWebhookID()
+	r.webhooks.Store(w.ID, &w)
+	return &w, nil
+}
+
+// Unregister removes a webhook, reporting whether it existed.
+func (r *WebhookRegistry) Unregister(id string) bool {
+	_, ok := r.webhooks.LoadAndDelete(id)
+	return ok
+}
+
+// List returns all webhooks ordered by URL.
+func (r *WebhookRegistry) List() []*Webhook {
+	webhooks := []*Webhook{}
+	r.webhooks.Range(func(_, value any) bool {
+		webhooks = append(webhooks, value.(*Webhook))
+		return true
+	})
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].URL < webhooks[j].URL })
+	return webhooks
+}
+
+// Notify delivers event to every webhook subscribed to its type. Deliveries
+// and their retries run in the background.
+func (r *WebhookRegistry) Notify(event OrderEvent) {
+	if r == nil {
+		return
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal %s event: %v\n", event.Type, err)
+		return
+	}
+	r.webhooks.Range(func(_, value any) bool {
+		if w := value.(*Webhook); w.subscribes(event.Type) {
+			go r.deliver(w, event, body)
+		}
+		return true
+	})
+}
+
+func (r *WebhookRegistry) deliver(w *Webhook, event OrderEvent, body []byte) {
+	for attempt := 0; ; attempt++ {
+		err := r.post(w, body)
+		if err == nil {
+			return
+		}
+		if attempt >= w.RetryCount {
+			log.Printf("ERROR: Webhook %s gave up on %s for order %s after %d attempts: %v\n", w.ID, event.Type, event.Order.OrderID, attempt+1, err)
+			return
+		}
+		log.Printf("WARNING: Webhook %s delivery failed, retrying: %v\n", w.ID, err)
+		time.Sleep(r.backoff(attempt))
+	}
+}
+
+func (r *WebhookRegistry) post(w *Webhook, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookSignatureHeader, "sha256="+Sign(w.Secret, body))
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the hex HMAC-SHA256 of body keyed by secret. Receivers verify
+// X-Webhook-Signature by recomputing it over the raw request body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newWebhookID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,188 @@
+package orders
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver is an httptest.Server that records deliveries, answering
+// the first `failures` of them with 500.
+type webhookReceiver struct {
+	*httptest.Server
+	mu         sync.Mutex
+	failures   int
+	attempts   int
+	events     []OrderEvent
+	signatures []string
+	bodies     [][]byte
+	delivered  chan struct{}
+}
+
+func newWebhookReceiver(t *testing.T, failures int) *webhookReceiver {
+	rcv := &webhookReceiver{failures: failures, delivered: make(chan struct{}, 10)}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rcv.mu.Lock()
+		defer rcv.mu.Unlock()
+		rcv.attempts++
+		if rcv.attempts <= rcv.failures {
+			w.WriteHeader(http.StatusInternalServerError)
+			rcv.delivered <- struct{}{}
+			return
+		}
+		var event OrderEvent
+		json.Unmarshal(body, &event)
+		rcv.events = append(rcv.events, event)
+		rcv.signatures = append(rcv.signatures, r.Header.Get(WebhookSignatureHeader))
+		rcv.bodies = append(rcv.bodies, body)
+		rcv.delivered <- struct{}{}
+	}))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+// newTestWebhookRegistry delivers to rcv without the public-address checks
+// and retries without waiting.
+func newTestWebhookRegistry(rcv *webhookReceiver) *WebhookRegistry {
+	r := NewWebhookRegistry()
+	r.client = rcv.Client()
+	r.backoff = func(int) time.Duration { return 0 }
+	r.lookupIP = func(context.Context, string) ([]net.IPAddr, error) {
+		return []net.IPAddr{{IP: net.ParseIP("203.0.113.10")}}, nil
+	}
+	return r
+}
+
+func waitForDeliveries(t *testing.T, rcv *webhookReceiver, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-rcv.delivered:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %d of %d deliveries", i, n)
+		}
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	const secret = "0123456789abcdef"
+	tests := []struct {
+		name         string
+		events       []string
+		retryCount   int
+		failures     int
+		notify       string
+		wantAttempts int
+		wantEvents   int
+	}{
+		{"subscribed event", []string{EventOrderCreated}, 0, 0, EventOrderCreated, 1, 1},
+		{"retried until delivered", []string{EventOrderCreated}, 3, 2, EventOrderCreated, 3, 1},
+		{"gives up after the retries", []string{EventOrderFailed}, 2, 5, EventOrderFailed, 3, 0},
+		{"no retries", []string{EventOrderCompleted}, 0, 1, EventOrderCompleted, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rcv := newWebhookReceiver(t, tt.failures)
+			r := newTestWebhookRegistry(rcv)
+			if _, err := r.Register(Webhook{URL: rcv.URL, Secret: secret, Events: tt.events, RetryCount: tt.retryCount}); err != nil {
+				t.Fatal(err)
+			}
+			r.Notify(OrderEvent{Type: tt.notify, Order: testOrder("order-1")})
+			waitForDeliveries(t, rcv, tt.wantAttempts)
+
+			rcv.mu.Lock()
+			defer rcv.mu.Unlock()
+			if rcv.attempts != tt.wantAttempts || len(rcv.events) != tt.wantEvents {
+				t.Fatalf("%d attempts, %d delivered, want %d and %d", rcv.attempts, len(rcv.events), tt.wantAttempts, tt.wantEvents)
+			}
+			for i, event := range rcv.events {
+				if event.Type != tt.notify || event.Order.OrderID != "order-1" || event.Timestamp.IsZero() {
+					t.Errorf("delivered %+v", event)
+				}
+				if want := "sha256=" + Sign(secret, rcv.bodies[i]); rcv.signatures[i] != want {
+					t.Errorf("signature = %q, want %q", rcv.signatures[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookOnlyGetsSubscribedEvents(t *testing.T) {
+	rcv := newWebhookReceiver(t, 0)
+	r := newTestWebhookRegistry(rcv)
+	if _, err := r.Register(Webhook{URL: rcv.URL, Secret: "0123456789abcdef", Events: []string{EventOrderCompleted}}); err != nil {
+		t.Fatal(err)
+	}
+	r.Notify(OrderEvent{Type: EventOrderCreated, Order: testOrder("order-1")})
+	r.Notify(OrderEvent{Type: EventOrderCompleted, Order: testOrder("order-2")})
+	waitForDeliveries(t, rcv, 1)
+	// Give a wrongly delivered created event time to arrive
+	time.Sleep(50 * time.Millisecond)
+
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	if len(rcv.events) != 1 || rcv.events[0].Order.OrderID != "order-2" {
+		t.Errorf("delivered %+v, want only order-2's completion", rcv.events)
+	}
+}
+
+func TestWebhookRegister(t *testing.T) {
+	public := func(context.Context, string) ([]net.IPAddr, error) {
+		return []net.IPAddr{{IP: net.ParseIP("203.0.113.10")}}, nil
+	}
+	tests := []struct {
+		name     string
+		webhook  Webhook
+		lookupIP func(context.Context, string) ([]net.IPAddr, error)
+		wantErr  bool
+		// internal is set when the error must be errInternalDestination
+		internal bool
+	}{
+		{"public", Webhook{URL: "https://partner.example/hook", Events: []string{EventOrderCreated}}, public, false, false},
+		{"loopback", Webhook{URL: "http://127.0.0.1:8080/hook", Events: []string{EventOrderCreated}}, net.DefaultResolver.LookupIPAddr, true, true},
+		{"metadata service", Webhook{URL: "http://169.254.169.254/latest", Events: []string{EventOrderCreated}}, net.DefaultResolver.LookupIPAddr, true, true},
+		{"private", Webhook{URL: "http://10.1.2.3/hook", Events: []string{EventOrderCreated}}, net.DefaultResolver.LookupIPAddr, true, true},
+		{"resolves to a private address", Webhook{URL: "https://partner.example/hook", Events: []string{EventOrderCreated}}, func(context.Context, string) ([]net.IPAddr, error) {
+			return []net.IPAddr{{IP: net.ParseIP("203.0.113.10")}, {IP: net.ParseIP("192.168.0.5")}}, nil
+		}, true, true},
+		{"no events", Webhook{URL: "https://partner.example/hook"}, public, true, false},
+		{"unknown event", Webhook{URL: "https://partner.example/hook", Events: []string{"order.shipped"}}, public, true, false},
+		{"too many retries", Webhook{URL: "https://partner.example/hook", Events: []string{EventOrderCreated}, RetryCount: 4}, public, true, false},
+		{"not http", Webhook{URL: "ftp://partner.example/hook", Events: []string{EventOrderCreated}}, public, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewWebhookRegistry()
+			r.lookupIP = tt.lookupIP
+			w, err := r.Register(tt.webhook)
+			if (err != nil) != tt.wantErr || (tt.internal && !errors.Is(err, errInternalDestination)) {
+				t.Fatalf("err = %v, wantErr %v internal %v", err, tt.wantErr, tt.internal)
+			}
+			if err == nil {
+				if w.ID == "" || len(r.List()) != 1 || !r.Unregister(w.ID) || r.Unregister(w.ID) {
+					t.Error("registered webhook is not listed or unregistered once")
+				}
+			} else if len(r.List()) != 0 {
+				t.Error("rejected webhook was stored")
+			}
+		})
+	}
+}
+
+func TestWebhookTransportRefusesInternalAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	r := NewWebhookRegistry()
+	err := r.post(&Webhook{URL: srv.URL, Secret: "0123456789abcdef"}, []byte("{}"))
+	if !errors.Is(err, errInternalDestination) {
+		t.Errorf("post to %s: err = %v, want errInternalDestination", srv.URL, err)
+	}
+}
@@ -0,0 +1,124 @@
+package currency
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Base is the currency all stored prices are expressed in.
+const Base = "USD"
+
+// ErrUnsupportedCurrency is returned when no exchange rate is known for a currency code.
+var ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+// Converter converts USD amounts using rates expressed as units of the target
+// currency per USD (e.g. {"EUR": 0.92}). It is safe for concurrent use.
+type Converter struct {
+	mu    sync.RWMutex
+	rates map[string]float64
+}
+
+func NewConverter(rates map[string]float64) *Converter {
+	c := &Converter{}
+	c.SetRates(rates)
+	return c
+}
+
+// ParseRates decodes an EXCHANGE_RATES_JSON value such as {"EUR":1.08,"GBP":0.79}.
+func ParseRates(raw string) (map[string]float64, error) {
+	rates := map[string]float64{}
+	if strings.TrimSpace(raw) == "" {
+		return rates, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &rates); err != nil {
+		return nil, fmt.Errorf("invalid exchange rates: %w", err)
+	}
+	for code, rate := range rates {
+		if rate <= 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+			return nil, fmt.Errorf("invalid exchange rate for %s: %v", code, rate)
+		}
+	}
+	return rates, nil
+}
+
+// SetRates replaces the known rates. Codes are case-insensitive.
+func (c *Converter) SetRates(rates map[string]float64) {
+	normalized := make(map[string]float64, len(rates)+1)
+	for code, rate := range rates {
+		normalized[strings.ToUpper(code)] = rate
+	}
+	normalized[Base] = 1
+
+	c.mu.Lock()
+	c.rates = normalized
+	c.mu.Unlock()
+}
+
+// Convert converts a USD amount into code, rounded to the nearest cent.
+func (c *Converter) Convert(amountUSD float64, code string) (float64, error) {
+	c.mu.RLock()
+	rate, ok := c.rates[strings.ToUpper(code)]
+	c.mu.RUnlock()
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedCurrency, code)
+	}
+	return math.Round(amountUSD*rate*100) / 100, nil
+}
+
+// RefreshEvery fetches rates from url on every tick, keeping the previous
+// rates when a fetch fails. The endpoint must return a JSON object of rates.
+func (c *Converter) RefreshEvery(url string, interval time.Duration) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := c.refresh(client, url); err != nil {
+				log.Printf("ERROR: Failed to refresh exchange rates: %v\n", err)
+			}
+		}
+	}()
+}
+
+func (c *Converter) refresh(client *http.Client, url string) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	var rates map[string]float64
+	if err := json.NewDecoder(resp.Body).Decode(&rates); err != nil {
+		return err
+	}
+	c.SetRates(rates)
+	return nil
+}
+
+var (
+	defaultMu        sync.RWMutex
+	defaultConverter = NewConverter(nil)
+)
+
+// Default returns the process-wide converter (USD only until SetDefault is called).
+func Default() *Converter {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultConverter
+}
+
+// SetDefault installs the process-wide converter.
+func SetDefault(c *Converter) {
+	defaultMu.Lock()
+	defaultConverter = c
+	defaultMu.Unlock()
+}
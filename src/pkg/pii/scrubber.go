@@ -0,0 +1,97 @@
+package pii
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Redacted replaces the value of every scrubbed field.
+const Redacted = "[REDACTED]"
+
+// DefaultFields is used when SCRUB_FIELDS is unset.
+var DefaultFields = []string{"customer_id", "email", "address"}
+
+// ParseFields reads a SCRUB_FIELDS value such as "customer_id,email,address".
+// An empty value yields DefaultFields.
+func ParseFields(raw string) []string {
+	var fields []string
+	for _, f := range strings.Split(raw, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) == 0 {
+		return DefaultFields
+	}
+	return fields
+}
+
+// Scrubber redacts the values of a fixed set of keys (case-insensitive) at
+// any depth of a decoded JSON document.
+type Scrubber struct {
+	fields map[string]struct{}
+}
+
+func NewScrubber(fields []string) *Scrubber {
+	s := &Scrubber{fields: make(map[string]struct{}, len(fields))}
+	for _, f := range fields {
+		s.fields[strings.ToLower(f)] = struct{}{}
+	}
+	return s
+}
+
+// Scrub redacts matching keys in place and returns v. Nested objects and
+// arrays are walked; a matching key is redacted whatever its value type.
+func (s *Scrubber) Scrub(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			if _, ok := s.fields[strings.ToLower(k)]; ok {
+				t[k] = Redacted
+				continue
+			}
+			t[k] = s.Scrub(child)
+		}
+	case []interface{}:
+		for i, child := range t {
+			t[i] = s.Scrub(child)
+		}
+	}
+	return v
+}
+
+// ScrubJSON returns raw with the given fields redacted. Numbers are kept
+// verbatim. Bodies that are not valid JSON are replaced entirely, since they
+// cannot be inspected.
+func ScrubJSON(raw []byte, fields []string) []byte {
+	return NewScrubber(fields).ScrubJSON(raw)
+}
+
+func (s *Scrubber) ScrubJSON(raw []byte) []byte {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return raw
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return []byte(`"` + Redacted + `"`)
+	}
+	out, err := json.Marshal(s.Scrub(doc))
+	if err != nil {
+		return []byte(`"` + Redacted + `"`)
+	}
+	return out
+}
+
+// Mask formats v for logging, keeping only its last 4 characters
+// (e.g. 67890 -> "****7890").
+func Mask(v interface{}) string {
+	s := fmt.Sprint(v)
+	if len(s) <= 4 {
+		return "****"
+	}
+	return "****" + s[len(s)-4:]
+}
@@ -0,0 +1,214 @@
+package product
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultExperiment compares same-category against same-brand recommendations.
+	DefaultExperiment = "recommendations"
+	// RecommendationLimit is how many products an algorithm returns.
+	RecommendationLimit = 5
+	// recommendationScan bounds how many products an algorithm inspects.
+	recommendationScan = 1000
+	// impressionLogSize is the capacity of each experiment's ring buffer.
+	impressionLogSize = 10000
+)
+
+// Variant names.
+const (
+	VariantA = "A"
+	VariantB = "B"
+)
+
+// Algorithm returns up to limit products to recommend alongside productID.
+type Algorithm func(ctx context.Context, productID int32, limit int) []Product
+
+// Impression records one set of recommendations shown to a customer.
+type Impression struct {
+	Experiment      string    `json:"experiment"`
+	Variant         string    `json:"variant"`
+	ProductID       int32     `json:"product_id"`
+	Recommendations []int32   `json:"recommendations"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// VariantResult summarises one arm of an experiment.
+type VariantResult struct {
+	Variant     string  `json:"variant"`
+	Impressions int64   `json:"impressions"`
+	Clicks      int64   `json:"clicks"`
+	CTR         float64 `json:"ctr"`
+}
+
+// ExperimentResults is returned by GET /admin/ab-tests/:name/results.
+type ExperimentResults struct {
+	Experiment   string          `json:"experiment"`
+	TrafficSplit float64         `json:"traffic_split"`
+	Variants     []VariantResult `json:"variants"`
+	// Recent holds the latest impressions, oldest first.
+	Recent []Impression `json:"recent,omitempty"`
+}
+
+// Experiment splits customers between two algorithms. TrafficSplit is the
+// fraction of customers assigned to variant B.
+type Experiment struct {
+	Name         string
+	VariantA     Algorithm
+	VariantB     Algorithm
+	TrafficSplit float64
+
+	mu          sync.Mutex
+	impressions map[string]int64
+	clicks      map[string]int64
+	log         []Impression
+	next        int
+}
+
+// Variant deterministically assigns a customer to A or B.
+func (e *Experiment) Variant(customerID int) string {
+	h := fnv.New32a()
+	h.Write([]byte(strconv.Itoa(customerID) + e.Name))
+	if float64(h.Sum32()%10000) < e.TrafficSplit*10000 {
+		return VariantB
+	}
+	return VariantA
+}
+
+// Recommend runs the customer's variant and records the impression.
+func (e *Experiment) Recommend(ctx context.Context, productID int32, customerID int) []Product {
+	variant := e.Variant(customerID)
+	algorithm := e.VariantA
+	if variant == VariantB {
+		algorithm = e.VariantB
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	products := algorithm(ctx, productID, RecommendationLimit)
+
+	ids := make([]int32, len(products))
+	for i, p := range products {
+		ids[i] = p.ID
+	}
+	e.record(Impression{Experiment: e.Name, Variant: variant, ProductID: productID, Recommendations: ids, Timestamp: time.Now().UTC()})
+	return products
+}
+
+func (e *Experiment) record(imp Impression) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.impressions[imp.Variant]++
+	if len(e.log) < impressionLogSize {
+		e.log = append(e.log, imp)
+		return
+	}
+	e.log[e.next] = imp
+	e.next = (e.next + 1) % impressionLogSize
+}
+
+// RecordClick attributes a click to the customer's variant.
+func (e *Experiment) RecordClick(customerID int) string {
+	variant := e.Variant(customerID)
+	e.mu.Lock()
+	e.clicks[variant]++
+	e.mu.Unlock()
+	return variant
+}
+
+// Results reports per-variant click-through rates and up to recent of the
+// latest impressions.
+func (e *Experiment) Results(recent int) ExperimentResults {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	res := ExperimentResults{Experiment: e.Name, TrafficSplit: e.TrafficSplit}
+	for _, v := range []string{VariantA, VariantB} {
+		r := VariantResult{Variant: v, Impressions: e.impressions[v], Clicks: e.clicks[v]}
+		if r.Impressions > 0 {
+			r.CTR = float64(r.Clicks) / float64(r.Impressions)
+		}
+		res.Variants = append(res.Variants, r)
+	}
+	// Unroll the ring so the newest impressions come last
+	ordered := append(append([]Impression(nil), e.log[e.next:]...), e.log[:e.next]...)
+	if recent > len(ordered) {
+		recent = len(ordered)
+	}
+	if recent > 0 {
+		res.Recent = ordered[len(ordered)-recent:]
+	}
+	return res
+}
+
+// ABTestManager holds the named experiments.
+type ABTestManager struct {
+	mu          sync.RWMutex
+	experiments map[string]*Experiment
+}
+
+func NewABTestManager() *ABTestManager {
+	return &ABTestManager{experiments: make(map[string]*Experiment)}
+}
+
+// Add registers an experiment, replacing any with the same name.
+func (m *ABTestManager) Add(name string, a, b Algorithm, trafficSplit float64) (*Experiment, error) {
+	if trafficSplit < 0 || trafficSplit > 1 {
+		return nil, fmt.Errorf("traffic split must be between 0 and 1, got %v", trafficSplit)
+	}
+	e := &Experiment{
+		Name: name, VariantA: a, VariantB: b, TrafficSplit: trafficSplit,
+		impressions: make(map[string]int64), clicks: make(map[string]int64),
+	}
+	m.mu.Lock()
+	m.experiments[name] = e
+	m.mu.Unlock()
+	return e, nil
+}
+
+func (m *ABTestManager) Experiment(name string) (*Experiment, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.experiments[name]
+	return e, ok
+}
+
+// SameCategory recommends other products in the product's category.
+func (s *Store) SameCategory() Algorithm {
+	return s.similarBy(func(a, b Product) bool { return a.Category != "" && a.Category == b.Category })
+}
+
+// SameBrand recommends other products from the product's brand.
+func (s *Store) SameBrand() Algorithm {
+	return s.similarBy(func(a, b Product) bool { return a.Brand != "" && a.Brand == b.Brand })
+}
+
+// similarBy scans forward from productID (wrapping around) so neighbours
+// differ per product, inspecting at most recommendationScan products.
+func (s *Store) similarBy(match func(a, b Product) bool) Algorithm {
+	return func(ctx context.Context, productID int32, limit int) []Product {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		source, ok := s.products[productID]
+		if !ok || len(s.sortedKeys) == 0 {
+			return nil
+		}
+		start := sort.Search(len(s.sortedKeys), func(i int) bool { return s.sortedKeys[i] >= productID })
+		out := make([]Product, 0, limit)
+		for i := 0; i < len(s.sortedKeys) && i < recommendationScan && len(out) < limit; i++ {
+			id := s.sortedKeys[(start+i)%len(s.sortedKeys)]
+			if id == productID {
+				continue
+			}
+			if p := s.products[id]; match(source, p) {
+				out = append(out, p)
+			}
+		}
+		return out
+	}
+}
@@ -0,0 +1,212 @@
+package product
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	analyticsWindow  = 24 * time.Hour
+	analyticsBuckets = 24 // one bucket per hour of the window
+	// DefaultMaxTrackedQueries bounds how many distinct queries are tracked.
+	DefaultMaxTrackedQueries = 10000
+)
+
+// SearchEntry is a normalized query and how often it was searched in the last 24 hours.
+type SearchEntry struct {
+	Name     string    `json:"name"`
+	Category string    `json:"category"`
+	Count    int64     `json:"count"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// queryStats keeps hourly counts in a ring buffer covering analyticsWindow.
+// Each bucket packs the hour it holds (unix/3600) into the high 32 bits and
+// that hour's count into the low 32, so it is updated with a single CAS.
+type queryStats struct {
+	name, category string
+	buckets        [analyticsBuckets]atomic.Uint64
+	lastSeen       atomic.Int64 // unix nanoseconds
+}
+
+func (q *queryStats) add(now time.Time) {
+	hour := uint64(now.Unix() / 3600)
+	b := &q.buckets[hour%analyticsBuckets]
+	for {
+		old := b.Load()
+		next := hour<<32 | 1
+		if old>>32 == hour {
+			next = old + 1
+		}
+		if b.CompareAndSwap(old, next) {
+			break
+		}
+	}
+	q.lastSeen.Store(now.UnixNano())
+}
+
+func (q *queryStats) total(now time.Time) int64 {
+	oldest := now.Unix()/3600 - analyticsBuckets + 1
+	var sum int64
+	for i := range q.buckets {
+		if v := q.buckets[i].Load(); int64(v>>32) >= oldest {
+			sum += int64(v & 0xffffffff)
+		}
+	}
+	return sum
+}
+
+// SearchAnalytics counts searches per normalized name+category query over a
+// sliding 24 hour window. Recording is lock-free so it stays off the search
+// path's critical section. Queries not seen for 24 hours are evicted, and
+// once more than maxQueries are tracked the least recently seen are too.
+type SearchAnalytics struct {
+	queries    sync.Map // key -> *queryStats
+	size       atomic.Int64
+	maxQueries int64
+	// evicting lets one Record at a time trim the map
+	evicting sync.Mutex
+	now      func() time.Time
+}
+
+func NewSearchAnalytics() *SearchAnalytics {
+	return &SearchAnalytics{maxQueries: DefaultMaxTrackedQueries, now: time.Now}
+}
+
+// Record counts one search. Searches without any filter are not recorded.
+func (a *SearchAnalytics) Record(nameFilter, categoryFilter string) {
+	name := strings.ToLower(strings.TrimSpace(nameFilter))
+	category := strings.ToLower(strings.TrimSpace(categoryFilter))
+	if name == "" && category == "" {
+		return
+	}
+	key := name + "\x00" + category
+
+	now := a.now()
+	value, ok := a.queries.Load(key)
+	if !ok {
+		fresh := &queryStats{name: name, category: category}
+		fresh.lastSeen.Store(now.UnixNano())
+		var loaded bool
+		value, loaded = a.queries.LoadOrStore(key, fresh)
+		if !loaded && a.size.Add(1) > a.maxQueries && a.evicting.TryLock() {
+			a.evict(now)
+			a.evicting.Unlock()
+		}
+	}
+	value.(*queryStats).add(now)
+}
+
+// Top returns up to limit queries ordered by 24 hour count (descending).
+func (a *SearchAnalytics) Top(limit int) []SearchEntry {
+	now := a.now()
+	entries := []SearchEntry{}
+	a.queries.Range(func(key, value any) bool {
+		q := value.(*queryStats)
+		lastSeen := time.Unix(0, q.lastSeen.Load())
+		if now.Sub(lastSeen) > analyticsWindow {
+			a.remove(key, value)
+		} else if count := q.total(now); count > 0 {
+			entries = append(entries, SearchEntry{Name: q.name, Category: q.category, Count: count, LastSeen: lastSeen})
+		}
+		return true
+	})
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		if entries[i].Name != entries[j].Name {
+			return entries[i].Name < entries[j].Name
+		}
+		return entries[i].Category < entries[j].Category
+	})
+	if limit >= 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries
+}
+
+// Reset clears all recorded searches.
+func (a *SearchAnalytics) Reset() {
+	a.queries.Range(func(key, value any) bool {
+		a.remove(key, value)
+		return true
+	})
+}
+
+func (a *SearchAnalytics) remove(key, value any) {
+	if a.queries.CompareAndDelete(key, value) {
+		a.size.Add(-1)
+	}
+}
+
+// evict drops queries not seen within the window and, if that is not
+// enough, the least recently seen ones until a tenth of maxQueries is free.
+// A search racing with the removal of its query may go uncounted.
+func (a *SearchAnalytics) evict(now time.Time) {
+	type seen struct {
+		key, value any
+		lastSeen   int64
+	}
+	var live []seen
+	cutoff := now.Add(-analyticsWindow).UnixNano()
+	a.queries.Range(func(key, value any) bool {
+		if last := value.(*queryStats).lastSeen.Load(); last < cutoff {
+			a.remove(key, value)
+		} else {
+			live = append(live, seen{key, value, last})
+		}
+		return true
+	})
+	// Queries added while this ran are left for the next eviction
+	excess := len(live) - int(a.maxQueries-a.maxQueries/10)
+	if excess <= 0 {
+		return
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].lastSeen < live[j].lastSeen })
+	for _, q := range live[:excess] {
+		a.remove(q.key, q.value)
+	}
+}
+
+// PersistEvery writes the current top searches to path as JSON on every tick.
+// The file is replaced atomically so readers never see a partial write.
+func (a *SearchAnalytics) PersistEvery(path string, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := a.writeFile(path); err != nil {
+				log.Printf("ERROR: Failed to persist search analytics: %v\n", err)
+			}
+		}
+	}()
+}
+
+func (a *SearchAnalytics) writeFile(path string) error {
+	data, err := json.Marshal(a.Top(-1))
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".analytics-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,115 @@
+package product
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidBundle is wrapped by bundle validation failures.
+var ErrInvalidBundle = errors.New("invalid bundle")
+
+// BundleStore provides concurrent-safe in-memory storage for bundles.
+// It is embedded in Store so bundles share the product catalog's lifetime.
+type BundleStore struct {
+	mu           sync.RWMutex
+	bundles      map[int32]Bundle
+	nextBundleID int32
+}
+
+func newBundleStore() BundleStore {
+	return BundleStore{bundles: make(map[int32]Bundle), nextBundleID: 1}
+}
+
+func (b *BundleStore) CreateBundle(incoming Bundle) Bundle {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	incoming.ID = b.nextBundleID
+	b.nextBundleID++
+	b.bundles[incoming.ID] = incoming
+	return incoming
+}
+
+func (b *BundleStore) GetBundle(id int32) (Bundle, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	bundle, ok := b.bundles[id]
+	return bundle, ok
+}
+
+// ListBundles returns all bundles ordered by ID.
+func (b *BundleStore) ListBundles() []Bundle {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	bundles := make([]Bundle, 0, len(b.bundles))
+	for _, bundle := range b.bundles {
+		bundles = append(bundles, bundle)
+	}
+	sort.Slice(bundles, func(i, j int) bool { return bundles[i].ID < bundles[j].ID })
+	return bundles
+}
+
+// normalizeBundle validates a bundle against the catalog and fills in a
+// quantity of 1 for components without an explicit quantity.
+func (s *Store) normalizeBundle(b Bundle) (Bundle, error) {
+	if strings.TrimSpace(b.Name) == "" {
+		return Bundle{}, fmt.Errorf("%w: name is required", ErrInvalidBundle)
+	}
+	if len(b.ComponentIDs) == 0 {
+		return Bundle{}, fmt.Errorf("%w: at least one component is required", ErrInvalidBundle)
+	}
+	if b.BundlePrice < 0 || math.IsInf(b.BundlePrice, 0) || math.IsNaN(b.BundlePrice) {
+		return Bundle{}, fmt.Errorf("%w: bundle_price must be non-negative", ErrInvalidBundle)
+	}
+
+	quantities := make(map[int32]int, len(b.ComponentIDs))
+	for _, id := range b.ComponentIDs {
+		if _, dup := quantities[id]; dup {
+			return Bundle{}, fmt.Errorf("%w: duplicate component %d", ErrInvalidBundle, id)
+		}
+		if _, ok := s.Get(id); !ok {
+			return Bundle{}, fmt.Errorf("%w: product %d not found", ErrInvalidBundle, id)
+		}
+		qty, ok := b.Quantities[id]
+		if !ok {
+			qty = 1
+		}
+		if qty < 1 {
+			return Bundle{}, fmt.Errorf("%w: quantity for product %d must be at least 1", ErrInvalidBundle, id)
+		}
+		quantities[id] = qty
+	}
+	for id := range b.Quantities {
+		if _, ok := quantities[id]; !ok {
+			return Bundle{}, fmt.Errorf("%w: quantities reference products that are not components", ErrInvalidBundle)
+		}
+	}
+
+	b.ComponentIDs = append([]int32(nil), b.ComponentIDs...)
+	b.Quantities = quantities
+	return b, nil
+}
+
+// CreateValidatedBundle validates the bundle against the catalog and stores it.
+func (s *Store) CreateValidatedBundle(b Bundle) (Bundle, error) {
+	normalized, err := s.normalizeBundle(b)
+	if err != nil {
+		return Bundle{}, err
+	}
+	return s.CreateBundle(normalized), nil
+}
+
+// ComponentTotal sums the current catalog price of every component times its
+// quantity. Components that no longer exist are skipped.
+func (s *Store) ComponentTotal(b Bundle) float64 {
+	total := 0.0
+	for _, id := range b.ComponentIDs {
+		if p, ok := s.Get(id); ok {
+			total += p.Price * float64(b.Quantities[id])
+		}
+	}
+	return math.Round(total*100) / 100
+}
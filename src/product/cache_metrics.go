@@ -0,0 +1,42 @@
+package product
+
+import "sync/atomic"
+
+// CacheMetrics counts lookups in the similar-products cache. Evictions
+// counts entries dropped when the cache is cleared.
+type CacheMetrics struct {
+	Hits      atomic.Int64
+	Misses    atomic.Int64
+	Evictions atomic.Int64
+}
+
+// CacheStats is returned by GET /admin/products/cache-stats.
+type CacheStats struct {
+	Hits      int64   `json:"hits"`
+	Misses    int64   `json:"misses"`
+	Evictions int64   `json:"evictions"`
+	HitRate   float64 `json:"hit_rate"`
+	// CacheSize is the number of products whose similar products are cached.
+	CacheSize int `json:"cache_size"`
+}
+
+// CacheHitRate is the fraction of similar-product lookups answered from the
+// cache, or 0 before any lookups.
+func (s *Store) CacheHitRate() float64 {
+	hits, misses := s.similar.metrics.Hits.Load(), s.similar.metrics.Misses.Load()
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// CacheStats reports the similar-products cache's counters and size.
+func (s *Store) CacheStats() CacheStats {
+	return CacheStats{
+		Hits:      s.similar.metrics.Hits.Load(),
+		Misses:    s.similar.metrics.Misses.Load(),
+		Evictions: s.similar.metrics.Evictions.Load(),
+		HitRate:   s.CacheHitRate(),
+		CacheSize: s.similar.size(),
+	}
+}
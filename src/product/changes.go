@@ -0,0 +1,147 @@
+package product
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"time"
+)
+
+// changeCompactMin is the change log length below which it is never compacted.
+const changeCompactMin = 1024
+
+// ErrChangesExpired is returned by GetChangedSince for times before the
+// change history starts (the last rebuild or server start).
+var ErrChangesExpired = errors.New("changes before the last catalog rebuild are not available")
+
+// ChangedProduct is an entry in the change feed. Deleted products carry
+// their last known state.
+type ChangedProduct struct {
+	Product
+	Deleted bool `json:"deleted"`
+}
+
+// ChangedProductV1 is the v1 view of a change feed entry.
+type ChangedProductV1 struct {
+	ProductV1
+	Deleted bool `json:"deleted"`
+}
+
+// V1 converts a change feed entry to its v1 view.
+func (c ChangedProduct) V1() ChangedProductV1 {
+	return ChangedProductV1{ProductV1: c.Product.V1(), Deleted: c.Deleted}
+}
+
+type changeEntry struct {
+	id int32
+	at time.Time
+	// tombstone is the product as it was when deleted; nil otherwise
+	tombstone *Product
+}
+
+// changeLog records which products changed when, in ascending time order,
+// so changes since a point in time are a binary search away. It is guarded
+// by Store.mu.
+type changeLog struct {
+	entries []changeEntry
+	// start is when the history begins; earlier changes were replaced by a rebuild
+	start time.Time
+	// compactAt is the length at which entries is next compacted
+	compactAt int
+}
+
+// reset discards the history, which now starts at at.
+func (l *changeLog) reset(at time.Time) {
+	l.entries = nil
+	l.start = at
+	l.compactAt = 0
+}
+
+// latest is the time of the most recent change, or the start of the history
+// when nothing has changed since.
+func (l *changeLog) latest() time.Time {
+	if n := len(l.entries); n > 0 {
+		return l.entries[n-1].at
+	}
+	return l.start
+}
+
+// next returns a change time later than every one already issued, so a
+// clock step backwards cannot hide a change from the feed.
+func (l *changeLog) next() time.Time {
+	now := time.Now().UTC()
+	if last := l.latest(); !now.After(last) {
+		now = last.Add(time.Nanosecond)
+	}
+	return now
+}
+
+func (l *changeLog) record(id int32, at time.Time, tombstone *Product) {
+	l.entries = append(l.entries, changeEntry{id: id, at: at, tombstone: tombstone})
+	if len(l.entries) >= max(changeCompactMin, l.compactAt) {
+		l.compact()
+	}
+}
+
+// compact keeps only the latest entry for each product.
+func (l *changeLog) compact() {
+	seen := make(map[int32]bool, len(l.entries))
+	kept := make([]changeEntry, 0, len(l.entries))
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		if e := l.entries[i]; !seen[e.id] {
+			seen[e.id] = true
+			kept = append(kept, e)
+		}
+	}
+	slices.Reverse(kept)
+	l.entries = kept
+	l.compactAt = 2 * len(kept)
+}
+
+// touch stamps p with a new UpdatedAt and records the change. Callers must
+// hold the write lock.
+func (s *Store) touch(p Product) Product {
+	p.UpdatedAt = s.changes.next()
+	s.changes.record(p.ID, p.UpdatedAt, nil)
+	return p
+}
+
+// touchDeleted records that p was deleted. Callers must hold the write lock.
+func (s *Store) touchDeleted(p Product) {
+	p.UpdatedAt = s.changes.next()
+	s.changes.record(p.ID, p.UpdatedAt, &p)
+}
+
+// GetChangedSince returns the products created, updated or deleted after
+// since, oldest change first, each in its current (or, if deleted, last)
+// state. The returned sync token is the time of the latest change; passing
+// it back as since returns only later changes. Stock movements are not
+// changes. It returns ErrChangesExpired if since predates the history.
+func (s *Store) GetChangedSince(since time.Time) ([]ChangedProduct, time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if since.Before(s.changes.start) {
+		return nil, time.Time{}, ErrChangesExpired
+	}
+
+	entries := s.changes.entries
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].at.After(since) })
+	entries = entries[i:]
+	// A product changed several times is reported once, at its latest change
+	last := make(map[int32]int, len(entries))
+	for i, e := range entries {
+		last[e.id] = i
+	}
+	changed := make([]ChangedProduct, 0, len(last))
+	for i, e := range entries {
+		if last[e.id] != i {
+			continue
+		}
+		if e.tombstone != nil {
+			changed = append(changed, ChangedProduct{Product: *e.tombstone, Deleted: true})
+			continue
+		}
+		changed = append(changed, ChangedProduct{Product: s.products[e.id]})
+	}
+	return changed, s.changes.latest(), nil
+}
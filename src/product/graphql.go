@@ -0,0 +1,404 @@
+package product
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"text/main/response"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+const (
+	// GraphQLMaxDepth is the deepest field nesting a query may select.
+	GraphQLMaxDepth = 5
+	// GraphQLMaxComplexity bounds the fields a query may resolve, with the
+	// fields under a list counted once per requested item.
+	GraphQLMaxComplexity = 1000
+
+	graphQLDefaultPageSize = 20
+	graphQLMaxPageSize     = 100
+	// graphQLMaxCheck bounds how many products a products query scans.
+	graphQLMaxCheck = 10000
+)
+
+// graphQLListArgs names the argument that sizes each list-returning field,
+// with its default and maximum, for complexity scoring.
+var graphQLListArgs = map[string]struct {
+	arg      string
+	def, max int
+}{
+	"products": {"pageSize", graphQLDefaultPageSize, graphQLMaxPageSize},
+	"similar":  {"limit", 10, MaxSimilarProducts},
+}
+
+// GraphQLHandlers serve read-only GraphQL queries over the product catalog.
+type GraphQLHandlers struct {
+	schema graphql.Schema
+}
+
+// GraphQLRepository is the product storage the GraphQL schema reads.
+type GraphQLRepository interface {
+	Get(id int32) (Product, bool)
+	SearchLimitedWhere(nameFilter, categoryFilter string, filter ProductFilter, where func(Product) bool, maxCheck, maxReturn int) ([]Product, int)
+	SimilarProducts(id int32, limit int) ([]Product, error)
+}
+
+func NewGraphQLHandlers(store GraphQLRepository) (*GraphQLHandlers, error) {
+	schema, err := newGraphQLSchema(store)
+	if err != nil {
+		return nil, err
+	}
+	return &GraphQLHandlers{schema: schema}, nil
+}
+
+// productConnection is one page of a products query.
+type productConnection struct {
+	Products   []Product
+	TotalFound int
+	Page       int
+	PageSize   int
+}
+
+func newGraphQLSchema(store GraphQLRepository) (graphql.Schema, error) {
+	pricingTierType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PricingTier",
+		Fields: graphql.Fields{
+			"minQuantity":     tierField(graphql.Int, func(t PricingTier) interface{} { return t.MinQuantity }),
+			"discountPercent": tierField(graphql.Float, func(t PricingTier) interface{} { return t.DiscountPercent }),
+		},
+	})
+
+	var productType *graphql.Object
+	productType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Product",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":          productField(graphql.NewNonNull(graphql.ID), func(p Product) interface{} { return strconv.Itoa(int(p.ID)) }),
+				"name":        productField(graphql.NewNonNull(graphql.String), func(p Product) interface{} { return p.Name }),
+				"slug":        productField(graphql.String, func(p Product) interface{} { return p.Slug }),
+				"category":    productField(graphql.String, func(p Product) interface{} { return p.Category }),
+				"description": productField(graphql.String, func(p Product) interface{} { return p.Description }),
+				"brand":       productField(graphql.String, func(p Product) interface{} { return p.Brand }),
+				"price":       productField(graphql.NewNonNull(graphql.Float), func(p Product) interface{} { return p.Price }),
+				"stock":       productField(graphql.NewNonNull(graphql.Int), func(p Product) interface{} { return p.Stock }),
+				"imageUrl":    productField(graphql.String, func(p Product) interface{} { return p.ImageURL }),
+				"isPreOrder":  productField(graphql.NewNonNull(graphql.Boolean), func(p Product) interface{} { return p.IsPreOrder }),
+				"updatedAt":   productField(graphql.String, func(p Product) interface{} { return p.UpdatedAt.Format(time.RFC3339Nano) }),
+				"pricingTiers": productField(graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(pricingTierType))),
+					func(p Product) interface{} { return p.PricingTiers }),
+				"similar": {
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(productType))),
+					Description: "Products with the most similar features",
+					Args: graphql.FieldConfigArgument{
+						"limit": {Type: graphql.Int, DefaultValue: 10},
+					},
+					Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+						limit, _ := params.Args["limit"].(int)
+						if limit < 1 || limit > MaxSimilarProducts {
+							return nil, fmt.Errorf("limit must be between 1 and %d", MaxSimilarProducts)
+						}
+						return store.SimilarProducts(params.Source.(Product).ID, limit)
+					},
+				},
+			}
+		}),
+	})
+
+	connectionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "ProductConnection",
+		Fields: graphql.Fields{
+			"products": connectionField(graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(productType))),
+				func(c productConnection) interface{} { return c.Products }),
+			"totalFound": connectionField(graphql.NewNonNull(graphql.Int), func(c productConnection) interface{} { return c.TotalFound }),
+			"page":       connectionField(graphql.NewNonNull(graphql.Int), func(c productConnection) interface{} { return c.Page }),
+			"pageSize":   connectionField(graphql.NewNonNull(graphql.Int), func(c productConnection) interface{} { return c.PageSize }),
+		},
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"product": {
+				Type: productType,
+				Args: graphql.FieldConfigArgument{
+					"id": {Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					id, ok := parseProductID(params.Args["id"].(string))
+					if !ok || id < 1 {
+						return nil, errors.New("invalid product id")
+					}
+					if p, found := store.Get(id); found {
+						return p, nil
+					}
+					return nil, nil
+				},
+			},
+			"products": {
+				Type:        graphql.NewNonNull(connectionType),
+				Description: fmt.Sprintf("Products matching name and category substrings (case-insensitive) among the first %d by ID", graphQLMaxCheck),
+				Args: graphql.FieldConfigArgument{
+					"name":     {Type: graphql.String},
+					"category": {Type: graphql.String},
+					"page":     {Type: graphql.Int, DefaultValue: 1},
+					"pageSize": {Type: graphql.Int, DefaultValue: graphQLDefaultPageSize},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					name, _ := params.Args["name"].(string)
+					category, _ := params.Args["category"].(string)
+					page, _ := params.Args["page"].(int)
+					pageSize, _ := params.Args["pageSize"].(int)
+					if page < 1 {
+						return nil, errors.New("page must be at least 1")
+					}
+					if pageSize < 1 || pageSize > graphQLMaxPageSize {
+						return nil, fmt.Errorf("pageSize must be between 1 and %d", graphQLMaxPageSize)
+					}
+					matches, total := store.SearchLimitedWhere(name, category, ProductFilter{}, nil, graphQLMaxCheck, page*pageSize)
+					start := min((page-1)*pageSize, len(matches))
+					return productConnection{Products: matches[start:], TotalFound: total, Page: page, PageSize: pageSize}, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+}
+
+func productField(t graphql.Output, get func(Product) interface{}) *graphql.Field {
+	return &graphql.Field{Type: t, Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		return get(params.Source.(Product)), nil
+	}}
+}
+
+func tierField(t graphql.Output, get func(PricingTier) interface{}) *graphql.Field {
+	return &graphql.Field{Type: graphql.NewNonNull(t), Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		return get(params.Source.(PricingTier)), nil
+	}}
+}
+
+func connectionField(t graphql.Output, get func(productConnection) interface{}) *graphql.Field {
+	return &graphql.Field{Type: t, Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		return get(params.Source.(productConnection)), nil
+	}}
+}
+
+// GraphQLRequest is a GraphQL query, sent as JSON to POST /graphql or as
+// query parameters (variables JSON-encoded) to GET /graphql.
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// GET /graphql and POST /graphql
+func (h *GraphQLHandlers) Query(c *gin.Context) {
+	var req GraphQLRequest
+	if c.Request.Method == http.MethodGet {
+		req.Query = c.Query("query")
+		req.OperationName = c.Query("operationName")
+		if raw := c.Query("variables"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &req.Variables); err != nil {
+				response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidJSON, "variables must be a JSON object: "+err.Error(), nil)
+				return
+			}
+		}
+	} else if err := c.ShouldBindJSON(&req); err != nil {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidJSON, "invalid JSON body: "+err.Error(), nil)
+		return
+	}
+	if req.Query == "" {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "query is required", nil)
+		return
+	}
+
+	// Limits are checked before execution so an expensive query never runs
+	doc, err := parser.Parse(parser.ParseParams{Source: req.Query})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+	depth, complexity, err := queryCost(doc, req.Variables)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+	if depth > GraphQLMaxDepth {
+		err := fmt.Errorf("query depth %d exceeds the maximum of %d", depth, GraphQLMaxDepth)
+		c.JSON(http.StatusBadRequest, graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+	if complexity > GraphQLMaxComplexity {
+		err := fmt.Errorf("query complexity %d exceeds the maximum of %d", complexity, GraphQLMaxComplexity)
+		c.JSON(http.StatusBadRequest, graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, graphql.Do(graphql.Params{
+		Schema:         h.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        c.Request.Context(),
+	}))
+}
+
+// GET /graphql-schema
+func (h *GraphQLHandlers) Schema(c *gin.Context) {
+	c.String(http.StatusOK, printSchema(h.schema))
+}
+
+// queryCost returns the deepest field nesting in doc and its complexity:
+// one per field, with the fields under a list multiplied by the number of
+// items requested (see graphQLListArgs). Introspection fields are free.
+// Fragment cycles are reported as an error here because graphql-go's own
+// validation recurses on them until the stack overflows.
+func queryCost(doc *ast.Document, variables map[string]interface{}) (depth, complexity int, err error) {
+	q := queryCoster{fragments: map[string]*ast.FragmentDefinition{}, variables: variables, visiting: map[string]bool{}}
+	for _, def := range doc.Definitions {
+		if f, ok := def.(*ast.FragmentDefinition); ok && f.Name != nil {
+			q.fragments[f.Name.Value] = f
+		}
+	}
+	for _, def := range doc.Definitions {
+		if op, ok := def.(*ast.OperationDefinition); ok {
+			d, c := q.selectionCost(op.SelectionSet)
+			depth = max(depth, d)
+			complexity += c
+		}
+	}
+	if q.cycle != "" {
+		return 0, 0, fmt.Errorf("fragment %s spreads itself", q.cycle)
+	}
+	return depth, complexity, nil
+}
+
+type queryCoster struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	// visiting holds the fragments being expanded; cycle names the first
+	// fragment found spreading itself
+	visiting map[string]bool
+	cycle    string
+}
+
+func (q *queryCoster) selectionCost(set *ast.SelectionSet) (depth, complexity int) {
+	if set == nil {
+		return 0, 0
+	}
+	for _, sel := range set.Selections {
+		switch s := sel.(type) {
+		case *ast.Field:
+			if s.Name == nil || strings.HasPrefix(s.Name.Value, "__") {
+				continue
+			}
+			d, c := q.selectionCost(s.SelectionSet)
+			depth = max(depth, d+1)
+			complexity += 1 + c*listSize(s, q.variables)
+		case *ast.InlineFragment:
+			d, c := q.selectionCost(s.SelectionSet)
+			depth = max(depth, d)
+			complexity += c
+		case *ast.FragmentSpread:
+			name := s.Name.Value
+			if q.visiting[name] {
+				q.cycle = name
+				continue
+			}
+			f, ok := q.fragments[name]
+			if !ok {
+				continue
+			}
+			q.visiting[name] = true
+			d, c := q.selectionCost(f.SelectionSet)
+			delete(q.visiting, name)
+			depth = max(depth, d)
+			complexity += c
+		}
+	}
+	return depth, complexity
+}
+
+// listSize is how many items field requests: its size argument, the
+// argument's maximum when it cannot be read, or 1 for non-list fields.
+func listSize(field *ast.Field, variables map[string]interface{}) int {
+	list, ok := graphQLListArgs[field.Name.Value]
+	if !ok {
+		return 1
+	}
+	for _, arg := range field.Arguments {
+		if arg.Name == nil || arg.Name.Value != list.arg {
+			continue
+		}
+		switch v := arg.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(v.Value); err == nil && n >= 1 && n <= list.max {
+				return n
+			}
+		case *ast.Variable:
+			if n, ok := variables[v.Name.Value].(float64); ok && n >= 1 && n <= float64(list.max) {
+				return int(n)
+			}
+		}
+		return list.max
+	}
+	return list.def
+}
+
+// printSchema renders the schema's own types in GraphQL SDL, sorted by name.
+func printSchema(schema graphql.Schema) string {
+	var names []string
+	for name, t := range schema.TypeMap() {
+		if _, ok := t.(*graphql.Object); ok && !strings.HasPrefix(name, "__") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fields := schema.TypeMap()[name].(*graphql.Object).Fields()
+		fieldNames := make([]string, 0, len(fields))
+		for fieldName := range fields {
+			fieldNames = append(fieldNames, fieldName)
+		}
+		sort.Strings(fieldNames)
+
+		fmt.Fprintf(&b, "type %s {\n", name)
+		for _, fieldName := range fieldNames {
+			f := fields[fieldName]
+			if f.Description != "" {
+				fmt.Fprintf(&b, "  %s\n", strconv.Quote(f.Description))
+			}
+			b.WriteString("  " + fieldName)
+			if len(f.Args) > 0 {
+				args := make([]string, 0, len(f.Args))
+				for _, a := range f.Args {
+					arg := a.Name() + ": " + a.Type.String()
+					if a.DefaultValue != nil {
+						arg += fmt.Sprintf(" = %v", a.DefaultValue)
+					}
+					args = append(args, arg)
+				}
+				sort.Strings(args)
+				b.WriteString("(" + strings.Join(args, ", ") + ")")
+			}
+			fmt.Fprintf(&b, ": %s\n", f.Type.String())
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
@@ -1,19 +1,55 @@
 package product
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"text/main/middleware"
+	"text/main/response"
+	"text/main/validate"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 )
 
 type Handlers struct {
-	store *Store
+	store       ProductRepository
+	abtests     *ABTestManager
+	search      *ElasticsearchStore
+	adminAPIKey string
 }
 
-func NewHandlers(store *Store) *Handlers {
-	return &Handlers{store: store}
+// NewHandlers also starts the default recommendation experiment, splitting
+// customers evenly between same-category (A) and same-brand (B) products.
+func NewHandlers(store ProductRepository) *Handlers {
+	abtests := NewABTestManager()
+	abtests.Add(DefaultExperiment, store.SameCategory(), store.SameBrand(), 0.5)
+	return &Handlers{store: store, abtests: abtests}
+}
+
+// SetSearch makes GET /products rank results with Elasticsearch, falling
+// back to the in-memory scan when it is unavailable.
+func (h *Handlers) SetSearch(search *ElasticsearchStore) {
+	h.search = search
+}
+
+// SetAdminAPIKey sets the X-API-Key that product deletes, bulk price updates,
+// pricing tier and metadata changes and new bundles require. Without one,
+// they are rejected.
+func (h *Handlers) SetAdminAPIKey(key string) {
+	h.adminAPIKey = key
+}
+
+// requireAdmin guards admin-only routes that Register mounts alongside the
+// public ones.
+func (h *Handlers) requireAdmin(c *gin.Context) {
+	middleware.RequireAdminKey(h.adminAPIKey)(c)
 }
 
 // GET /products
@@ -22,89 +58,625 @@ func (h *Handlers) ListProducts(c *gin.Context) {
 	category := c.Query("category")
 	const maxCheck = 100
 	const maxReturn = 20
+	const defaultPageSize = 20
+	const maxPageSize = 100
+
+	var filters []func(Product) bool
+	if raw, ok := c.GetQuery("pre_order"); ok {
+		preOrder, err := strconv.ParseBool(raw)
+		if err != nil {
+			response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "pre_order must be true or false", nil)
+			return
+		}
+		filters = append(filters, func(p Product) bool { return p.IsPreOrder == preOrder })
+	}
+	// metadata.<key>=<value> matches products with that exact metadata value
+	metadata := map[string]string{}
+	for param, values := range c.Request.URL.Query() {
+		if key, ok := strings.CutPrefix(param, "metadata."); ok {
+			metadata[key] = values[0]
+		}
+	}
+	if len(metadata) > 0 {
+		filters = append(filters, func(p Product) bool { return metadataMatches(p, metadata) })
+	}
+	// brand matches like name and category; min_price and max_price bound
+	// the price, inclusive
+	filter := ProductFilter{Brand: c.Query("brand")}
+	for _, b := range []struct {
+		param string
+		bound **float64
+	}{{"min_price", &filter.MinPrice}, {"max_price", &filter.MaxPrice}} {
+		param, bound := b.param, b.bound
+		raw := c.Query(param)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || v < 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+			response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, param+" must be a non-negative number", nil)
+			return
+		}
+		*bound = &v
+	}
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "min_price must not be greater than max_price", nil)
+		return
+	}
+	var appliedFilter *ProductFilter
+	if !filter.IsEmpty() {
+		appliedFilter = &filter
+	}
+	var where func(Product) bool
+	if len(filters) > 0 {
+		where = func(p Product) bool {
+			for _, f := range filters {
+				if !f(p) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	// sort_by and sort_dir reorder the products returned; without them
+	// results stay in ID (or Elasticsearch relevance) order
+	_, sorted := c.GetQuery("sort_by")
+	if _, ok := c.GetQuery("sort_dir"); ok {
+		sorted = true
+	}
+	sortBy := SortByID
+	if raw := c.Query("sort_by"); raw != "" {
+		field, ok := ParseSortField(raw)
+		if !ok {
+			response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "sort_by must be one of id, name, price, category, brand", nil)
+			return
+		}
+		sortBy = field
+	}
+	sortDesc := false
+	switch c.Query("sort_dir") {
+	case "", "asc":
+	case "desc":
+		sortDesc = true
+	default:
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "sort_dir must be asc or desc", nil)
+		return
+	}
+
+	// after_id or limit pages through every match in ID order, rather than
+	// returning the first maxReturn matches among maxCheck products
+	_, paged := c.GetQuery("after_id")
+	if _, ok := c.GetQuery("limit"); ok {
+		paged = true
+	}
+	var afterID int32
+	if raw := c.Query("after_id"); raw != "" {
+		v, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil || v < 0 {
+			response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "after_id must be a non-negative integer", nil)
+			return
+		}
+		afterID = int32(v)
+	}
+	limit := defaultPageSize
+	if raw := c.Query("limit"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 || v > maxPageSize {
+			response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "limit must be between 1 and 100", nil)
+			return
+		}
+		limit = v
+	}
+	// Pages follow the ID cursor, so sorting could only reorder each page
+	if paged && sorted {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "sort_by and sort_dir cannot be combined with after_id or limit", nil)
+		return
+	}
 
 	start := time.Now()
-	products, total := h.store.SearchLimited(name, category, maxCheck, maxReturn)
+	var products []Product
+	var total int
+	var nextCursor int32
+	searched := false
+	// Elasticsearch does not index pre-order or metadata fields and ranks
+	// rather than pages by ID
+	if h.search != nil && where == nil && !paged {
+		var err error
+		products, total, err = h.search.Search(c.Request.Context(), SearchOptions{Query: name, Category: category, Filter: filter, Limit: maxReturn})
+		if err == nil {
+			searched = true
+		} else if !errors.Is(err, ErrSearchUnavailable) {
+			log.Printf("WARNING: Elasticsearch search failed, using in-memory store: %v\n", err)
+		}
+	}
+	if paged {
+		var more bool
+		// Counting every match would scan the whole catalog for each page,
+		// so total_found is the number of products on the page
+		products, more = h.store.SearchPageWhere(name, category, filter, where, afterID, limit)
+		total = len(products)
+		if more {
+			nextCursor = products[len(products)-1].ID
+		}
+	} else if !searched {
+		products, total = h.store.SearchLimitedWhere(name, category, filter, where, maxCheck, maxReturn)
+	}
+	// Sorting follows filtering, so maxCheck still bounds the products scanned
+	if sorted {
+		SortProducts(products, sortBy, sortDesc)
+	}
 	elapsed := time.Since(start)
 
+	if isV1(c) {
+		v1 := make([]ProductV1, 0, len(products))
+		for _, p := range products {
+			v1 = append(v1, p.V1())
+		}
+		response.Write(c, http.StatusOK, SearchResponseV1{
+			Products:   v1,
+			TotalFound: total,
+			SearchTime: elapsed.String(),
+			NextCursor: nextCursor,
+			Filter:     appliedFilter,
+		})
+		return
+	}
+
 	resp := SearchResponse{
 		Products:   products,
 		TotalFound: total,
 		SearchTime: elapsed.String(),
+		NextCursor: nextCursor,
+		Filter:     appliedFilter,
 	}
-	c.JSON(http.StatusOK, resp)
+	response.Write(c, http.StatusOK, resp)
 }
 
 // POST /products
 func (h *Handlers) CreateProduct(c *gin.Context) {
-	var body Product
+	var body CreateProductRequest
 	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Message: "invalid JSON body"})
+		if validate.Reject(c, err) {
+			return
+		}
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidJSON, "invalid JSON body", nil)
 		return
 	}
-	if body.Price < 0 {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Message: "price must be non-negative"})
+
+	created := h.store.Create(body.Product())
+	writeProduct(c, http.StatusCreated, created)
+}
+
+// POST /products/bulk
+//
+// Accepts a JSON array of up to MaxBulkCreate products, each validated like
+// POST /products. The valid ones are created together under one lock. The
+// response is 201 when every product was created and 207 Multi-Status when
+// some were rejected.
+func (h *Handlers) BulkCreateProducts(c *gin.Context) {
+	var items []json.RawMessage
+	if err := c.ShouldBindJSON(&items); err != nil {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidJSON, "body must be a JSON array of products", nil)
 		return
 	}
-	if len(body.Name) == 0 || len(body.Name) > 100 {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Message: "invalid name"})
+	if len(items) == 0 || len(items) > MaxBulkCreate {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, fmt.Sprintf("body must contain between 1 and %d products", MaxBulkCreate), nil)
 		return
 	}
 
-	created := h.store.Create(body)
-	c.JSON(http.StatusCreated, created)
+	resp := BulkCreateResponse{Results: make([]BulkCreateResult, len(items))}
+	valid := make([]Product, 0, len(items))
+	// validIndex maps each valid product back to its position in the request
+	validIndex := make([]int, 0, len(items))
+	for i, item := range items {
+		p, msg := productFromJSON(item)
+		if msg != "" {
+			resp.Results[i] = BulkCreateResult{Index: i, Status: http.StatusUnprocessableEntity, Error: msg}
+			resp.Failed++
+			continue
+		}
+		valid = append(valid, p)
+		validIndex = append(validIndex, i)
+	}
+	for j, p := range h.store.BulkCreate(valid) {
+		var view interface{} = p
+		if isV1(c) {
+			view = p.V1()
+		}
+		resp.Results[validIndex[j]] = BulkCreateResult{Index: validIndex[j], Status: http.StatusCreated, Product: view}
+		resp.Created++
+	}
+
+	status := http.StatusCreated
+	if resp.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, resp)
 }
 
 // GET /products/{productId}
 func (h *Handlers) GetProduct(c *gin.Context) {
 	id, ok := parseProductID(c.Param("productId"))
 	if !ok || id < 1 {
-		c.JSON(http.StatusNotFound, ErrorResponse{Message: "product not found"})
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeProductNotFound, "product not found", nil)
 		return
 	}
 	product, found := h.store.Get(id)
 	if !found {
-		c.JSON(http.StatusNotFound, ErrorResponse{Message: "product not found"})
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeProductNotFound, "product not found", nil)
+		return
+	}
+	// Customers in a price experiment see their arm's price
+	if raw := c.Query("customer_id"); raw != "" {
+		customerID, err := strconv.Atoi(raw)
+		if err != nil {
+			response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "customer_id must be an integer", nil)
+			return
+		}
+		product.Price = h.store.GetPriceForExperiment(id, customerID)
+	}
+	writeProduct(c, http.StatusOK, product)
+}
+
+// GET /products/{productId}/stock
+func (h *Handlers) GetStock(c *gin.Context) {
+	id, ok := parseProductID(c.Param("productId"))
+	if !ok || id < 1 {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeProductNotFound, "product not found", nil)
+		return
+	}
+	product, found := h.store.Get(id)
+	if !found {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeProductNotFound, "product not found", nil)
+		return
+	}
+	c.JSON(http.StatusOK, StockResponse{ProductID: product.ID, Stock: product.Stock, IsPreOrder: product.IsPreOrder})
+}
+
+// DELETE /products/{productId}
+//
+// Products that are bundle components or have reserved stock are kept (409)
+// so bundles and reservations never point at a missing product.
+func (h *Handlers) DeleteProduct(c *gin.Context) {
+	id, ok := parseProductID(c.Param("productId"))
+	if !ok || id < 1 {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeProductNotFound, "product not found", nil)
 		return
 	}
-	c.JSON(http.StatusOK, product)
+	if _, found := h.store.Get(id); !found {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeProductNotFound, "product not found", nil)
+		return
+	}
+	if h.store.ProductInUse(id) {
+		response.WriteError(c, http.StatusConflict, response.ErrCodeProductInUse, "product is a bundle component or has reserved stock", nil)
+		return
+	}
+	if !h.store.Delete(id) {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeProductNotFound, "product not found", nil)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// POST /products/batch
+func (h *Handlers) BatchGetProducts(c *gin.Context) {
+	var body BatchGetRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		if validate.Reject(c, err) {
+			return
+		}
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidJSON, "invalid JSON body", nil)
+		return
+	}
+
+	found, missing := h.store.GetMany(body.IDs)
+	products := make([]Product, 0, len(found))
+	for _, id := range body.IDs {
+		if p, ok := found[id]; ok {
+			products = append(products, p)
+		}
+	}
+	if isV1(c) {
+		v1 := make([]ProductV1, 0, len(products))
+		for _, p := range products {
+			v1 = append(v1, p.V1())
+		}
+		c.JSON(http.StatusOK, gin.H{"products": v1, "missing_ids": missing})
+		return
+	}
+	c.JSON(http.StatusOK, BatchGetResponse{Products: products, MissingIDs: missing})
+}
+
+// GET /products/by-slug/{slug}
+func (h *Handlers) GetProductBySlug(c *gin.Context) {
+	product, found := h.store.GetBySlug(c.Param("slug"))
+	if !found {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeProductNotFound, "product not found", nil)
+		return
+	}
+	writeProduct(c, http.StatusOK, product)
 }
 
 // POST /products/{productId}/details
 func (h *Handlers) AddProductDetails(c *gin.Context) {
 	id, ok := parseProductID(c.Param("productId"))
 	if !ok || id < 1 {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Message: "invalid productId"})
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidProductID, "invalid productId", nil)
 		return
 	}
 
-	var body Product
+	var body ProductDetailsRequest
 	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Message: "invalid JSON body"})
+		if validate.Reject(c, err) {
+			return
+		}
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidJSON, "invalid JSON body", nil)
 		return
 	}
-	if body.Price < 0 {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Message: "price must be non-negative"})
+
+	if _, exists := h.store.Get(id); !exists {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeProductNotFound, "product not found", nil)
 		return
 	}
-	if len(body.Name) > 0 && len(body.Name) > 100 {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Message: "name is too long"})
+
+	if _, ok := h.store.UpdateDetails(id, body.Product()); !ok {
+		response.WriteError(c, http.StatusInternalServerError, response.ErrCodeInternal, "internal server error", nil)
 		return
 	}
 
-	if _, exists := h.store.Get(id); !exists {
-		c.JSON(http.StatusNotFound, ErrorResponse{Message: "product not found"})
+	c.Status(http.StatusNoContent)
+}
+
+// isV1 reports whether the request negotiated the v1 API. Requests that
+// bypassed the version middleware are treated as v1.
+func isV1(c *gin.Context) bool {
+	return c.GetInt(middleware.APIVersionKey) < 2
+}
+
+// writeProduct renders a single product in the negotiated API version.
+func writeProduct(c *gin.Context, status int, p Product) {
+	if isV1(c) {
+		c.JSON(status, p.V1())
+		return
+	}
+	c.JSON(status, p)
+}
+
+// GET /products/{productId}/pricing-tiers
+func (h *Handlers) GetPricingTiers(c *gin.Context) {
+	id, ok := parseProductID(c.Param("productId"))
+	if !ok || id < 1 {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeProductNotFound, "product not found", nil)
+		return
+	}
+	product, found := h.store.Get(id)
+	if !found {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeProductNotFound, "product not found", nil)
 		return
 	}
+	tiers := product.PricingTiers
+	if tiers == nil {
+		tiers = []PricingTier{}
+	}
+	c.JSON(http.StatusOK, PricingTiersResponse{ProductID: id, Tiers: tiers})
+}
 
-	if _, ok := h.store.UpdateDetails(id, body); !ok {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "internal server error"})
+// POST /products/{productId}/pricing-tiers
+func (h *Handlers) SetPricingTiers(c *gin.Context) {
+	id, ok := parseProductID(c.Param("productId"))
+	if !ok || id < 1 {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidProductID, "invalid productId", nil)
 		return
 	}
+	var body PricingTiersRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidJSON, "invalid JSON body", nil)
+		return
+	}
+	if err := ValidatePricingTiers(body.Tiers); err != nil {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidPricingTiers, err.Error(), nil)
+		return
+	}
+	product, found := h.store.SetPricingTiers(id, body.Tiers)
+	if !found {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeProductNotFound, "product not found", nil)
+		return
+	}
+	c.JSON(http.StatusOK, PricingTiersResponse{ProductID: id, Tiers: product.PricingTiers})
+}
 
+// GET /products/{productId}/metadata/{key}
+func (h *Handlers) GetMetadata(c *gin.Context) {
+	id, ok := parseProductID(c.Param("productId"))
+	if !ok || id < 1 {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeProductNotFound, "product not found", nil)
+		return
+	}
+	if _, found := h.store.Get(id); !found {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeProductNotFound, "product not found", nil)
+		return
+	}
+	key := c.Param("key")
+	value, found := h.store.GetMetadata(id, key)
+	if !found {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeMetadataNotFound, "metadata key not found", nil)
+		return
+	}
+	c.JSON(http.StatusOK, MetadataEntry{ProductID: id, Key: key, Value: value})
+}
+
+// PUT /products/{productId}/metadata/{key}
+func (h *Handlers) SetMetadata(c *gin.Context) {
+	id, ok := parseProductID(c.Param("productId"))
+	if !ok || id < 1 {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidProductID, "invalid productId", nil)
+		return
+	}
+	var body MetadataRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		if validate.Reject(c, err) {
+			return
+		}
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidJSON, "invalid JSON body", nil)
+		return
+	}
+	key := c.Param("key")
+	if err := h.store.SetMetadata(id, key, *body.Value); err != nil {
+		if errors.Is(err, ErrProductNotFound) {
+			response.WriteError(c, http.StatusNotFound, response.ErrCodeProductNotFound, "product not found", nil)
+			return
+		}
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidMetadata, err.Error(), nil)
+		return
+	}
+	c.JSON(http.StatusOK, MetadataEntry{ProductID: id, Key: key, Value: *body.Value})
+}
+
+// DELETE /products/{productId}/metadata/{key}
+func (h *Handlers) DeleteMetadata(c *gin.Context) {
+	id, ok := parseProductID(c.Param("productId"))
+	if !ok || id < 1 {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidProductID, "invalid productId", nil)
+		return
+	}
+	if err := h.store.DeleteMetadata(id, c.Param("key")); err != nil {
+		if errors.Is(err, ErrProductNotFound) {
+			response.WriteError(c, http.StatusNotFound, response.ErrCodeProductNotFound, "product not found", nil)
+			return
+		}
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeMetadataNotFound, "metadata key not found", nil)
+		return
+	}
 	c.Status(http.StatusNoContent)
 }
 
+// POST /products/bundles
+func (h *Handlers) CreateBundle(c *gin.Context) {
+	var body Bundle
+	if err := c.ShouldBindJSON(&body); err != nil {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidJSON, "invalid JSON body", nil)
+		return
+	}
+	created, err := h.store.CreateValidatedBundle(body)
+	if err != nil {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidBundle, err.Error(), nil)
+		return
+	}
+	c.JSON(http.StatusCreated, h.bundleResponse(created))
+}
+
+// GET /products/bundles
+func (h *Handlers) ListBundles(c *gin.Context) {
+	bundles := h.store.ListBundles()
+	resp := make([]BundleResponse, 0, len(bundles))
+	for _, b := range bundles {
+		resp = append(resp, h.bundleResponse(b))
+	}
+	c.JSON(http.StatusOK, gin.H{"bundles": resp})
+}
+
+// GET /products/bundles/{bundleId}
+func (h *Handlers) GetBundle(c *gin.Context) {
+	id, ok := parseProductID(c.Param("bundleId"))
+	if !ok || id < 1 {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeBundleNotFound, "bundle not found", nil)
+		return
+	}
+	bundle, found := h.store.GetBundle(id)
+	if !found {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeBundleNotFound, "bundle not found", nil)
+		return
+	}
+	c.JSON(http.StatusOK, h.bundleResponse(bundle))
+}
+
+func (h *Handlers) bundleResponse(b Bundle) BundleResponse {
+	total := h.store.ComponentTotal(b)
+	return BundleResponse{
+		Bundle:         b,
+		ComponentTotal: total,
+		Savings:        math.Round((total-b.BundlePrice)*100) / 100,
+	}
+}
+
+// PATCH /products/price
+func (h *Handlers) BulkUpdatePrice(c *gin.Context) {
+	var body BulkPriceUpdateRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		if validate.Reject(c, err) {
+			return
+		}
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidJSON, "invalid JSON body", nil)
+		return
+	}
+	if body.Multiplier < MinPriceMultiplier || body.Multiplier > MaxPriceMultiplier {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidMultiplier, ErrInvalidMultiplier.Error(), nil)
+		return
+	}
+	query := ProductQuery{Category: body.Category, Brand: body.Brand}
+	if query.IsEmpty() {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "category or brand is required", nil)
+		return
+	}
+
+	if body.DryRun {
+		c.JSON(http.StatusOK, BulkPriceUpdateResponse{Updated: h.store.CountMatching(query), DryRun: true})
+		return
+	}
+	updated, err := h.store.BulkUpdatePrice(query, body.Multiplier)
+	if err != nil {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidMultiplier, err.Error(), nil)
+		return
+	}
+	c.JSON(http.StatusOK, BulkPriceUpdateResponse{Updated: updated})
+}
+
+// GET /admin/analytics/searches?limit=20
+func (h *Handlers) TopSearches(c *gin.Context) {
+	limit := 20
+	if raw := c.Query("limit"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 || v > 1000 {
+			response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "limit must be between 1 and 1000", nil)
+			return
+		}
+		limit = v
+	}
+	c.JSON(http.StatusOK, gin.H{"searches": h.store.TopSearches(limit)})
+}
+
+// GET /admin/products/rebuild?n=100000
+//
+// Regenerates the seed catalog in the background; reads keep being served
+// from the old catalog until it is swapped out.
+func (h *Handlers) RebuildProducts(c *gin.Context) {
+	n := DefaultRebuildProducts
+	if raw := c.Query("n"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 || v > MaxRebuildProducts {
+			response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "n must be between 1 and 1000000", nil)
+			return
+		}
+		n = v
+	}
+	if !h.store.StartRebuild(n) {
+		response.WriteError(c, http.StatusConflict, response.ErrCodeRebuildInProgress, "a rebuild is already in progress", nil)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "rebuilding", "products": n})
+}
+
+// GET /admin/products/rebuild/status
+func (h *Handlers) RebuildStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, h.store.RebuildStatus())
+}
+
+// GET /admin/products/cache-stats
+func (h *Handlers) CacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.store.CacheStats())
+}
+
 func parseProductID(raw string) (int32, bool) {
 	v, err := strconv.ParseInt(raw, 10, 32)
 	if err != nil {
@@ -112,3 +684,301 @@ func parseProductID(raw string) (int32, bool) {
 	}
 	return int32(v), true
 }
+
+// POST /admin/inventory/reserve
+func (h *Handlers) ReserveInventory(c *gin.Context) {
+	var items []ReservationItem
+	if err := c.ShouldBindJSON(&items); err != nil {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidJSON, "invalid JSON body", nil)
+		return
+	}
+	if len(items) == 0 || len(items) > MaxReservationItems {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "between 1 and 200 items are required", nil)
+		return
+	}
+	for _, item := range items {
+		if item.ProductID < 1 || item.Quantity < 1 {
+			response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "product_id and quantity must be positive", item)
+			return
+		}
+	}
+
+	reservation, err := h.store.Reserve(items)
+	if err != nil {
+		var failed *ReservationError
+		if errors.As(err, &failed) {
+			response.WriteError(c, http.StatusConflict, response.ErrCodeInsufficientStock, ErrPartialReservation.Error(), failed)
+			return
+		}
+		response.WriteError(c, http.StatusInternalServerError, response.ErrCodeInternal, "reservation failed", nil)
+		return
+	}
+	c.JSON(http.StatusCreated, reservation)
+}
+
+// POST /admin/inventory/release/:reservationId
+func (h *Handlers) ReleaseReservation(c *gin.Context) {
+	reservation, ok := h.store.ReleaseReservation(c.Param("reservationId"))
+	if !ok {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeReservationNotFound, "reservation not found or expired", nil)
+		return
+	}
+	c.JSON(http.StatusOK, reservation)
+}
+
+// GET /admin/inventory/low-stock
+func (h *Handlers) LowStock(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"products": h.store.LowStock()})
+}
+
+// RecommendationResponse is returned by GET /products/:productId/recommendations.
+type RecommendationResponse struct {
+	Experiment      string      `json:"experiment"`
+	Variant         string      `json:"variant"`
+	ProductID       int32       `json:"product_id"`
+	Recommendations interface{} `json:"recommendations"`
+}
+
+// GET /products/:productId/recommendations
+func (h *Handlers) GetRecommendations(c *gin.Context) {
+	id, ok := parseProductID(c.Param("productId"))
+	if !ok || id < 1 {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidProductID, "invalid product id", nil)
+		return
+	}
+	if _, found := h.store.Get(id); !found {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeProductNotFound, "product not found", nil)
+		return
+	}
+	customerID, err := strconv.Atoi(c.Query("customer_id"))
+	if err != nil {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "customer_id is required", nil)
+		return
+	}
+	exp, found := h.abtests.Experiment(c.DefaultQuery("experiment", DefaultExperiment))
+	if !found {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeExperimentNotFound, "experiment not found", nil)
+		return
+	}
+
+	products := exp.Recommend(c.Request.Context(), id, customerID)
+	resp := RecommendationResponse{Experiment: exp.Name, Variant: exp.Variant(customerID), ProductID: id, Recommendations: products}
+	if isV1(c) {
+		v1 := make([]ProductV1, 0, len(products))
+		for _, p := range products {
+			v1 = append(v1, p.V1())
+		}
+		resp.Recommendations = v1
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// RecommendationClick is the body of POST /events/recommendation-click.
+type RecommendationClick struct {
+	Experiment string `json:"experiment"`
+	CustomerID int    `json:"customer_id" binding:"required"`
+	ProductID  int32  `json:"product_id" binding:"required,gte=1"`
+}
+
+// POST /events/recommendation-click
+func (h *Handlers) RecordRecommendationClick(c *gin.Context) {
+	var body RecommendationClick
+	if err := c.ShouldBindJSON(&body); err != nil {
+		if validate.Reject(c, err) {
+			return
+		}
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidJSON, "invalid JSON body", nil)
+		return
+	}
+	if body.Experiment == "" {
+		body.Experiment = DefaultExperiment
+	}
+	exp, found := h.abtests.Experiment(body.Experiment)
+	if !found {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeExperimentNotFound, "experiment not found", nil)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"experiment": exp.Name, "variant": exp.RecordClick(body.CustomerID)})
+}
+
+// GET /admin/ab-tests/:name/results
+func (h *Handlers) ABTestResults(c *gin.Context) {
+	exp, found := h.abtests.Experiment(c.Param("name"))
+	if !found {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeExperimentNotFound, "experiment not found", nil)
+		return
+	}
+	recent := 0
+	if raw := c.Query("recent"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 0 || v > impressionLogSize {
+			response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "recent must be between 0 and 10000", nil)
+			return
+		}
+		recent = v
+	}
+	c.JSON(http.StatusOK, exp.Results(recent))
+}
+
+// POST /admin/experiments
+func (h *Handlers) CreatePriceExperiment(c *gin.Context) {
+	var body PriceExperiment
+	if err := c.ShouldBindJSON(&body); err != nil {
+		if validate.Reject(c, err) {
+			return
+		}
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidJSON, "invalid JSON body", nil)
+		return
+	}
+	if _, missing := h.store.GetMany(body.ProductIDs); len(missing) > 0 {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidExperiment, "unknown product ids", gin.H{"missing_ids": missing})
+		return
+	}
+	err := h.store.PriceExperiments().Add(body)
+	if errors.Is(err, ErrPriceExperimentOverlap) {
+		response.WriteError(c, http.StatusConflict, response.ErrCodeExperimentConflict, err.Error(), nil)
+		return
+	}
+	if err != nil {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidExperiment, err.Error(), nil)
+		return
+	}
+	c.JSON(http.StatusCreated, body)
+}
+
+// GET /admin/experiments
+func (h *Handlers) ListPriceExperiments(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"experiments": h.store.PriceExperiments().List()})
+}
+
+// GET /admin/experiments/:id/results
+func (h *Handlers) PriceExperimentResults(c *gin.Context) {
+	results, err := h.store.PriceExperiments().Results(c.Param("id"))
+	if err != nil {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeExperimentNotFound, "experiment not found", nil)
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// PurchaseEvent is the body of POST /events/purchase.
+type PurchaseEvent struct {
+	CustomerID int `json:"customer_id" binding:"required"`
+}
+
+// POST /events/purchase?experiment_id=X
+func (h *Handlers) RecordPurchase(c *gin.Context) {
+	var body PurchaseEvent
+	if err := c.ShouldBindJSON(&body); err != nil {
+		if validate.Reject(c, err) {
+			return
+		}
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidJSON, "invalid JSON body", nil)
+		return
+	}
+	experimentID := c.Query("experiment_id")
+	variant, err := h.store.PriceExperiments().RecordPurchase(experimentID, body.CustomerID)
+	if err != nil {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeExperimentNotFound, "experiment not found", nil)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"experiment_id": experimentID, "variant": variant})
+}
+
+var stockUpgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+
+// GET /admin/ws/inventory
+//
+// Streams StockEvent JSON messages over a WebSocket until the client
+// disconnects. Clients that fall more than 100 events behind miss events.
+func (h *Handlers) StreamStockEvents(c *gin.Context) {
+	conn, err := stockUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade has already written an HTTP error
+		return
+	}
+	defer conn.Close()
+
+	id, events := h.store.StockEvents().Subscribe()
+	defer h.store.StockEvents().Unsubscribe(id)
+
+	// The client only sends control frames; reading surfaces its disconnect
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case e := <-events:
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteJSON(e); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// GET /products/changes?since=<sync_token>
+func (h *Handlers) ListChanges(c *gin.Context) {
+	since, err := time.Parse(time.RFC3339, c.Query("since"))
+	if err != nil {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "since must be an RFC3339 timestamp", nil)
+		return
+	}
+	changed, token, err := h.store.GetChangedSince(since)
+	if err != nil {
+		response.WriteError(c, http.StatusGone, response.ErrCodeSyncTokenExpired, "changes before the last catalog rebuild are not available; resync the full catalog", nil)
+		return
+	}
+	syncToken := token.Format(time.RFC3339Nano)
+	if isV1(c) {
+		v1 := make([]ChangedProductV1, 0, len(changed))
+		for _, p := range changed {
+			v1 = append(v1, p.V1())
+		}
+		c.JSON(http.StatusOK, gin.H{"products": v1, "sync_token": syncToken})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"products": changed, "sync_token": syncToken})
+}
+
+// GET /products/:productId/similar
+func (h *Handlers) SimilarProducts(c *gin.Context) {
+	id, ok := parseProductID(c.Param("productId"))
+	if !ok || id < 1 {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidProductID, "invalid product id", nil)
+		return
+	}
+	limit := 10
+	if raw := c.Query("limit"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 || v > MaxSimilarProducts {
+			response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "limit must be between 1 and 50", nil)
+			return
+		}
+		limit = v
+	}
+
+	products, err := h.store.SimilarProducts(id, limit)
+	if err != nil {
+		response.WriteError(c, http.StatusNotFound, response.ErrCodeProductNotFound, "product not found", nil)
+		return
+	}
+	if isV1(c) {
+		v1 := make([]ProductV1, 0, len(products))
+		for _, p := range products {
+			v1 = append(v1, p.V1())
+		}
+		c.JSON(http.StatusOK, gin.H{"products": v1})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"products": products})
+}
@@ -0,0 +1,744 @@
+package product
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"text/main/middleware"
+	"text/main/response"
+	"text/main/validate"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ugorji/go/codec"
+)
+
+const testAdminKey = "test-admin-key"
+
+// newTestRouter serves the v2 product routes over repo.
+func newTestRouter(repo ProductRepository) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := NewHandlers(repo)
+	h.SetAdminAPIKey(testAdminKey)
+	r := gin.New()
+	r.Use(validate.Middleware())
+	Register(r.Group("/v2", middleware.PinVersion(2)), h)
+	return r
+}
+
+func serve(r http.Handler, method, path, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header.Set(k, v[0])
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestGetProduct(t *testing.T) {
+	repo := NewMockProductRepository(t, Product{ID: 7, Name: "Lamp", Price: 12.5})
+	r := newTestRouter(repo)
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"found", "/v2/products/7", http.StatusOK},
+		{"missing", "/v2/products/8", http.StatusNotFound},
+		{"zero id", "/v2/products/0", http.StatusNotFound},
+		{"not a number", "/v2/products/lamp", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodGet, tt.path, "", nil)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var got Product
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.ID != 7 || got.Name != "Lamp" {
+				t.Errorf("got %+v, want product 7", got)
+			}
+		})
+	}
+}
+
+func TestCreateProduct(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"valid", `{"name":"Desk","category":"Home","price":99.5,"stock":3}`, http.StatusCreated},
+		{"blank name", `{"name":"  ","price":1}`, http.StatusUnprocessableEntity},
+		{"negative price", `{"name":"Desk","price":-1}`, http.StatusUnprocessableEntity},
+		{"malformed", `{"name":`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockProductRepository(t)
+			w := serve(newTestRouter(repo), http.MethodPost, "/v2/products", tt.body, nil)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			_, stored := repo.Get(1)
+			if stored != (tt.status == http.StatusCreated) {
+				t.Errorf("stored = %v after status %d", stored, w.Code)
+			}
+		})
+	}
+}
+
+func TestAddProductDetails(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+	}{
+		{"updates", "/v2/products/1/details", `{"name":"Desk v2","price":120}`, http.StatusNoContent},
+		{"missing", "/v2/products/2/details", `{"name":"Desk v2","price":120}`, http.StatusNotFound},
+		{"invalid id", "/v2/products/x/details", `{"price":120}`, http.StatusBadRequest},
+		{"negative price", "/v2/products/1/details", `{"price":-5}`, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockProductRepository(t, Product{ID: 1, Name: "Desk", Price: 100})
+			w := serve(newTestRouter(repo), http.MethodPost, tt.path, tt.body, nil)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			p, _ := repo.Get(1)
+			if updated := p.Name == "Desk v2" && p.Price == 120; updated != (tt.status == http.StatusNoContent) {
+				t.Errorf("product 1 = %+v after status %d", p, w.Code)
+			}
+		})
+	}
+}
+
+func TestDeleteProduct(t *testing.T) {
+	admin := http.Header{middleware.AdminAPIKeyHeader: {testAdminKey}}
+	tests := []struct {
+		name   string
+		path   string
+		header http.Header
+		inUse  bool
+		status int
+	}{
+		{"deletes", "/v2/products/1", admin, false, http.StatusNoContent},
+		{"no key", "/v2/products/1", nil, false, http.StatusUnauthorized},
+		{"wrong key", "/v2/products/1", http.Header{middleware.AdminAPIKeyHeader: {"guess"}}, false, http.StatusUnauthorized},
+		{"in use", "/v2/products/1", admin, true, http.StatusConflict},
+		{"missing", "/v2/products/2", admin, false, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockProductRepository(t, Product{ID: 1, Name: "Desk"})
+			repo.InUse[1] = tt.inUse
+			w := serve(newTestRouter(repo), http.MethodDelete, tt.path, "", tt.header)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if _, kept := repo.Get(1); kept == (tt.status == http.StatusNoContent) {
+				t.Errorf("product 1 kept = %v after status %d", kept, w.Code)
+			}
+		})
+	}
+}
+
+func TestCreateBundle(t *testing.T) {
+	admin := http.Header{middleware.AdminAPIKeyHeader: {testAdminKey}}
+	const body = `{"name":"Office","component_ids":[1],"bundle_price":1}`
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{"creates", admin, http.StatusCreated},
+		{"no key", nil, http.StatusUnauthorized},
+		{"wrong key", http.Header{middleware.AdminAPIKeyHeader: {"guess"}}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created := false
+			repo := NewMockProductRepository(t, Product{ID: 1, Name: "Desk", Price: 100})
+			repo.CreateValidatedBundleFunc = func(b Bundle) (Bundle, error) { created = true; return b, nil }
+			repo.ComponentTotalFunc = func(Bundle) float64 { return 100 }
+			w := serve(newTestRouter(repo), http.MethodPost, "/v2/products/bundles", body, tt.header)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if created != (tt.status == http.StatusCreated) {
+				t.Errorf("bundle created = %v after status %d", created, w.Code)
+			}
+		})
+	}
+}
+
+func TestBulkUpdatePrice(t *testing.T) {
+	admin := http.Header{middleware.AdminAPIKeyHeader: {testAdminKey}}
+	tests := []struct {
+		name   string
+		body   string
+		header http.Header
+		status int
+		// wantPrices are the prices of products 1 (Electronics) and 2 (Books) afterwards
+		wantPrices [2]float64
+	}{
+		{"reprices the category", `{"category":"Electronics","multiplier":0.9}`, admin, http.StatusOK, [2]float64{90, 50}},
+		{"dry run", `{"category":"Electronics","multiplier":0.9,"dry_run":true}`, admin, http.StatusOK, [2]float64{100, 50}},
+		{"no key", `{"category":"Electronics","multiplier":0.9}`, nil, http.StatusUnauthorized, [2]float64{100, 50}},
+		{"wrong key", `{"category":"Electronics","multiplier":0.01}`, http.Header{middleware.AdminAPIKeyHeader: {"guess"}}, http.StatusUnauthorized, [2]float64{100, 50}},
+		{"lowest multiplier", `{"category":"Electronics","multiplier":0.01}`, admin, http.StatusOK, [2]float64{1, 50}},
+		{"highest multiplier", `{"category":"Electronics","multiplier":10}`, admin, http.StatusOK, [2]float64{1000, 50}},
+		{"multiplier too small", `{"category":"Electronics","multiplier":0.009}`, admin, http.StatusBadRequest, [2]float64{100, 50}},
+		{"multiplier too large", `{"category":"Electronics","multiplier":10.5}`, admin, http.StatusBadRequest, [2]float64{100, 50}},
+		{"negative multiplier", `{"category":"Electronics","multiplier":-1}`, admin, http.StatusBadRequest, [2]float64{100, 50}},
+		{"no category or brand", `{"multiplier":0.9}`, admin, http.StatusBadRequest, [2]float64{100, 50}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockProductRepository(t,
+				Product{ID: 1, Name: "Phone", Category: "Electronics", Price: 100},
+				Product{ID: 2, Name: "Novel", Category: "Books", Price: 50},
+			)
+			w := serve(newTestRouter(repo), http.MethodPatch, "/v2/products/price", tt.body, tt.header)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			for i, want := range tt.wantPrices {
+				if p, _ := repo.Get(int32(i + 1)); p.Price != want {
+					t.Errorf("product %d price = %v, want %v", p.ID, p.Price, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSetPricingTiers(t *testing.T) {
+	admin := http.Header{middleware.AdminAPIKeyHeader: {testAdminKey}}
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		header http.Header
+		status int
+	}{
+		{"sets tiers", "/v2/products/1/pricing-tiers", `{"tiers":[{"min_quantity":10,"discount_percent":0.05},{"min_quantity":100,"discount_percent":0.1}]}`, admin, http.StatusOK},
+		{"no key", "/v2/products/1/pricing-tiers", `{"tiers":[{"min_quantity":1,"discount_percent":0.9}]}`, nil, http.StatusUnauthorized},
+		{"wrong key", "/v2/products/1/pricing-tiers", `{"tiers":[{"min_quantity":1,"discount_percent":0.9}]}`, http.Header{middleware.AdminAPIKeyHeader: {"guess"}}, http.StatusUnauthorized},
+		{"unsorted", "/v2/products/1/pricing-tiers", `{"tiers":[{"min_quantity":100,"discount_percent":0.1},{"min_quantity":10,"discount_percent":0.05}]}`, admin, http.StatusBadRequest},
+		{"missing product", "/v2/products/2/pricing-tiers", `{"tiers":[{"min_quantity":10,"discount_percent":0.05}]}`, admin, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockProductRepository(t, Product{ID: 1, Name: "Desk", Price: 100})
+			w := serve(newTestRouter(repo), http.MethodPost, tt.path, tt.body, tt.header)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			p, _ := repo.Get(1)
+			if set := len(p.PricingTiers) > 0; set != (tt.status == http.StatusOK) {
+				t.Errorf("product 1 tiers = %+v after status %d", p.PricingTiers, w.Code)
+			}
+		})
+	}
+}
+
+func TestListProductsFiltersInStore(t *testing.T) {
+	repo := NewMockProductRepository(t,
+		Product{ID: 1, Name: "Desk", Brand: "Alpha", Price: 50},
+		Product{ID: 2, Name: "Chair", Brand: "Alpha", Price: 150},
+		Product{ID: 3, Name: "Lamp", Brand: "Beta", Price: 60},
+		Product{ID: 4, Name: "Shelf", Brand: "alphabet", Price: 80},
+	)
+	r := newTestRouter(repo)
+
+	tests := []struct {
+		name      string
+		query     string
+		wantIDs   []int32
+		wantTotal int
+		wantNext  int32
+	}{
+		{"brand", "brand=ALPHA", []int32{1, 2, 4}, 3, 0},
+		{"price range", "min_price=55&max_price=100", []int32{3, 4}, 2, 0},
+		{"brand and price", "brand=alpha&max_price=100", []int32{1, 4}, 2, 0},
+		{"paged total is the page", "brand=alpha&limit=2", []int32{1, 2}, 2, 2},
+		{"last page", "brand=alpha&limit=2&after_id=2", []int32{4}, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodGet, "/v2/products?"+tt.query, "", nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var resp SearchResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			var ids []int32
+			for _, p := range resp.Products {
+				ids = append(ids, p.ID)
+			}
+			if !equalIDs(ids, tt.wantIDs) || resp.TotalFound != tt.wantTotal || resp.NextCursor != tt.wantNext {
+				t.Errorf("got ids %v total %d next %d, want %v %d %d", ids, resp.TotalFound, resp.NextCursor, tt.wantIDs, tt.wantTotal, tt.wantNext)
+			}
+			// The filter reaches the store rather than being applied afterwards
+			got := repo.Filters[len(repo.Filters)-1]
+			if got.IsEmpty() {
+				t.Errorf("store got an empty filter for %q", tt.query)
+			}
+			if resp.Filter == nil || resp.Filter.Brand != got.Brand {
+				t.Errorf("response echoes filter %+v, want brand %q", resp.Filter, got.Brand)
+			}
+		})
+	}
+}
+
+func TestListProductsSorted(t *testing.T) {
+	r := newTestRouter(NewMockProductRepository(t,
+		Product{ID: 1, Name: "Desk", Price: 50},
+		Product{ID: 2, Name: "Chair", Price: 150},
+		Product{ID: 3, Name: "Lamp", Price: 20},
+	))
+	tests := []struct {
+		query   string
+		status  int
+		wantIDs []int32
+	}{
+		{"", http.StatusOK, []int32{1, 2, 3}},
+		{"sort_by=price", http.StatusOK, []int32{3, 1, 2}},
+		{"sort_by=price&sort_dir=desc", http.StatusOK, []int32{2, 1, 3}},
+		{"sort_by=name", http.StatusOK, []int32{2, 1, 3}},
+		{"sort_dir=desc", http.StatusOK, []int32{3, 2, 1}},
+		// Pages follow the ID cursor, so they cannot be sorted
+		{"sort_by=price&limit=2", http.StatusBadRequest, nil},
+		{"sort_dir=desc&after_id=1", http.StatusBadRequest, nil},
+		{"sort_by=stock", http.StatusBadRequest, nil},
+		{"sort_dir=up", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		w := serve(r, http.MethodGet, "/v2/products?"+tt.query, "", nil)
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.query, w.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var resp SearchResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		var ids []int32
+		for _, p := range resp.Products {
+			ids = append(ids, p.ID)
+		}
+		if !equalIDs(ids, tt.wantIDs) {
+			t.Errorf("%s: got ids %v, want %v", tt.query, ids, tt.wantIDs)
+		}
+	}
+}
+
+func TestListProductsRejectsBadPriceRange(t *testing.T) {
+	r := newTestRouter(NewMockProductRepository(t))
+	for _, query := range []string{"min_price=-1", "max_price=abc", "min_price=10&max_price=5"} {
+		if w := serve(r, http.MethodGet, "/v2/products?"+query, "", nil); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestBatchGetProducts(t *testing.T) {
+	repo := NewMockProductRepository(t,
+		Product{ID: 1, Name: "Desk", Price: 100},
+		Product{ID: 2, Name: "Lamp", Price: 20},
+		Product{ID: 3, Name: "Chair", Price: 50},
+	)
+	r := newTestRouter(repo)
+
+	tooMany := make([]string, 101)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprint(i + 1)
+	}
+	tests := []struct {
+		name        string
+		body        string
+		status      int
+		wantIDs     string
+		wantMissing string
+	}{
+		{"request order", `{"ids":[3,1,2]}`, http.StatusOK, "[3 1 2]", "[]"},
+		{"missing ids in request order", `{"ids":[9,2,7]}`, http.StatusOK, "[2]", "[9 7]"},
+		{"all missing", `{"ids":[8]}`, http.StatusOK, "[]", "[8]"},
+		{"duplicates", `{"ids":[1,1]}`, http.StatusUnprocessableEntity, "", ""},
+		{"too many", `{"ids":[` + strings.Join(tooMany, ",") + `]}`, http.StatusUnprocessableEntity, "", ""},
+		{"empty", `{"ids":[]}`, http.StatusUnprocessableEntity, "", ""},
+		{"zero id", `{"ids":[0]}`, http.StatusUnprocessableEntity, "", ""},
+		{"not JSON", `{"ids":`, http.StatusBadRequest, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodPost, "/v2/products/batch", tt.body, nil)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var got BatchGetResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if productIDs(got.Products) != tt.wantIDs || fmt.Sprint(got.MissingIDs) != tt.wantMissing {
+				t.Errorf("products %s, missing %v, want %s and %s", productIDs(got.Products), got.MissingIDs, tt.wantIDs, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestRebuildProducts(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		running   bool
+		status    int
+		wantStart int
+	}{
+		{"default size", "", false, http.StatusAccepted, DefaultRebuildProducts},
+		{"given size", "?n=500", false, http.StatusAccepted, 500},
+		{"already running", "?n=500", true, http.StatusConflict, 500},
+		{"too large", "?n=1000001", false, http.StatusBadRequest, 0},
+		{"not a number", "?n=lots", false, http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockProductRepository(t)
+			started := 0
+			repo.StartRebuildFunc = func(n int) bool {
+				started = n
+				return !tt.running
+			}
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			RegisterAdmin(r, NewHandlers(repo))
+
+			if w := serve(r, http.MethodGet, "/admin/products/rebuild"+tt.query, "", nil); w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if started != tt.wantStart {
+				t.Errorf("StartRebuild(%d), want %d", started, tt.wantStart)
+			}
+		})
+	}
+}
+
+func TestListChanges(t *testing.T) {
+	s := newSeededStore(2)
+	r := newTestRouter(s)
+	since := s.changes.start.Format(time.RFC3339Nano)
+	s.UpdateDetails(1, Product{Price: 5})
+	s.Delete(2)
+
+	var got struct {
+		Products  []ChangedProduct `json:"products"`
+		SyncToken string           `json:"sync_token"`
+	}
+	w := serve(r, http.MethodGet, "/v2/products/changes?since="+url.QueryEscape(since), "", nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("status = %d, err = %v: %s", w.Code, err, w.Body)
+	}
+	if changedIDs(got.Products) != "[1 2]" || got.Products[0].Deleted || !got.Products[1].Deleted {
+		t.Errorf("changes = %+v, want 1 updated and 2 deleted", got.Products)
+	}
+
+	// The sync token picks up where the last call left off
+	w = serve(r, http.MethodGet, "/v2/products/changes?since="+url.QueryEscape(got.SyncToken), "", nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || len(got.Products) != 0 {
+		t.Errorf("changes since the sync token = %s, want none", w.Body)
+	}
+
+	for _, tt := range []struct {
+		since  string
+		status int
+	}{
+		{"yesterday", http.StatusBadRequest},
+		{"", http.StatusBadRequest},
+		{"2000-01-01T00:00:00Z", http.StatusGone},
+	} {
+		if w := serve(r, http.MethodGet, "/v2/products/changes?since="+tt.since, "", nil); w.Code != tt.status {
+			t.Errorf("since=%q: status = %d, want %d", tt.since, w.Code, tt.status)
+		}
+	}
+}
+
+func TestGraphQL(t *testing.T) {
+	repo := NewMockProductRepository(t,
+		Product{ID: 1, Name: "Desk", Category: "Home", Price: 100},
+		Product{ID: 2, Name: "Desk lamp", Category: "Home", Price: 20},
+		Product{ID: 3, Name: "Phone", Category: "Electronics", Price: 500},
+	)
+	repo.SimilarProductsFunc = func(id int32, limit int) ([]Product, error) {
+		p, _ := repo.Get(3)
+		return []Product{p}, nil
+	}
+	h, err := NewGraphQLHandlers(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterGraphQL(r, h)
+
+	post := func(query string) string {
+		body, _ := json.Marshal(GraphQLRequest{Query: query})
+		return string(body)
+	}
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		want   string
+	}{
+		{"product", http.MethodPost, "/graphql", post(`{product(id: "2") {name price}}`), http.StatusOK,
+			`{"data":{"product":{"name":"Desk lamp","price":20}}}`},
+		{"missing product", http.MethodPost, "/graphql", post(`{product(id: "9") {name}}`), http.StatusOK,
+			`{"data":{"product":null}}`},
+		{"products page", http.MethodPost, "/graphql", post(`{products(name: "desk", page: 2, pageSize: 1) {totalFound page products {id}}}`), http.StatusOK,
+			`{"data":{"products":{"page":2,"products":[{"id":"2"}],"totalFound":2}}}`},
+		{"similar", http.MethodPost, "/graphql", post(`{product(id: "1") {similar(limit: 1) {name}}}`), http.StatusOK,
+			`{"data":{"product":{"similar":[{"name":"Phone"}]}}}`},
+		{"GET with variables", http.MethodGet, "/graphql?query=" + url.QueryEscape(`query($id: ID!) {product(id: $id) {name}}`) + "&variables=" + url.QueryEscape(`{"id":"3"}`), "", http.StatusOK,
+			`{"data":{"product":{"name":"Phone"}}}`},
+		{"too deep", http.MethodPost, "/graphql", post(`{product(id: "1") {similar {similar {similar {similar {similar {id}}}}}}}`), http.StatusBadRequest,
+			"query depth 7 exceeds the maximum of 5"},
+		{"too complex", http.MethodPost, "/graphql", post(`{products(pageSize: 100) {products {similar(limit: 50) {id name}}}}`), http.StatusBadRequest,
+			"exceeds the maximum of 1000"},
+		{"fragment cycle", http.MethodPost, "/graphql", post(`{product(id: "1") {...A}} fragment A on Product {similar {...A}}`), http.StatusBadRequest,
+			"fragment A spreads itself"},
+		{"no query", http.MethodPost, "/graphql", `{}`, http.StatusBadRequest, "query is required"},
+		{"schema", http.MethodGet, "/graphql-schema", "", http.StatusOK, "type Product {"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, tt.method, tt.path, tt.body, nil)
+			if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("status = %d, body = %s, want %d containing %s", w.Code, w.Body, tt.status, tt.want)
+			}
+		})
+	}
+}
+
+func TestProductVersions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewHandlers(NewMockProductRepository(t, Product{ID: 1, Name: "Desk", Brand: "Alpha", Price: 10}))
+	r := gin.New()
+	Register(r.Group("", middleware.APIVersion(), middleware.VersionMiddleware()), h)
+	Register(r.Group("/v1", middleware.PinVersion(1)), h)
+	Register(r.Group("/v2", middleware.PinVersion(2)), h)
+
+	tests := []struct {
+		name           string
+		path           string
+		header         http.Header
+		wantBrand      bool
+		wantDeprecated bool
+	}{
+		{"v2", "/v2/products/1", nil, true, false},
+		{"v1", "/v1/products/1", nil, false, false},
+		{"unversioned defaults to v1", "/products/1", nil, false, true},
+		{"unversioned v2 by query", "/products/1?api_version=2", nil, true, true},
+		{"unversioned v2 by Accept", "/products/1", http.Header{"Accept": {"application/vnd.api+json;version=2"}}, true, true},
+		{"v2 listing", "/v2/products?name=desk", nil, true, false},
+		{"v1 listing", "/v1/products?name=desk", nil, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodGet, tt.path, "", tt.header)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			if got := strings.Contains(w.Body.String(), `"brand":"Alpha"`); got != tt.wantBrand {
+				t.Errorf("brand in response = %v, want %v: %s", got, tt.wantBrand, w.Body)
+			}
+			if got := w.Header().Get("Deprecation") == "true"; got != tt.wantDeprecated {
+				t.Errorf("Deprecation header = %v, want %v", got, tt.wantDeprecated)
+			}
+		})
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewHandlers(NewMockProductRepository(t, Product{ID: 1, Name: "Desk", Price: 100}))
+	h.SetAdminAPIKey(testAdminKey)
+	r := gin.New()
+	r.Use(middleware.RequestID(), validate.Middleware())
+	Register(r.Group("/v2", middleware.PinVersion(2)), h)
+	admin := http.Header{middleware.AdminAPIKeyHeader: {testAdminKey}}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		header   http.Header
+		status   int
+		wantCode string
+	}{
+		{"missing product", http.MethodGet, "/v2/products/9", "", nil, http.StatusNotFound, response.ErrCodeProductNotFound},
+		{"malformed body", http.MethodPost, "/v2/products", `{"name":`, nil, http.StatusBadRequest, response.ErrCodeInvalidJSON},
+		{"bad query", http.MethodGet, "/v2/products?min_price=-1", "", nil, http.StatusBadRequest, response.ErrCodeInvalidRequest},
+		{"bad product id", http.MethodPost, "/v2/products/x/details", `{}`, nil, http.StatusBadRequest, response.ErrCodeInvalidProductID},
+		{"no admin key", http.MethodDelete, "/v2/products/1", "", nil, http.StatusUnauthorized, response.ErrCodeUnauthorized},
+		{"bad multiplier", http.MethodPatch, "/v2/products/price", `{"category":"Home","multiplier":20}`, admin, http.StatusBadRequest, response.ErrCodeInvalidMultiplier},
+		{"bad tiers", http.MethodPost, "/v2/products/1/pricing-tiers", `{"tiers":[{"min_quantity":0}]}`, admin, http.StatusBadRequest, response.ErrCodeInvalidPricingTiers},
+		{"caller's request id", http.MethodGet, "/v2/products/9", "", http.Header{middleware.RequestIDHeader: {"req-123"}}, http.StatusNotFound, response.ErrCodeProductNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, tt.method, tt.path, tt.body, tt.header)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			var got response.APIError
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Code != tt.wantCode || got.Message == "" {
+				t.Errorf("error = %+v, want code %s", got, tt.wantCode)
+			}
+			header := w.Header().Get(middleware.RequestIDHeader)
+			if header == "" || got.RequestID != header {
+				t.Errorf("request_id = %q, X-Request-ID = %q", got.RequestID, header)
+			}
+			if want := tt.header.Get(middleware.RequestIDHeader); want != "" && header != want {
+				t.Errorf("X-Request-ID = %q, want the caller's %q", header, want)
+			}
+		})
+	}
+}
+
+func TestContentNegotiation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewHandlers(NewMockProductRepository(t,
+		Product{ID: 1, Name: "Desk", Category: "Home", Brand: "Alpha", Price: 99.5},
+		Product{ID: 2, Name: "Lamp", Category: "Home", Brand: "Beta", Price: 12},
+	))
+	r := gin.New()
+	r.Use(middleware.ContentNegotiation())
+	Register(r.Group("/v2", middleware.PinVersion(2)), h)
+
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+	}{
+		{"default", "", "application/json; charset=utf-8"},
+		{"msgpack", "application/msgpack", "application/msgpack; charset=utf-8"},
+		{"preferred by q", "application/json;q=0.5, application/msgpack", "application/msgpack; charset=utf-8"},
+		{"csv", "text/csv", "text/csv; charset=utf-8"},
+		{"unsupported falls back to JSON", "text/html", "application/json; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodGet, "/v2/products?category=home", "", http.Header{"Accept": {tt.accept}})
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.contentType {
+				t.Fatalf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			var got SearchResponse
+			switch {
+			case strings.HasPrefix(tt.contentType, "application/msgpack"):
+				if err := codec.NewDecoderBytes(w.Body.Bytes(), new(codec.MsgpackHandle)).Decode(&got); err != nil {
+					t.Fatalf("decoding msgpack: %v", err)
+				}
+			case strings.HasPrefix(tt.contentType, "text/csv"):
+				if lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n"); len(lines) != 3 || !strings.Contains(lines[1], "Desk") {
+					t.Errorf("CSV = %q, want a header and 2 rows", w.Body)
+				}
+				return
+			default:
+				if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got.TotalFound != 2 || len(got.Products) != 2 {
+				t.Fatalf("decoded %+v, want 2 products", got)
+			}
+			if p := got.Products[0]; p.ID != 1 || p.Name != "Desk" || p.Brand != "Alpha" || p.Price != 99.5 {
+				t.Errorf("product = %+v, want the Desk", p)
+			}
+		})
+	}
+}
+
+func equalIDs(a, b []int32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMetadataChangesRequireAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	admin := http.Header{middleware.AdminAPIKeyHeader: {testAdminKey}}
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		header   http.Header
+		adminKey string
+		status   int
+	}{
+		{"set", http.MethodPut, `{"value":"4006381333931"}`, admin, testAdminKey, http.StatusOK},
+		{"delete", http.MethodDelete, "", admin, testAdminKey, http.StatusNoContent},
+		{"set without a key", http.MethodPut, `{"value":"0"}`, nil, testAdminKey, http.StatusUnauthorized},
+		{"delete with the wrong key", http.MethodDelete, "", http.Header{middleware.AdminAPIKeyHeader: {"guess"}}, testAdminKey, http.StatusUnauthorized},
+		{"set with the admin API disabled", http.MethodPut, `{"value":"0"}`, admin, "", http.StatusForbidden},
+		{"delete with the admin API disabled", http.MethodDelete, "", admin, "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := false
+			repo := NewMockProductRepository(t, Product{ID: 1, Name: "Desk"})
+			repo.SetMetadataFunc = func(int32, string, string) error { changed = true; return nil }
+			repo.DeleteMetadataFunc = func(int32, string) error { changed = true; return nil }
+			h := NewHandlers(repo)
+			h.SetAdminAPIKey(tt.adminKey)
+			r := gin.New()
+			r.Use(validate.Middleware())
+			Register(r.Group("/v2", middleware.PinVersion(2)), h)
+
+			w := serve(r, tt.method, "/v2/products/1/metadata/ean", tt.body, tt.header)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if ok := w.Code < http.StatusBadRequest; changed != ok {
+				t.Errorf("metadata changed = %v after status %d", changed, w.Code)
+			}
+		})
+	}
+}
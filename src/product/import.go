@@ -0,0 +1,151 @@
+package product
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/main/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxImportBytes caps the size of an uploaded import file.
+	maxImportBytes = 10 << 20
+	// importBatchSize is how many valid rows are buffered before calling BulkCreate.
+	importBatchSize = 500
+)
+
+// csvImportColumns is the required header row of a CSV import.
+var csvImportColumns = []string{"name", "price", "category", "description", "brand"}
+
+// POST /admin/products/import
+//
+// Accepts multipart/form-data with a "file" part holding a CSV whose first row
+// is the header name,price,category,description,brand. The file is parsed as
+// it streams in; valid rows are created in batches and invalid rows are
+// reported by row number (the header is row 1).
+func (h *Handlers) ImportCSV(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+	mr, err := c.Request.MultipartReader()
+	if err != nil {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "expected multipart/form-data body", nil)
+		return
+	}
+
+	var file io.Reader
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			importReadError(c, err)
+			return
+		}
+		if part.FormName() == "file" {
+			file = part
+			break
+		}
+	}
+	if file == nil {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "missing file part", nil)
+		return
+	}
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = len(csvImportColumns)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil || !isImportHeader(header) {
+		response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "first row must be the header "+strings.Join(csvImportColumns, ","), nil)
+		return
+	}
+
+	summary := ImportSummary{Errors: []RowError{}}
+	batch := make([]Product, 0, importBatchSize)
+	flush := func() {
+		summary.Imported += len(h.store.BulkCreate(batch))
+		batch = batch[:0]
+	}
+
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				importReadError(c, err)
+				return
+			}
+			summary.reject(row, parseErr.Err.Error())
+			continue
+		}
+
+		p, msg := productFromCSV(record)
+		if msg != "" {
+			summary.reject(row, msg)
+			continue
+		}
+		batch = append(batch, p)
+		if len(batch) == importBatchSize {
+			flush()
+		}
+	}
+	flush()
+
+	c.JSON(http.StatusOK, summary)
+}
+
+func (s *ImportSummary) reject(row int, message string) {
+	s.Skipped++
+	s.Errors = append(s.Errors, RowError{Row: row, Message: message})
+}
+
+func isImportHeader(record []string) bool {
+	if len(record) != len(csvImportColumns) {
+		return false
+	}
+	for i, col := range csvImportColumns {
+		if !strings.EqualFold(strings.TrimSpace(record[i]), col) {
+			return false
+		}
+	}
+	return true
+}
+
+// productFromCSV converts a record in csvImportColumns order, returning a
+// non-empty message when the row is invalid.
+func productFromCSV(record []string) (Product, string) {
+	name := strings.TrimSpace(record[0])
+	if name == "" || len(name) > 100 {
+		return Product{}, "invalid name"
+	}
+	price, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+	if err != nil || price < 0 {
+		return Product{}, "invalid price"
+	}
+	return Product{
+		Name:              name,
+		Price:             price,
+		Category:          strings.TrimSpace(record[2]),
+		Description:       strings.TrimSpace(record[3]),
+		Brand:             strings.TrimSpace(record[4]),
+		LowStockThreshold: DefaultLowStockThreshold,
+	}, ""
+}
+
+func importReadError(c *gin.Context, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		response.WriteError(c, http.StatusRequestEntityTooLarge, response.ErrCodeFileTooLarge, "file exceeds 10 MB limit", nil)
+		return
+	}
+	response.WriteError(c, http.StatusBadRequest, response.ErrCodeInvalidRequest, "failed to read upload", nil)
+}
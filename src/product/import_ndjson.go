@@ -0,0 +1,134 @@
+package product
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/main/validate"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+const (
+	// ndjsonMaxLine is the longest line the NDJSON import accepts.
+	ndjsonMaxLine = 1 << 20
+	// ndjsonProgressEvery is how many lines pass between progress updates.
+	ndjsonProgressEvery = 1000
+	// ndjsonExportPage is how many products are copied out of the store at a time.
+	ndjsonExportPage = 1000
+)
+
+// POST /admin/products/import/ndjson
+//
+// Accepts a JSON Lines body with one product object per line (the format
+// written by the NDJSON export). Lines are read as they stream in, validated
+// like POST /products, and valid products are created in batches. The
+// response is itself NDJSON: an ImportProgress line every 1000 input lines
+// and a final one with Done set. Lines are numbered from 1; blank lines are
+// skipped.
+func (h *Handlers) ImportNDJSON(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+	scanner := bufio.NewScanner(c.Request.Body)
+	scanner.Buffer(make([]byte, 0, 64<<10), ndjsonMaxLine)
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+	progress := ImportProgress{RowErrors: []RowError{}}
+	batch := make([]Product, 0, importBatchSize)
+	flush := func() {
+		progress.Imported += len(h.store.BulkCreate(batch))
+		batch = batch[:0]
+	}
+	report := func() {
+		enc.Encode(ImportProgress{Processed: progress.Processed, Imported: progress.Imported, Errors: progress.Errors})
+		c.Writer.Flush()
+	}
+
+	for line := 1; scanner.Scan(); line++ {
+		raw := scanner.Bytes()
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+		progress.Processed++
+		p, msg := productFromJSON(raw)
+		if msg != "" {
+			progress.Errors++
+			progress.RowErrors = append(progress.RowErrors, RowError{Row: line, Message: msg})
+		} else {
+			batch = append(batch, p)
+			if len(batch) == importBatchSize {
+				flush()
+			}
+		}
+		if progress.Processed%ndjsonProgressEvery == 0 {
+			flush()
+			report()
+		}
+	}
+	flush()
+
+	if err := scanner.Err(); err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			progress.Error = "file exceeds 10 MB limit"
+		case errors.Is(err, bufio.ErrTooLong):
+			progress.Error = "line exceeds 1 MB limit"
+		default:
+			progress.Error = "failed to read upload"
+		}
+	}
+	progress.Done = true
+	enc.Encode(progress)
+}
+
+// productFromJSON decodes and validates one import line, returning a
+// non-empty message when it is invalid.
+func productFromJSON(raw []byte) (Product, string) {
+	var req CreateProductRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return Product{}, "invalid JSON"
+	}
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		fields := validate.Errors(err)
+		if len(fields) == 0 {
+			return Product{}, err.Error()
+		}
+		msgs := make([]string, len(fields))
+		for i, fe := range fields {
+			msgs[i] = fmt.Sprintf("%s %s", fe.Field, fe.Message)
+		}
+		return Product{}, strings.Join(msgs, "; ")
+	}
+	return req.Product(), ""
+}
+
+// GET /admin/products/export/ndjson
+//
+// Streams the whole catalog as JSON Lines in ID order.
+func (h *Handlers) ExportNDJSON(c *gin.Context) {
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="products.ndjson"`)
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+	var after int32
+	for {
+		page := h.store.ListAfter(after, ndjsonExportPage)
+		if len(page) == 0 {
+			return
+		}
+		for _, p := range page {
+			if err := enc.Encode(p); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+		after = page[len(page)-1].ID
+	}
+}
@@ -0,0 +1,184 @@
+package product
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// ErrInsufficientStock is returned when a decrement would take stock below
+// zero for a product that is not on pre-order.
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// ErrProductNotFound is returned by stock operations on unknown products.
+var ErrProductNotFound = errors.New("product not found")
+
+// ErrPartialReservation is wrapped by *ReservationError when a batch
+// reservation fails; no stock is reserved in that case.
+var ErrPartialReservation = errors.New("batch reservation failed; nothing was reserved")
+
+const (
+	// MaxReservationItems bounds a single POST /admin/inventory/reserve body.
+	MaxReservationItems = 200
+	// ReservationTTL is how long reserved stock is held before it is returned.
+	ReservationTTL = 15 * time.Minute
+)
+
+// ReservationItem is one product line of a batch reservation.
+type ReservationItem struct {
+	ProductID int32 `json:"product_id"`
+	Quantity  int   `json:"quantity"`
+}
+
+// Reservation holds stock taken out of the catalog until it is released or expires.
+type Reservation struct {
+	ID        string            `json:"reservation_id"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	Reserved  []ReservationItem `json:"reserved"`
+}
+
+// ReservationError lists the product IDs that made a batch reservation fail.
+type ReservationError struct {
+	Missing      []int32 `json:"missing_product_ids,omitempty"`
+	Insufficient []int32 `json:"insufficient_stock_product_ids,omitempty"`
+}
+
+func (e *ReservationError) Error() string {
+	return fmt.Sprintf("%v (missing: %v, insufficient stock: %v)", ErrPartialReservation, e.Missing, e.Insufficient)
+}
+
+func (e *ReservationError) Unwrap() error { return ErrPartialReservation }
+
+// BatchReserveStock decrements stock for every item under a single write
+// lock. Quantities for repeated product IDs are summed. If any product is
+// missing or short of stock (pre-order products never are), nothing is
+// decremented and a *ReservationError is returned.
+func (s *Store) BatchReserveStock(items []ReservationItem) ([]ReservationItem, error) {
+	totals := make(map[int32]int, len(items))
+	for _, item := range items {
+		totals[item.ProductID] += item.Quantity
+	}
+	reserved := make([]ReservationItem, 0, len(totals))
+	for id, qty := range totals {
+		reserved = append(reserved, ReservationItem{ProductID: id, Quantity: qty})
+	}
+	sort.Slice(reserved, func(i, j int) bool { return reserved[i].ProductID < reserved[j].ProductID })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var failed ReservationError
+	for _, item := range reserved {
+		p, ok := s.products[item.ProductID]
+		switch {
+		case !ok:
+			failed.Missing = append(failed.Missing, item.ProductID)
+		case !p.canDecrement(item.Quantity):
+			failed.Insufficient = append(failed.Insufficient, item.ProductID)
+		}
+	}
+	if len(failed.Missing) > 0 || len(failed.Insufficient) > 0 {
+		return nil, &failed
+	}
+	for _, item := range reserved {
+		p := s.products[item.ProductID]
+		p.Stock -= item.Quantity
+		s.products[item.ProductID] = p
+		s.publishStock(p.ID, p.Stock+item.Quantity, p.Stock)
+		s.checkLowStock(p, p.Stock+item.Quantity)
+	}
+	return reserved, nil
+}
+
+// DecrementStock takes by units from a product's stock. Pre-order products
+// may go below zero. Crossing the product's LowStockThreshold raises a
+// LowStockEvent.
+func (s *Store) DecrementStock(id int32, by int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.products[id]
+	if !ok {
+		return ErrProductNotFound
+	}
+	if !p.canDecrement(by) {
+		return ErrInsufficientStock
+	}
+	p.Stock -= by
+	s.products[id] = p
+	s.publishStock(id, p.Stock+by, p.Stock)
+	s.checkLowStock(p, p.Stock+by)
+	return nil
+}
+
+// RestoreStock adds reserved quantities back. Products deleted since the
+// reservation are skipped.
+func (s *Store) RestoreStock(items []ReservationItem) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, item := range items {
+		if p, ok := s.products[item.ProductID]; ok {
+			p.Stock += item.Quantity
+			s.products[item.ProductID] = p
+			s.publishStock(p.ID, p.Stock-item.Quantity, p.Stock)
+		}
+	}
+}
+
+// Reserve runs BatchReserveStock and records the result as a reservation
+// that expires after ReservationTTL.
+func (s *Store) Reserve(items []ReservationItem) (*Reservation, error) {
+	reserved, err := s.BatchReserveStock(items)
+	if err != nil {
+		return nil, err
+	}
+	r := &Reservation{ID: newReservationID(), ExpiresAt: time.Now().Add(ReservationTTL).UTC(), Reserved: reserved}
+	s.reservations.Store(r.ID, r)
+	return r, nil
+}
+
+// ReleaseReservation returns a reservation's stock to the catalog. It reports
+// false if the reservation is unknown, already released or expired.
+func (s *Store) ReleaseReservation(id string) (*Reservation, bool) {
+	value, ok := s.reservations.LoadAndDelete(id)
+	if !ok {
+		return nil, false
+	}
+	r := value.(*Reservation)
+	s.RestoreStock(r.Reserved)
+	return r, true
+}
+
+// ExpireReservationsEvery releases expired reservations in the background.
+func (s *Store) ExpireReservationsEvery(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			if n := s.expireReservations(time.Now()); n > 0 {
+				log.Printf("Released %d expired inventory reservations\n", n)
+			}
+		}
+	}()
+}
+
+func (s *Store) expireReservations(now time.Time) int {
+	expired := 0
+	s.reservations.Range(func(key, value any) bool {
+		if value.(*Reservation).ExpiresAt.Before(now) {
+			if _, ok := s.ReleaseReservation(key.(string)); ok {
+				expired++
+			}
+		}
+		return true
+	})
+	return expired
+}
+
+// newReservationID returns a random (version 4) UUID.
+func newReservationID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,79 @@
+package product
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultLowStockThreshold applies when a product is created without one.
+	DefaultLowStockThreshold = 10
+	// stockAlertQueue buffers low stock events until they are published.
+	stockAlertQueue = 1000
+)
+
+// LowStockEvent is raised when a product's stock falls to or below its
+// LowStockThreshold.
+type LowStockEvent struct {
+	ProductID    int32     `json:"product_id"`
+	CurrentStock int       `json:"current_stock"`
+	Threshold    int       `json:"threshold"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// StockAlertBus queues low stock events for a single consumer. Publishing
+// never blocks; events are dropped with a warning when the queue is full.
+type StockAlertBus struct {
+	ch       chan LowStockEvent
+	consumed atomic.Bool
+}
+
+func NewStockAlertBus() *StockAlertBus {
+	return &StockAlertBus{ch: make(chan LowStockEvent, stockAlertQueue)}
+}
+
+// Publish queues e. It is a no-op until Events has been called, so stores
+// without a consumer do not fill the queue.
+func (b *StockAlertBus) Publish(e LowStockEvent) {
+	if !b.consumed.Load() {
+		return
+	}
+	select {
+	case b.ch <- e:
+	default:
+		log.Printf("WARNING: Low stock alert queue full, dropping alert for product %d\n", e.ProductID)
+	}
+}
+
+// Events returns the channel of queued events.
+func (b *StockAlertBus) Events() <-chan LowStockEvent {
+	b.consumed.Store(true)
+	return b.ch
+}
+
+// StockAlerts returns the bus the store raises low stock events on.
+func (s *Store) StockAlerts() *StockAlertBus {
+	return s.alerts
+}
+
+// checkLowStock raises a LowStockEvent when a decrement takes p from above
+// its threshold to at or below it; callers hold s.mu.
+func (s *Store) checkLowStock(p Product, oldStock int) {
+	if oldStock > p.LowStockThreshold && p.Stock <= p.LowStockThreshold {
+		s.alerts.Publish(LowStockEvent{ProductID: p.ID, CurrentStock: p.Stock, Threshold: p.LowStockThreshold, Timestamp: time.Now().UTC()})
+	}
+}
+
+// LowStock returns every product at or below its threshold, in ID order.
+func (s *Store) LowStock() []Product {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []Product{}
+	for _, id := range s.sortedKeys {
+		if p := s.products[id]; p.Stock <= p.LowStockThreshold {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,123 @@
+package product
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+// SNSPublisher is the part of the SNS API LowStockPublisher uses;
+// *sns.SNS implements it.
+type SNSPublisher interface {
+	Publish(*sns.PublishInput) (*sns.PublishOutput, error)
+}
+
+// LowStockPublisher sends low stock events to an SNS topic with at-least-once
+// delivery: events SNS rejects are appended to a local spool file (one JSON
+// event per line) and retried until they are accepted.
+type LowStockPublisher struct {
+	client    SNSPublisher
+	topicARN  string
+	spoolPath string
+
+	// mu serialises access to the spool file
+	mu sync.Mutex
+}
+
+func NewLowStockPublisher(client SNSPublisher, topicARN, spoolPath string) *LowStockPublisher {
+	return &LowStockPublisher{client: client, topicARN: topicARN, spoolPath: spoolPath}
+}
+
+// Run publishes events from bus in the background and retries the spool
+// every retryInterval, starting with anything left from a previous run.
+func (p *LowStockPublisher) Run(bus *StockAlertBus, retryInterval time.Duration) {
+	events := bus.Events()
+	go func() {
+		for e := range events {
+			if err := p.publish(e); err != nil {
+				log.Printf("WARNING: Failed to publish low stock alert for product %d, spooling: %v\n", e.ProductID, err)
+				if err := p.spool(e); err != nil {
+					log.Printf("ERROR: Failed to spool low stock alert for product %d: %v\n", e.ProductID, err)
+				}
+			}
+		}
+	}()
+	go func() {
+		for {
+			if err := p.retrySpool(); err != nil {
+				log.Printf("ERROR: Low stock spool retry failed: %v\n", err)
+			}
+			time.Sleep(retryInterval)
+		}
+	}()
+}
+
+func (p *LowStockPublisher) publish(e LowStockEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = p.client.Publish(&sns.PublishInput{
+		TopicArn: aws.String(p.topicARN),
+		Message:  aws.String(string(body)),
+		Subject:  aws.String(fmt.Sprintf("Low stock: product %d", e.ProductID)),
+	})
+	return err
+}
+
+func (p *LowStockPublisher) spool(e LowStockEvent) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f, err := os.OpenFile(p.spoolPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// retrySpool republishes spooled events, keeping only those that fail again.
+func (p *LowStockPublisher) retrySpool() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	data, err := os.ReadFile(p.spoolPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var remaining bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var e LowStockEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			log.Printf("WARNING: Dropping unreadable low stock spool entry: %v\n", err)
+			continue
+		}
+		if err := p.publish(e); err != nil {
+			remaining.Write(scanner.Bytes())
+			remaining.WriteByte('\n')
+		}
+	}
+	if remaining.Len() == 0 {
+		return os.Remove(p.spoolPath)
+	}
+	return os.WriteFile(p.spoolPath, remaining.Bytes(), 0o644)
+}
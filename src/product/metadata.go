@@ -0,0 +1,93 @@
+package product
+
+import (
+	"errors"
+	"maps"
+	"regexp"
+)
+
+const (
+	// MaxMetadataKeyLength is the longest metadata key accepted.
+	MaxMetadataKeyLength = 64
+	// MaxMetadataValueBytes is the largest metadata value accepted.
+	MaxMetadataValueBytes = 1024
+)
+
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+var (
+	ErrInvalidMetadataKey    = errors.New("metadata key must be 1-64 letters, digits or underscores")
+	ErrMetadataValueTooLarge = errors.New("metadata value must be at most 1024 bytes")
+	ErrMetadataNotFound      = errors.New("metadata key not found")
+)
+
+// ValidateMetadata checks a key/value pair against the metadata limits.
+func ValidateMetadata(key, value string) error {
+	if len(key) > MaxMetadataKeyLength || !metadataKeyPattern.MatchString(key) {
+		return ErrInvalidMetadataKey
+	}
+	if len(value) > MaxMetadataValueBytes {
+		return ErrMetadataValueTooLarge
+	}
+	return nil
+}
+
+// SetMetadata stores key=value on the product. The map is copied on write
+// so products already handed out are never modified.
+func (s *Store) SetMetadata(id int32, key, value string) error {
+	if err := ValidateMetadata(key, value); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.products[id]
+	if !ok {
+		return ErrProductNotFound
+	}
+	metadata := make(map[string]string, len(p.Metadata)+1)
+	maps.Copy(metadata, p.Metadata)
+	metadata[key] = value
+	p.Metadata = metadata
+	s.products[id] = s.touch(p)
+	return nil
+}
+
+// GetMetadata returns the value stored under key, reporting false when the
+// product or key does not exist.
+func (s *Store) GetMetadata(id int32, key string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.products[id].Metadata[key]
+	return value, ok
+}
+
+// DeleteMetadata removes key from the product.
+func (s *Store) DeleteMetadata(id int32, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.products[id]
+	if !ok {
+		return ErrProductNotFound
+	}
+	if _, ok := p.Metadata[key]; !ok {
+		return ErrMetadataNotFound
+	}
+	metadata := maps.Clone(p.Metadata)
+	delete(metadata, key)
+	if len(metadata) == 0 {
+		metadata = nil
+	}
+	p.Metadata = metadata
+	s.products[id] = s.touch(p)
+	return nil
+}
+
+// metadataMatches reports whether p has every key/value pair in want.
+func metadataMatches(p Product, want map[string]string) bool {
+	for k, v := range want {
+		if got, ok := p.Metadata[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,347 @@
+package product
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// MockProductRepository is an in-memory ProductRepository for handler tests.
+// It implements lookups, writes and searches over a plain map and records
+// the filters searches were given. Every other method calls its Func field;
+// calling one whose field is unset fails the test.
+type MockProductRepository struct {
+	t *testing.T
+
+	mu       sync.Mutex
+	products map[int32]Product
+	nextID   int32
+	// InUse holds the IDs ProductInUse reports as in use.
+	InUse map[int32]bool
+	// Filters records the ProductFilter of every search, in order.
+	Filters []ProductFilter
+
+	GetChangedSinceFunc       func(since time.Time) ([]ChangedProduct, time.Time, error)
+	GetMetadataFunc           func(id int32, key string) (string, bool)
+	SetMetadataFunc           func(id int32, key, value string) error
+	DeleteMetadataFunc        func(id int32, key string) error
+	SimilarProductsFunc       func(id int32, limit int) ([]Product, error)
+	PriceExperimentsFunc      func() PriceExperimentRegistry
+	GetBundleFunc             func(id int32) (Bundle, bool)
+	ListBundlesFunc           func() []Bundle
+	CreateValidatedBundleFunc func(b Bundle) (Bundle, error)
+	ComponentTotalFunc        func(b Bundle) float64
+	ReserveFunc               func(items []ReservationItem) (*Reservation, error)
+	ReleaseReservationFunc    func(id string) (*Reservation, bool)
+	LowStockFunc              func() []Product
+	StockEventsFunc           func() StockEventSubscriber
+	StartRebuildFunc          func(n int) bool
+	RebuildStatusFunc         func() RebuildStatus
+	TopSearchesFunc           func(limit int) []SearchEntry
+	CacheStatsFunc            func() CacheStats
+}
+
+var _ ProductRepository = (*MockProductRepository)(nil)
+
+func NewMockProductRepository(t *testing.T, products ...Product) *MockProductRepository {
+	m := &MockProductRepository{t: t, products: make(map[int32]Product), InUse: make(map[int32]bool)}
+	for _, p := range products {
+		m.products[p.ID] = p
+		m.nextID = max(m.nextID, p.ID)
+	}
+	return m
+}
+
+// unstubbed fails the test for a call to a method whose Func field is unset.
+func (m *MockProductRepository) unstubbed(method string) {
+	m.t.Helper()
+	m.t.Fatalf("MockProductRepository.%s called without %sFunc set", method, method)
+}
+
+func (m *MockProductRepository) Get(id int32) (Product, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.products[id]
+	return p, ok
+}
+
+func (m *MockProductRepository) GetMany(ids []int32) (map[int32]Product, []int32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	found := make(map[int32]Product, len(ids))
+	var missing []int32
+	for _, id := range ids {
+		if p, ok := m.products[id]; ok {
+			found[id] = p
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	return found, missing
+}
+
+func (m *MockProductRepository) GetBySlug(slug string) (Product, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.products {
+		if p.Slug == slug {
+			return p, true
+		}
+	}
+	return Product{}, false
+}
+
+func (m *MockProductRepository) ListAfter(after int32, limit int) []Product {
+	page := m.search("", "", ProductFilter{}, func(p Product) bool { return p.ID > after })
+	return page[:min(len(page), limit)]
+}
+
+func (m *MockProductRepository) Create(incoming Product) Product {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	incoming.ID = m.nextID
+	m.products[incoming.ID] = incoming
+	return incoming
+}
+
+func (m *MockProductRepository) BulkCreate(incoming []Product) []Product {
+	created := make([]Product, 0, len(incoming))
+	for _, p := range incoming {
+		created = append(created, m.Create(p))
+	}
+	return created
+}
+
+func (m *MockProductRepository) UpdateDetails(id int32, incoming Product) (Product, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.products[id]; !ok {
+		return Product{}, false
+	}
+	incoming.ID = id
+	m.products[id] = incoming
+	return incoming, true
+}
+
+func (m *MockProductRepository) Delete(id int32) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.products[id]
+	delete(m.products, id)
+	return ok
+}
+
+func (m *MockProductRepository) SetPricingTiers(id int32, tiers []PricingTier) (Product, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.products[id]
+	if !ok {
+		return Product{}, false
+	}
+	p.PricingTiers = append([]PricingTier(nil), tiers...)
+	m.products[id] = p
+	return p, true
+}
+
+func (m *MockProductRepository) ProductInUse(id int32) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.InUse[id]
+}
+
+func (m *MockProductRepository) GetPriceForExperiment(productID int32, customerID int) float64 {
+	p, _ := m.Get(productID)
+	return p.Price
+}
+
+func (m *MockProductRepository) SearchLimitedWhere(nameFilter, categoryFilter string, filter ProductFilter, where func(Product) bool, maxCheck, maxReturn int) ([]Product, int) {
+	matches := m.search(nameFilter, categoryFilter, filter, where)
+	matches = matches[:min(len(matches), maxCheck)]
+	return matches[:min(len(matches), maxReturn)], len(matches)
+}
+
+func (m *MockProductRepository) SearchPageWhere(nameFilter, categoryFilter string, filter ProductFilter, where func(Product) bool, afterID int32, limit int) ([]Product, bool) {
+	matches := m.search(nameFilter, categoryFilter, filter, where)
+	i := sort.Search(len(matches), func(i int) bool { return matches[i].ID > afterID })
+	page := matches[i:min(i+limit, len(matches))]
+	return page, i+limit < len(matches)
+}
+
+// search returns the matching products in ID order and records filter.
+func (m *MockProductRepository) search(nameFilter, categoryFilter string, filter ProductFilter, where func(Product) bool) []Product {
+	match := searchMatcher(nameFilter, categoryFilter, filter, where)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Filters = append(m.Filters, filter)
+	var matches []Product
+	for _, p := range m.products {
+		if match(p) {
+			matches = append(matches, p)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+	return matches
+}
+
+// SameCategory and SameBrand recommend nothing; NewHandlers needs them for
+// its default experiment.
+func (m *MockProductRepository) SameCategory() Algorithm { return noRecommendations }
+func (m *MockProductRepository) SameBrand() Algorithm    { return noRecommendations }
+
+func noRecommendations(context.Context, int32, int) []Product { return nil }
+
+func (m *MockProductRepository) CountMatching(q ProductQuery) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count := 0
+	for _, p := range m.products {
+		if q.Matches(p) {
+			count++
+		}
+	}
+	return count
+}
+
+func (m *MockProductRepository) BulkUpdatePrice(q ProductQuery, multiplier float64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	updated := 0
+	for id, p := range m.products {
+		if q.Matches(p) {
+			p.Price = math.Round(p.Price*multiplier*100) / 100
+			m.products[id] = p
+			updated++
+		}
+	}
+	return updated, nil
+}
+
+func (m *MockProductRepository) GetChangedSince(since time.Time) ([]ChangedProduct, time.Time, error) {
+	if m.GetChangedSinceFunc == nil {
+		m.unstubbed("GetChangedSince")
+	}
+	return m.GetChangedSinceFunc(since)
+}
+
+func (m *MockProductRepository) GetMetadata(id int32, key string) (string, bool) {
+	if m.GetMetadataFunc == nil {
+		m.unstubbed("GetMetadata")
+	}
+	return m.GetMetadataFunc(id, key)
+}
+
+func (m *MockProductRepository) SetMetadata(id int32, key, value string) error {
+	if m.SetMetadataFunc == nil {
+		m.unstubbed("SetMetadata")
+	}
+	return m.SetMetadataFunc(id, key, value)
+}
+
+func (m *MockProductRepository) DeleteMetadata(id int32, key string) error {
+	if m.DeleteMetadataFunc == nil {
+		m.unstubbed("DeleteMetadata")
+	}
+	return m.DeleteMetadataFunc(id, key)
+}
+
+func (m *MockProductRepository) SimilarProducts(id int32, limit int) ([]Product, error) {
+	if m.SimilarProductsFunc == nil {
+		m.unstubbed("SimilarProducts")
+	}
+	return m.SimilarProductsFunc(id, limit)
+}
+
+func (m *MockProductRepository) PriceExperiments() PriceExperimentRegistry {
+	if m.PriceExperimentsFunc == nil {
+		m.unstubbed("PriceExperiments")
+	}
+	return m.PriceExperimentsFunc()
+}
+
+func (m *MockProductRepository) GetBundle(id int32) (Bundle, bool) {
+	if m.GetBundleFunc == nil {
+		m.unstubbed("GetBundle")
+	}
+	return m.GetBundleFunc(id)
+}
+
+func (m *MockProductRepository) ListBundles() []Bundle {
+	if m.ListBundlesFunc == nil {
+		m.unstubbed("ListBundles")
+	}
+	return m.ListBundlesFunc()
+}
+
+func (m *MockProductRepository) CreateValidatedBundle(b Bundle) (Bundle, error) {
+	if m.CreateValidatedBundleFunc == nil {
+		m.unstubbed("CreateValidatedBundle")
+	}
+	return m.CreateValidatedBundleFunc(b)
+}
+
+func (m *MockProductRepository) ComponentTotal(b Bundle) float64 {
+	if m.ComponentTotalFunc == nil {
+		m.unstubbed("ComponentTotal")
+	}
+	return m.ComponentTotalFunc(b)
+}
+
+func (m *MockProductRepository) Reserve(items []ReservationItem) (*Reservation, error) {
+	if m.ReserveFunc == nil {
+		m.unstubbed("Reserve")
+	}
+	return m.ReserveFunc(items)
+}
+
+func (m *MockProductRepository) ReleaseReservation(id string) (*Reservation, bool) {
+	if m.ReleaseReservationFunc == nil {
+		m.unstubbed("ReleaseReservation")
+	}
+	return m.ReleaseReservationFunc(id)
+}
+
+func (m *MockProductRepository) LowStock() []Product {
+	if m.LowStockFunc == nil {
+		m.unstubbed("LowStock")
+	}
+	return m.LowStockFunc()
+}
+
+func (m *MockProductRepository) StockEvents() StockEventSubscriber {
+	if m.StockEventsFunc == nil {
+		m.unstubbed("StockEvents")
+	}
+	return m.StockEventsFunc()
+}
+
+func (m *MockProductRepository) StartRebuild(n int) bool {
+	if m.StartRebuildFunc == nil {
+		m.unstubbed("StartRebuild")
+	}
+	return m.StartRebuildFunc(n)
+}
+
+func (m *MockProductRepository) RebuildStatus() RebuildStatus {
+	if m.RebuildStatusFunc == nil {
+		m.unstubbed("RebuildStatus")
+	}
+	return m.RebuildStatusFunc()
+}
+
+func (m *MockProductRepository) TopSearches(limit int) []SearchEntry {
+	if m.TopSearchesFunc == nil {
+		m.unstubbed("TopSearches")
+	}
+	return m.TopSearchesFunc(limit)
+}
+
+func (m *MockProductRepository) CacheStats() CacheStats {
+	if m.CacheStatsFunc == nil {
+		m.unstubbed("CacheStats")
+	}
+	return m.CacheStatsFunc()
+}
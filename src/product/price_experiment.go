@@ -0,0 +1,287 @@
+package product
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Price experiment variant names.
+const (
+	VariantControl   = "control"
+	VariantTreatment = "treatment"
+)
+
+// SignificanceLevel is the p-value below which a price experiment's
+// difference in conversion rates is reported as significant.
+const SignificanceLevel = 0.05
+
+var (
+	ErrPriceExperimentNotFound = errors.New("price experiment not found")
+	ErrInvalidPriceExperiment  = errors.New("price experiment must end after it starts and use multipliers between 0.01 and 10.0")
+	ErrPriceExperimentOverlap  = errors.New("a product is already in a price experiment running at the same time")
+)
+
+// PriceExperiment tests how price affects conversion: while it runs,
+// customers assigned to the treatment arm (TrafficSplit of them) see
+// TreatmentMultiplier × price for ProductIDs and the rest see
+// ControlMultiplier × price.
+type PriceExperiment struct {
+	ID                  string    `json:"id" binding:"required"`
+	ProductIDs          []int32   `json:"product_ids" binding:"required,min=1,unique,dive,gte=1"`
+	ControlMultiplier   float64   `json:"control_multiplier" binding:"required"`
+	TreatmentMultiplier float64   `json:"treatment_multiplier" binding:"required"`
+	TrafficSplit        float64   `json:"traffic_split" binding:"gte=0,lte=1"`
+	StartAt             time.Time `json:"start_at" binding:"required"`
+	EndAt               time.Time `json:"end_at" binding:"required"`
+}
+
+// Running reports whether the experiment is live at t.
+func (e *PriceExperiment) Running(t time.Time) bool {
+	return !t.Before(e.StartAt) && t.Before(e.EndAt)
+}
+
+// Variant deterministically assigns a customer to control or treatment.
+func (e *PriceExperiment) Variant(customerID int) string {
+	h := fnv.New32a()
+	h.Write([]byte(strconv.Itoa(customerID) + e.ID))
+	if float64(h.Sum32()%10000) < e.TrafficSplit*10000 {
+		return VariantTreatment
+	}
+	return VariantControl
+}
+
+func (e *PriceExperiment) multiplier(variant string) float64 {
+	if variant == VariantTreatment {
+		return e.TreatmentMultiplier
+	}
+	return e.ControlMultiplier
+}
+
+func (e *PriceExperiment) validate() error {
+	if !e.EndAt.After(e.StartAt) {
+		return ErrInvalidPriceExperiment
+	}
+	for _, m := range []float64{e.ControlMultiplier, e.TreatmentMultiplier} {
+		if m < MinPriceMultiplier || m > MaxPriceMultiplier {
+			return ErrInvalidPriceExperiment
+		}
+	}
+	return nil
+}
+
+// ConversionStats counts one arm of a price experiment.
+type ConversionStats struct {
+	Variant string `json:"variant"`
+	// Customers saw the arm's price at least once; Conversions of them
+	// went on to purchase.
+	Customers      int64   `json:"customers"`
+	Conversions    int64   `json:"conversions"`
+	ConversionRate float64 `json:"conversion_rate"`
+}
+
+// ConversionStore counts exposed and converting customers per experiment
+// and variant.
+type ConversionStore struct {
+	mu    sync.Mutex
+	stats map[string]map[string]ConversionStats
+}
+
+func NewConversionStore() *ConversionStore {
+	return &ConversionStore{stats: make(map[string]map[string]ConversionStats)}
+}
+
+func (s *ConversionStore) add(experimentID, variant string, customers, conversions int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stats[experimentID] == nil {
+		s.stats[experimentID] = make(map[string]ConversionStats)
+	}
+	st := s.stats[experimentID][variant]
+	st.Variant = variant
+	st.Customers += customers
+	st.Conversions += conversions
+	if st.Customers > 0 {
+		st.ConversionRate = float64(st.Conversions) / float64(st.Customers)
+	}
+	s.stats[experimentID][variant] = st
+}
+
+// Get returns the counts for one arm.
+func (s *ConversionStore) Get(experimentID, variant string) ConversionStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.stats[experimentID][variant]
+	st.Variant = variant
+	return st
+}
+
+// PriceExperimentResults is returned by GET /admin/experiments/:id/results.
+// ZScore and PValue come from a two-proportion z-test of treatment against
+// control conversion rates.
+type PriceExperimentResults struct {
+	Experiment  PriceExperiment `json:"experiment"`
+	Control     ConversionStats `json:"control"`
+	Treatment   ConversionStats `json:"treatment"`
+	ZScore      float64         `json:"z_score"`
+	PValue      float64         `json:"p_value"`
+	Significant bool            `json:"significant"`
+}
+
+// PriceExperiments holds the price experiments and who has seen which arm.
+type PriceExperiments struct {
+	mu          sync.RWMutex
+	experiments map[string]*PriceExperiment
+	// assigned and converted are keyed by "experimentID/customerID"; they
+	// make each customer count once towards Customers and Conversions
+	assigned    sync.Map
+	converted   sync.Map
+	conversions *ConversionStore
+}
+
+func NewPriceExperiments() *PriceExperiments {
+	return &PriceExperiments{experiments: make(map[string]*PriceExperiment), conversions: NewConversionStore()}
+}
+
+// Add registers e, replacing any experiment with the same ID. A product may
+// only be in one experiment at a time.
+func (m *PriceExperiments) Add(e PriceExperiment) error {
+	if err := e.validate(); err != nil {
+		return err
+	}
+	e.ProductIDs = slices.Clone(e.ProductIDs)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, other := range m.experiments {
+		if other.ID == e.ID || !other.StartAt.Before(e.EndAt) || !e.StartAt.Before(other.EndAt) {
+			continue
+		}
+		for _, id := range e.ProductIDs {
+			if slices.Contains(other.ProductIDs, id) {
+				return ErrPriceExperimentOverlap
+			}
+		}
+	}
+	m.experiments[e.ID] = &e
+	return nil
+}
+
+// Get returns a copy of the experiment.
+func (m *PriceExperiments) Get(id string) (PriceExperiment, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.experiments[id]
+	if !ok {
+		return PriceExperiment{}, false
+	}
+	return *e, true
+}
+
+// List returns every experiment ordered by ID.
+func (m *PriceExperiments) List() []PriceExperiment {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]PriceExperiment, 0, len(m.experiments))
+	for _, e := range m.experiments {
+		out = append(out, *e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// running returns the experiment pricing productID at t, if any.
+func (m *PriceExperiments) running(productID int32, t time.Time) *PriceExperiment {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, e := range m.experiments {
+		if e.Running(t) && slices.Contains(e.ProductIDs, productID) {
+			return e
+		}
+	}
+	return nil
+}
+
+// expose assigns the customer to a variant, counting them the first time.
+func (m *PriceExperiments) expose(e *PriceExperiment, customerID int) string {
+	variant := e.Variant(customerID)
+	if _, seen := m.assigned.LoadOrStore(e.ID+"/"+strconv.Itoa(customerID), variant); !seen {
+		m.conversions.add(e.ID, variant, 1, 0)
+	}
+	return variant
+}
+
+// RecordPurchase counts a conversion for the customer's variant (once per
+// customer) and returns the variant. A purchase also counts as exposure.
+func (m *PriceExperiments) RecordPurchase(experimentID string, customerID int) (string, error) {
+	m.mu.RLock()
+	e, ok := m.experiments[experimentID]
+	m.mu.RUnlock()
+	if !ok {
+		return "", ErrPriceExperimentNotFound
+	}
+	variant := m.expose(e, customerID)
+	if _, seen := m.converted.LoadOrStore(e.ID+"/"+strconv.Itoa(customerID), true); !seen {
+		m.conversions.add(e.ID, variant, 0, 1)
+	}
+	return variant, nil
+}
+
+// Results compares the experiment's conversion rates.
+func (m *PriceExperiments) Results(experimentID string) (PriceExperimentResults, error) {
+	e, ok := m.Get(experimentID)
+	if !ok {
+		return PriceExperimentResults{}, ErrPriceExperimentNotFound
+	}
+	control := m.conversions.Get(experimentID, VariantControl)
+	treatment := m.conversions.Get(experimentID, VariantTreatment)
+	z, p := TwoProportionZTest(control.Conversions, control.Customers, treatment.Conversions, treatment.Customers)
+	return PriceExperimentResults{
+		Experiment: e, Control: control, Treatment: treatment,
+		ZScore: z, PValue: p, Significant: p < SignificanceLevel,
+	}, nil
+}
+
+// TwoProportionZTest tests whether the success rates x1/n1 and x2/n2 differ,
+// returning the z statistic (positive when the second rate is higher) and
+// the two-sided p-value. With no data or no variation it returns 0, 1.
+func TwoProportionZTest(x1, n1, x2, n2 int64) (z, p float64) {
+	if n1 == 0 || n2 == 0 {
+		return 0, 1
+	}
+	p1 := float64(x1) / float64(n1)
+	p2 := float64(x2) / float64(n2)
+	pooled := float64(x1+x2) / float64(n1+n2)
+	se := math.Sqrt(pooled * (1 - pooled) * (1/float64(n1) + 1/float64(n2)))
+	if se == 0 {
+		return 0, 1
+	}
+	z = (p2 - p1) / se
+	return z, math.Erfc(math.Abs(z) / math.Sqrt2)
+}
+
+// PriceExperiments returns the store's price experiments.
+func (s *Store) PriceExperiments() PriceExperimentRegistry {
+	return s.experiments
+}
+
+// GetPriceForExperiment returns the price customerID sees for the product:
+// its catalog price scaled by their arm's multiplier (rounded to cents)
+// while a price experiment covers it, else the catalog price. It returns 0
+// for unknown products.
+func (s *Store) GetPriceForExperiment(productID int32, customerID int) float64 {
+	p, ok := s.Get(productID)
+	if !ok {
+		return 0
+	}
+	e := s.experiments.running(productID, time.Now())
+	if e == nil {
+		return p.Price
+	}
+	variant := s.experiments.expose(e, customerID)
+	return math.Round(p.Price*e.multiplier(variant)*100) / 100
+}
@@ -0,0 +1,55 @@
+package product
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRebuildProducts is the catalog size when no n is given.
+	DefaultRebuildProducts = 100000
+	// MaxRebuildProducts bounds the catalog size of a rebuild.
+	MaxRebuildProducts = 1000000
+)
+
+// RebuildStatus describes the current or most recent background rebuild.
+type RebuildStatus struct {
+	Rebuilding  bool       `json:"rebuilding"`
+	Products    int        `json:"products,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+type rebuildTracker struct {
+	mu     sync.Mutex
+	status RebuildStatus
+}
+
+// StartRebuild runs Rebuild(n) in the background. It returns false without
+// doing anything if a rebuild is already running.
+func (s *Store) StartRebuild(n int) bool {
+	s.rebuild.mu.Lock()
+	defer s.rebuild.mu.Unlock()
+	if s.rebuild.status.Rebuilding {
+		return false
+	}
+	now := time.Now().UTC()
+	s.rebuild.status = RebuildStatus{Rebuilding: true, Products: n, StartedAt: &now}
+
+	go func() {
+		s.Rebuild(n)
+		done := time.Now().UTC()
+		s.rebuild.mu.Lock()
+		s.rebuild.status.Rebuilding = false
+		s.rebuild.status.CompletedAt = &done
+		s.rebuild.mu.Unlock()
+	}()
+	return true
+}
+
+// RebuildStatus reports whether a rebuild is running.
+func (s *Store) RebuildStatus() RebuildStatus {
+	s.rebuild.mu.Lock()
+	defer s.rebuild.mu.Unlock()
+	return s.rebuild.status
+}
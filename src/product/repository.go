@@ -0,0 +1,105 @@
+package product
+
+import "time"
+
+// ProductReader looks up products and their changes.
+type ProductReader interface {
+	Get(id int32) (Product, bool)
+	GetMany(ids []int32) (map[int32]Product, []int32)
+	GetBySlug(slug string) (Product, bool)
+	ListAfter(after int32, limit int) []Product
+	GetChangedSince(since time.Time) ([]ChangedProduct, time.Time, error)
+}
+
+// ProductSearcher runs filtered searches over the catalog.
+type ProductSearcher interface {
+	SearchLimitedWhere(nameFilter, categoryFilter string, filter ProductFilter, where func(Product) bool, maxCheck, maxReturn int) ([]Product, int)
+	SearchPageWhere(nameFilter, categoryFilter string, filter ProductFilter, where func(Product) bool, afterID int32, limit int) ([]Product, bool)
+}
+
+// ProductWriter creates, changes and deletes products.
+type ProductWriter interface {
+	Create(incoming Product) Product
+	BulkCreate(incoming []Product) []Product
+	UpdateDetails(id int32, incoming Product) (Product, bool)
+	Delete(id int32) bool
+	ProductInUse(id int32) bool
+	SetPricingTiers(id int32, tiers []PricingTier) (Product, bool)
+}
+
+// MetadataRepository stores free-form product metadata.
+type MetadataRepository interface {
+	GetMetadata(id int32, key string) (string, bool)
+	SetMetadata(id int32, key, value string) error
+	DeleteMetadata(id int32, key string) error
+}
+
+// Recommender finds related products.
+type Recommender interface {
+	SimilarProducts(id int32, limit int) ([]Product, error)
+	SameCategory() Algorithm
+	SameBrand() Algorithm
+}
+
+// PriceExperimentRegistry runs price A/B tests.
+type PriceExperimentRegistry interface {
+	Add(e PriceExperiment) error
+	List() []PriceExperiment
+	Results(experimentID string) (PriceExperimentResults, error)
+	RecordPurchase(experimentID string, customerID int) (string, error)
+}
+
+// PricingRepository prices products and reprices them in bulk.
+type PricingRepository interface {
+	GetPriceForExperiment(productID int32, customerID int) float64
+	PriceExperiments() PriceExperimentRegistry
+	CountMatching(q ProductQuery) int
+	BulkUpdatePrice(q ProductQuery, multiplier float64) (int, error)
+}
+
+// BundleRepository stores product bundles.
+type BundleRepository interface {
+	GetBundle(id int32) (Bundle, bool)
+	ListBundles() []Bundle
+	CreateValidatedBundle(b Bundle) (Bundle, error)
+	ComponentTotal(b Bundle) float64
+}
+
+// StockEventSubscriber streams stock level changes.
+type StockEventSubscriber interface {
+	Subscribe() (int64, <-chan StockEvent)
+	Unsubscribe(id int64)
+}
+
+// InventoryRepository reserves stock and reports on it.
+type InventoryRepository interface {
+	Reserve(items []ReservationItem) (*Reservation, error)
+	ReleaseReservation(id string) (*Reservation, bool)
+	LowStock() []Product
+	StockEvents() StockEventSubscriber
+}
+
+// CatalogAdmin rebuilds the catalog and reports on the store.
+type CatalogAdmin interface {
+	StartRebuild(n int) bool
+	RebuildStatus() RebuildStatus
+	TopSearches(limit int) []SearchEntry
+	CacheStats() CacheStats
+}
+
+// ProductRepository is the product storage the HTTP handlers depend on.
+// *Store implements it; tests and alternative backends can supply their
+// own. Other consumers take only the smaller interfaces they use.
+type ProductRepository interface {
+	ProductReader
+	ProductSearcher
+	ProductWriter
+	MetadataRepository
+	Recommender
+	PricingRepository
+	BundleRepository
+	InventoryRepository
+	CatalogAdmin
+}
+
+var _ ProductRepository = (*Store)(nil)
@@ -7,5 +7,57 @@ func Register(r gin.IRoutes, h *Handlers) {
 	r.POST("/products", h.CreateProduct)
 	r.GET("/products", h.ListProducts)
 	r.GET("/products/:productId", h.GetProduct)
+	r.DELETE("/products/:productId", h.requireAdmin, h.DeleteProduct)
+	r.GET("/products/:productId/stock", h.GetStock)
+	r.GET("/products/by-slug/:slug", h.GetProductBySlug)
+	r.GET("/products/changes", h.ListChanges)
+	r.POST("/products/batch", h.BatchGetProducts)
+	r.POST("/products/bulk", h.BulkCreateProducts)
 	r.POST("/products/:productId/details", h.AddProductDetails)
+	r.PATCH("/products/price", h.requireAdmin, h.BulkUpdatePrice)
+	r.GET("/products/:productId/recommendations", h.GetRecommendations)
+	r.GET("/products/:productId/similar", h.SimilarProducts)
+	r.GET("/products/:productId/pricing-tiers", h.GetPricingTiers)
+	r.POST("/products/:productId/pricing-tiers", h.requireAdmin, h.SetPricingTiers)
+	r.GET("/products/:productId/metadata/:key", h.GetMetadata)
+	r.PUT("/products/:productId/metadata/:key", h.requireAdmin, h.SetMetadata)
+	r.DELETE("/products/:productId/metadata/:key", h.requireAdmin, h.DeleteMetadata)
+	r.POST("/products/bundles", h.requireAdmin, h.CreateBundle)
+	r.GET("/products/bundles", h.ListBundles)
+	r.GET("/products/bundles/:bundleId", h.GetBundle)
+}
+
+// RegisterAdmin mounts catalog administration routes. Unlike Register these
+// are not versioned, so mount them once, behind middleware.RequireAdminKey.
+func RegisterAdmin(r gin.IRoutes, h *Handlers) {
+	r.POST("/admin/products/import", h.ImportCSV)
+	r.POST("/admin/products/import/ndjson", h.ImportNDJSON)
+	r.GET("/admin/products/export/ndjson", h.ExportNDJSON)
+	r.GET("/admin/products/rebuild", h.RebuildProducts)
+	r.GET("/admin/products/rebuild/status", h.RebuildStatus)
+	r.GET("/admin/analytics/searches", h.TopSearches)
+	r.GET("/admin/products/cache-stats", h.CacheStats)
+	r.POST("/admin/inventory/reserve", h.ReserveInventory)
+	r.POST("/admin/inventory/release/:reservationId", h.ReleaseReservation)
+	r.GET("/admin/inventory/low-stock", h.LowStock)
+	r.GET("/admin/ab-tests/:name/results", h.ABTestResults)
+	r.GET("/admin/ws/inventory", h.StreamStockEvents)
+	r.POST("/admin/experiments", h.CreatePriceExperiment)
+	r.GET("/admin/experiments", h.ListPriceExperiments)
+	r.GET("/admin/experiments/:id/results", h.PriceExperimentResults)
+}
+
+// RegisterEvents mounts the storefront's event ingestion routes. They are
+// unversioned and open to clients, so mount them once.
+func RegisterEvents(r gin.IRoutes, h *Handlers) {
+	r.POST("/events/recommendation-click", h.RecordRecommendationClick)
+	r.POST("/events/purchase", h.RecordPurchase)
+}
+
+// RegisterGraphQL mounts the GraphQL endpoint and its schema. GraphQL is
+// unversioned, so mount it once.
+func RegisterGraphQL(r gin.IRoutes, h *GraphQLHandlers) {
+	r.GET("/graphql", h.Query)
+	r.POST("/graphql", h.Query)
+	r.GET("/graphql-schema", h.Schema)
 }
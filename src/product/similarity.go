@@ -0,0 +1,176 @@
+package product
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+	"sync"
+)
+
+// FeatureVector layout: [0] price scaled to 0-1, [1:6] category one-hot,
+// [6:9] brand one-hot, [9] pre-order flag. Categories and brands are hashed
+// into their slots so any value gets a deterministic encoding.
+const (
+	featureDims         = 10
+	featureCategorySlot = 1
+	featureCategories   = 5
+	featureBrandSlot    = 6
+	featureBrands       = 3
+	featurePreOrderSlot = 9
+	// featurePriceScale maps prices at or above it to 1.
+	featurePriceScale = 200.0
+	// MaxSimilarProducts bounds the limit of SimilarProducts.
+	MaxSimilarProducts = 50
+)
+
+// featureVector derives the deterministic similarity features of p.
+func featureVector(p Product) [featureDims]float32 {
+	var v [featureDims]float32
+	v[0] = float32(math.Min(math.Max(p.Price, 0)/featurePriceScale, 1))
+	if p.Category != "" {
+		v[featureCategorySlot+hashSlot(p.Category, featureCategories)] = 1
+	}
+	if p.Brand != "" {
+		v[featureBrandSlot+hashSlot(p.Brand, featureBrands)] = 1
+	}
+	if p.IsPreOrder {
+		v[featurePreOrderSlot] = 1
+	}
+	return v
+}
+
+func hashSlot(s string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return int(h.Sum32() % uint32(n))
+}
+
+// withFeatures returns p with its FeatureVector recomputed.
+func withFeatures(p Product) Product {
+	p.FeatureVector = featureVector(p)
+	return p
+}
+
+// CosineSimilarity returns a·b / (|a||b|), or 0 if either vector is zero.
+func CosineSimilarity(a, b [featureDims]float32) float64 {
+	var dot, normA, normB float64
+	for i := 0; i < featureDims; i++ {
+		x, y := float64(a[i]), float64(b[i])
+		dot += x * y
+		normA += x * x
+		normB += y * y
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// similarCache memoises the MaxSimilarProducts nearest IDs per product. It is
+// cleared whenever product features change.
+type similarCache struct {
+	mu      sync.Mutex
+	ids     map[int32][]int32
+	metrics CacheMetrics
+}
+
+func (c *similarCache) get(id int32) ([]int32, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ids, ok := c.ids[id]
+	if ok {
+		c.metrics.Hits.Add(1)
+	} else {
+		c.metrics.Misses.Add(1)
+	}
+	return ids, ok
+}
+
+func (c *similarCache) put(id int32, ids []int32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ids == nil {
+		c.ids = make(map[int32][]int32)
+	}
+	c.ids[id] = ids
+}
+
+func (c *similarCache) clear() {
+	c.mu.Lock()
+	c.metrics.Evictions.Add(int64(len(c.ids)))
+	c.ids = nil
+	c.mu.Unlock()
+}
+
+func (c *similarCache) size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.ids)
+}
+
+// SimilarProducts returns up to limit (at most MaxSimilarProducts) products
+// ordered by descending cosine similarity to id, ties broken by ID. It scans
+// the whole catalog once per product and caches the result.
+func (s *Store) SimilarProducts(id int32, limit int) ([]Product, error) {
+	if limit > MaxSimilarProducts {
+		limit = MaxSimilarProducts
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	target, ok := s.products[id]
+	if !ok {
+		return nil, ErrProductNotFound
+	}
+	if limit <= 0 {
+		return []Product{}, nil
+	}
+
+	ids, cached := s.similar.get(id)
+	if !cached {
+		ids = s.nearest(target, MaxSimilarProducts)
+		s.similar.put(id, ids)
+	}
+	out := make([]Product, 0, limit)
+	for _, sid := range ids {
+		if len(out) == limit {
+			break
+		}
+		if p, ok := s.products[sid]; ok {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+// nearest keeps a sorted top-k while scanning; callers hold s.mu.
+func (s *Store) nearest(target Product, k int) []int32 {
+	type scored struct {
+		id    int32
+		score float64
+	}
+	better := func(a, b scored) bool {
+		return a.score > b.score || (a.score == b.score && a.id < b.id)
+	}
+	top := make([]scored, 0, k+1)
+	for _, id := range s.sortedKeys {
+		if id == target.ID {
+			continue
+		}
+		c := scored{id: id, score: CosineSimilarity(target.FeatureVector, s.products[id].FeatureVector)}
+		if len(top) == k && !better(c, top[k-1]) {
+			continue
+		}
+		i := sort.Search(len(top), func(i int) bool { return better(c, top[i]) })
+		top = append(top, scored{})
+		copy(top[i+1:], top[i:])
+		top[i] = c
+		if len(top) > k {
+			top = top[:k]
+		}
+	}
+	ids := make([]int32, len(top))
+	for i, c := range top {
+		ids[i] = c.id
+	}
+	return ids
+}
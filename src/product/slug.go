@@ -0,0 +1,67 @@
+package product
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Slugify builds the URL slug for a product: the name lowercased, with runs
+// of spaces and hyphens turned into one hyphen and any other character that
+// is not a-z or 0-9 dropped, followed by "-{id}" unless the name already
+// ends with the ID (as seed names do). Since the last segment is always the
+// ID, slugs are unique even when names collide.
+func Slugify(name string, id int32) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			hyphen = false
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '_':
+			hyphen = true
+		}
+	}
+	suffix := strconv.Itoa(int(id))
+	slug := b.String()
+	if slug == suffix || strings.HasSuffix(slug, "-"+suffix) {
+		return slug
+	}
+	if slug == "" {
+		return suffix
+	}
+	return slug + "-" + suffix
+}
+
+// withSlug returns p with Slug set if it has none. Slugs are assigned once
+// so published URLs keep working after a rename.
+func withSlug(p Product) Product {
+	if p.Slug == "" {
+		p.Slug = Slugify(p.Name, p.ID)
+	}
+	return p
+}
+
+// GetBySlug looks a product up by its slug.
+func (s *Store) GetBySlug(slug string) (Product, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	id, ok := s.slugs[slug]
+	if !ok {
+		return Product{}, false
+	}
+	p, ok := s.products[id]
+	return p, ok
+}
+
+// indexSlug points p's slug at p, dropping any different slug the stored
+// product with the same ID had. Callers hold the write lock.
+func (s *Store) indexSlug(p Product) {
+	if old, ok := s.products[p.ID]; ok && old.Slug != p.Slug {
+		delete(s.slugs, old.Slug)
+	}
+	s.slugs[p.Slug] = p.ID
+}
@@ -0,0 +1,110 @@
+package product
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+)
+
+// snapshotVersion identifies the snapshot layout; LoadSnapshot rejects others.
+const snapshotVersion = 1
+
+// snapshot is the gob encoding of a catalog with its indexes already built,
+// written by cmd/indexer so the server can skip building them at startup.
+type snapshot struct {
+	Version int
+	// Products carry their feature vectors, which the JSON export omits
+	Products   map[int32]Product
+	SortedKeys []int32
+	Slugs      map[string]int32
+	NextID     int32
+}
+
+// Load replaces the catalog with products, keeping their IDs. Like Rebuild,
+// it builds the new catalog before taking the lock and restarts the change
+// history. Products without an UpdatedAt are stamped with the load time.
+func (s *Store) Load(products []Product) {
+	loadedAt := time.Now().UTC()
+	byID := make(map[int32]Product, len(products))
+	slugs := make(map[string]int32, len(products))
+	keys := make([]int32, 0, len(products))
+	nextID := int32(1)
+	for _, p := range products {
+		p = withSlug(withFeatures(p))
+		if p.UpdatedAt.IsZero() {
+			p.UpdatedAt = loadedAt
+		}
+		if _, exists := byID[p.ID]; !exists {
+			keys = append(keys, p.ID)
+		}
+		byID[p.ID] = p
+		slugs[p.Slug] = p.ID
+		nextID = max(nextID, p.ID+1)
+	}
+	slices.Sort(keys)
+
+	s.mu.Lock()
+	s.products = byID
+	s.slugs = slugs
+	s.sortedKeys = keys
+	s.nextID = nextID
+	s.changes.reset(loadedAt)
+	s.similar.clear()
+	s.mu.Unlock()
+}
+
+// WriteSnapshot writes the catalog and its indexes to w.
+func (s *Store) WriteSnapshot(w io.Writer) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return gob.NewEncoder(w).Encode(snapshot{
+		Version:    snapshotVersion,
+		Products:   s.products,
+		SortedKeys: s.sortedKeys,
+		Slugs:      s.slugs,
+		NextID:     s.nextID,
+	})
+}
+
+// LoadSnapshot replaces the catalog with one written by WriteSnapshot. The
+// change history restarts, as it does after a rebuild.
+func (s *Store) LoadSnapshot(r io.Reader) error {
+	var snap snapshot
+	if err := gob.NewDecoder(r).Decode(&snap); err != nil {
+		return fmt.Errorf("decoding product snapshot: %w", err)
+	}
+	if snap.Version != snapshotVersion {
+		return fmt.Errorf("product snapshot version %d, want %d", snap.Version, snapshotVersion)
+	}
+	if len(snap.SortedKeys) != len(snap.Products) || len(snap.Slugs) != len(snap.Products) {
+		return fmt.Errorf("product snapshot indexes do not match its %d products", len(snap.Products))
+	}
+	// gob decodes empty maps as nil
+	if snap.Products == nil {
+		snap.Products = make(map[int32]Product)
+		snap.Slugs = make(map[string]int32)
+	}
+
+	s.mu.Lock()
+	s.products = snap.Products
+	s.slugs = snap.Slugs
+	s.sortedKeys = snap.SortedKeys
+	s.nextID = max(snap.NextID, 1)
+	s.changes.reset(time.Now().UTC())
+	s.similar.clear()
+	s.mu.Unlock()
+	return nil
+}
+
+// LoadSnapshotFile loads the snapshot at path.
+func (s *Store) LoadSnapshotFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.LoadSnapshot(f)
+}
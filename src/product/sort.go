@@ -0,0 +1,60 @@
+package product
+
+import (
+	"sort"
+	"strings"
+)
+
+// SortField is a product field search results can be sorted by.
+type SortField string
+
+const (
+	SortByID       SortField = "id"
+	SortByName     SortField = "name"
+	SortByPrice    SortField = "price"
+	SortByCategory SortField = "category"
+	SortByBrand    SortField = "brand"
+)
+
+// ParseSortField returns the SortField named s, if there is one.
+func ParseSortField(s string) (SortField, bool) {
+	switch f := SortField(s); f {
+	case SortByID, SortByName, SortByPrice, SortByCategory, SortByBrand:
+		return f, true
+	}
+	return "", false
+}
+
+// SortProducts sorts products in place by field, descending if desc. Text
+// fields compare case-insensitively; ties are broken by ascending ID so
+// the order is reproducible.
+func SortProducts(products []Product, field SortField, desc bool) {
+	compare := func(a, b Product) int {
+		switch field {
+		case SortByName:
+			return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		case SortByCategory:
+			return strings.Compare(strings.ToLower(a.Category), strings.ToLower(b.Category))
+		case SortByBrand:
+			return strings.Compare(strings.ToLower(a.Brand), strings.ToLower(b.Brand))
+		case SortByPrice:
+			switch {
+			case a.Price < b.Price:
+				return -1
+			case a.Price > b.Price:
+				return 1
+			}
+		}
+		return 0
+	}
+	sort.Slice(products, func(i, j int) bool {
+		a, b := products[i], products[j]
+		if c := compare(a, b); c != 0 {
+			return (c < 0) != desc
+		}
+		if field == SortByID && desc {
+			return a.ID > b.ID
+		}
+		return a.ID < b.ID
+	})
+}
@@ -0,0 +1,93 @@
+package product
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// stockEventQueue buffers events between writers and the fan-out goroutine.
+	stockEventQueue = 1000
+	// subscriberBuffer is how many events a slow subscriber may fall behind by
+	// before events are dropped for it.
+	subscriberBuffer = 100
+)
+
+// StockEvent describes one change to a product's stock level.
+type StockEvent struct {
+	ProductID int32     `json:"product_id"`
+	OldStock  int       `json:"old_stock"`
+	NewStock  int       `json:"new_stock"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// StockEventBus fans stock events out to subscribers. Publishing never
+// blocks: events are dropped (with a warning) when a buffer is full.
+type StockEventBus struct {
+	in     chan StockEvent
+	subs   sync.Map // subscription ID -> chan StockEvent
+	nextID atomic.Int64
+	count  atomic.Int64
+	start  sync.Once
+}
+
+func NewStockEventBus() *StockEventBus {
+	return &StockEventBus{in: make(chan StockEvent, stockEventQueue)}
+}
+
+// Publish queues an event for subscribers. It is a no-op when nobody is
+// subscribed, so stores without listeners pay almost nothing.
+func (b *StockEventBus) Publish(e StockEvent) {
+	if b.count.Load() == 0 {
+		return
+	}
+	select {
+	case b.in <- e:
+	default:
+		log.Printf("WARNING: Stock event queue full, dropping event for product %d\n", e.ProductID)
+	}
+}
+
+// Subscribe returns a subscription ID and a channel of events. Call
+// Unsubscribe with the ID when done.
+func (b *StockEventBus) Subscribe() (int64, <-chan StockEvent) {
+	b.start.Do(func() { go b.fanOut() })
+	id := b.nextID.Add(1)
+	ch := make(chan StockEvent, subscriberBuffer)
+	b.subs.Store(id, ch)
+	b.count.Add(1)
+	return id, ch
+}
+
+// Unsubscribe stops delivery to a subscription. The channel is not closed,
+// since the fan-out goroutine may still hold it.
+func (b *StockEventBus) Unsubscribe(id int64) {
+	if _, ok := b.subs.LoadAndDelete(id); ok {
+		b.count.Add(-1)
+	}
+}
+
+func (b *StockEventBus) fanOut() {
+	for e := range b.in {
+		b.subs.Range(func(key, value any) bool {
+			select {
+			case value.(chan StockEvent) <- e:
+			default:
+				log.Printf("WARNING: Stock event subscriber %d is too slow, dropping event for product %d\n", key.(int64), e.ProductID)
+			}
+			return true
+		})
+	}
+}
+
+// StockEvents returns the bus the store publishes stock changes to.
+func (s *Store) StockEvents() StockEventSubscriber {
+	return s.events
+}
+
+// publishStock records a stock change; callers hold s.mu.
+func (s *Store) publishStock(id int32, oldStock, newStock int) {
+	s.events.Publish(StockEvent{ProductID: id, OldStock: oldStock, NewStock: newStock, Timestamp: time.Now().UTC()})
+}
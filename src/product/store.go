@@ -1,9 +1,25 @@
 package product
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"runtime"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrInvalidMultiplier is returned by BulkUpdatePrice for multipliers outside [MinPriceMultiplier, MaxPriceMultiplier].
+var ErrInvalidMultiplier = errors.New("multiplier must be between 0.01 and 10.0")
+
+const (
+	MinPriceMultiplier = 0.01
+	MaxPriceMultiplier = 10.0
 )
 
 // Store provides concurrent-safe in-memory storage for products.
@@ -11,16 +27,46 @@ type Store struct {
 	mu       sync.RWMutex
 	products map[int32]Product
 	nextID   int32
+	// sortedKeys mirrors the keys of products in ascending order so scans are deterministic
+	sortedKeys []int32
+	analytics  *SearchAnalytics
+	// reservations maps reservation IDs to *Reservation
+	reservations sync.Map
+	events       *StockEventBus
+	alerts       *StockAlertBus
+	experiments  *PriceExperiments
+	similar      similarCache
+	rebuild      rebuildTracker
+	// slugs maps each product's Slug to its ID
+	slugs   map[string]int32
+	changes changeLog
+	BundleStore
 }
 
 func NewStore() *Store {
-	return &Store{products: make(map[int32]Product), nextID: 1}
+	return &Store{
+		products:    make(map[int32]Product),
+		slugs:       make(map[string]int32),
+		changes:     changeLog{start: time.Now().UTC()},
+		nextID:      1,
+		analytics:   NewSearchAnalytics(),
+		events:      NewStockEventBus(),
+		alerts:      NewStockAlertBus(),
+		experiments: NewPriceExperiments(),
+		BundleStore: newBundleStore(),
+	}
 }
 
 func (s *Store) SeedSample() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.products[1] = Product{ID: 1, Name: "Sample Product", Category: "Electronics", Description: "Seeded item", Brand: "Acme", Price: 9.99}
+	if _, exists := s.products[1]; !exists {
+		s.insertSortedKey(1)
+	}
+	sample := s.touch(withSlug(withFeatures(Product{ID: 1, Name: "Sample Product", Category: "Electronics", Description: "Seeded item", Brand: "Acme", Price: 9.99, Stock: 100, LowStockThreshold: DefaultLowStockThreshold})))
+	s.indexSlug(sample)
+	s.products[1] = sample
+	s.similar.clear()
 	if s.nextID <= 1 {
 		s.nextID = 2
 	}
@@ -33,26 +79,49 @@ func (s *Store) Get(id int32) (Product, bool) {
 	return p, ok
 }
 
-// List returns all products filtered by optional name and category substrings (case-insensitive).
-func (s *Store) List(nameFilter, categoryFilter string) []Product {
+// GetMany looks up every ID under a single read lock, returning the found
+// products by ID and the missing IDs in the order given.
+func (s *Store) GetMany(ids []int32) (map[int32]Product, []int32) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	found := make(map[int32]Product, len(ids))
+	missing := []int32{}
+	for _, id := range ids {
+		if p, ok := s.products[id]; ok {
+			found[id] = p
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	return found, missing
+}
+
+// ListAfter returns up to limit products with IDs greater than after, in ID
+// order, so callers can page through the catalog without holding the lock.
+func (s *Store) ListAfter(after int32, limit int) []Product {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i := sort.Search(len(s.sortedKeys), func(i int) bool { return s.sortedKeys[i] > after })
+	out := make([]Product, 0, min(limit, len(s.sortedKeys)-i))
+	for ; i < len(s.sortedKeys) && len(out) < limit; i++ {
+		out = append(out, s.products[s.sortedKeys[i]])
+	}
+	return out
+}
+
+// List returns all products filtered by optional name and category
+// substrings (case-insensitive) and by filter.
+func (s *Store) List(nameFilter, categoryFilter string, filter ProductFilter) []Product {
+	match := searchMatcher(nameFilter, categoryFilter, filter, nil)
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	var results []Product
-	name := strings.ToLower(nameFilter)
-	category := strings.ToLower(categoryFilter)
 	for _, p := range s.products {
-		if name != "" {
-			if !strings.Contains(strings.ToLower(p.Name), name) {
-				continue
-			}
+		if match(p) {
+			results = append(results, p)
 		}
-		if category != "" {
-			if !strings.Contains(strings.ToLower(p.Category), category) {
-				continue
-			}
-		}
-		results = append(results, p)
 	}
 	return results
 }
@@ -80,7 +149,9 @@ func (s *Store) UpdateDetails(id int32, incoming Product) (Product, bool) {
 	if incoming.Price != 0 {
 		existing.Price = incoming.Price
 	}
+	existing = s.touch(withFeatures(existing))
 	s.products[id] = existing
+	s.similar.clear()
 	return existing, true
 }
 
@@ -93,56 +164,289 @@ func (s *Store) Create(incoming Product) Product {
 	id := s.nextID
 	s.nextID++
 	created := Product{
-		ID:          id,
-		Name:        incoming.Name,
-		Category:    incoming.Category,
-		Description: incoming.Description,
-		Brand:       incoming.Brand,
-		Price:       incoming.Price,
+		ID:                id,
+		Name:              incoming.Name,
+		Category:          incoming.Category,
+		Description:       incoming.Description,
+		Brand:             incoming.Brand,
+		Price:             incoming.Price,
+		Stock:             incoming.Stock,
+		LowStockThreshold: incoming.LowStockThreshold,
+		IsPreOrder:        incoming.IsPreOrder,
+		PreOrderShipDate:  incoming.PreOrderShipDate,
 	}
+	created = s.touch(withSlug(withFeatures(created)))
+	s.slugs[created.Slug] = id
 	s.products[id] = created
+	s.similar.clear()
+	s.insertSortedKey(id)
+	return created
+}
+
+// put stores p under its own ID, keeping sortedKeys and nextID consistent,
+// and returns the stored product.
+func (s *Store) put(p Product) Product {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.products[p.ID]; !exists {
+		s.insertSortedKey(p.ID)
+	}
+	p = s.touch(withSlug(withFeatures(p)))
+	s.indexSlug(p)
+	s.products[p.ID] = p
+	s.similar.clear()
+	if p.ID >= s.nextID {
+		s.nextID = p.ID + 1
+	}
+	return p
+}
+
+// remove deletes the product with the given ID and reports whether it existed.
+func (s *Store) remove(id int32) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.products[id]
+	if !ok {
+		return false
+	}
+	delete(s.slugs, p.Slug)
+	delete(s.products, id)
+	s.touchDeleted(p)
+	s.removeSortedKey(id)
+	s.similar.clear()
+	return true
+}
+
+// Delete removes the product and reports whether it existed. Bundles and
+// reservations referencing it are left as they are; see ProductInUse.
+func (s *Store) Delete(id int32) bool {
+	return s.remove(id)
+}
+
+// ProductInUse reports whether the product is a bundle component or has
+// stock held by an unexpired reservation.
+func (s *Store) ProductInUse(id int32) bool {
+	s.BundleStore.mu.RLock()
+	for _, b := range s.bundles {
+		if slices.Contains(b.ComponentIDs, id) {
+			s.BundleStore.mu.RUnlock()
+			return true
+		}
+	}
+	s.BundleStore.mu.RUnlock()
+
+	// Expired reservations count as released even before the sweeper runs
+	now := time.Now()
+	held := false
+	s.reservations.Range(func(_, value any) bool {
+		r := value.(*Reservation)
+		held = r.ExpiresAt.After(now) && slices.ContainsFunc(r.Reserved, func(item ReservationItem) bool { return item.ProductID == id })
+		return !held
+	})
+	return held
+}
+
+// removeSortedKey deletes id from sortedKeys. Callers must hold the write lock.
+func (s *Store) removeSortedKey(id int32) {
+	i := sort.Search(len(s.sortedKeys), func(i int) bool { return s.sortedKeys[i] >= id })
+	if i < len(s.sortedKeys) && s.sortedKeys[i] == id {
+		s.sortedKeys = append(s.sortedKeys[:i], s.sortedKeys[i+1:]...)
+	}
+}
+
+// scanPrefix checks the first maxCheck products in ID order and returns the
+// checked IDs along with the products that matched.
+func (s *Store) scanPrefix(match func(Product) bool, maxCheck int) ([]int32, []Product) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n := len(s.sortedKeys)
+	if maxCheck < n {
+		n = maxCheck
+	}
+	checked := make([]int32, n)
+	copy(checked, s.sortedKeys[:n])
+	var matches []Product
+	for _, id := range checked {
+		if p := s.products[id]; match(p) {
+			matches = append(matches, p)
+		}
+	}
+	return checked, matches
+}
+
+// SetPricingTiers replaces the product's pricing tiers. Tiers must already be validated.
+func (s *Store) SetPricingTiers(id int32, tiers []PricingTier) (Product, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.products[id]
+	if !ok {
+		return Product{}, false
+	}
+	p.PricingTiers = append([]PricingTier(nil), tiers...)
+	p = s.touch(p)
+	s.products[id] = p
+	return p, true
+}
+
+// BulkCreate assigns IDs to and stores all products under a single write lock.
+func (s *Store) BulkCreate(incoming []Product) []Product {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.nextID == 0 {
+		s.nextID = 1
+	}
+	created := make([]Product, 0, len(incoming))
+	for _, p := range incoming {
+		p.ID = s.nextID
+		s.nextID++
+		p.Slug = ""
+		p = s.touch(withSlug(withFeatures(p)))
+		s.slugs[p.Slug] = p.ID
+		s.products[p.ID] = p
+		// IDs are allocated in increasing order, so appending keeps the keys sorted
+		s.sortedKeys = append(s.sortedKeys, p.ID)
+		created = append(created, p)
+	}
+	s.similar.clear()
 	return created
 }
 
+// insertSortedKey adds id to sortedKeys at its ordered position. Callers must hold the write lock.
+func (s *Store) insertSortedKey(id int32) {
+	i := sort.Search(len(s.sortedKeys), func(i int) bool { return s.sortedKeys[i] >= id })
+	if i < len(s.sortedKeys) && s.sortedKeys[i] == id {
+		return
+	}
+	s.sortedKeys = append(s.sortedKeys, 0)
+	copy(s.sortedKeys[i+1:], s.sortedKeys[i:])
+	s.sortedKeys[i] = id
+}
+
 // SeedBulk deterministically generates N products with rotating brands and categories.
 // Names follow the pattern "Product [Brand] [ID]" to ensure consistent search behavior.
 func (s *Store) SeedBulk(n int) {
+	s.Rebuild(n)
+}
+
+// Rebuild replaces the catalog with n seed products. The new catalog is
+// generated without holding the lock, which is then taken only to swap it
+// in, so readers are never blocked for longer than the swap.
+func (s *Store) Rebuild(n int) {
 	if n <= 0 {
 		return
 	}
 
-	categories := []string{"Electronics", "Books", "Home", "Toys", "Clothing", "Sports", "Garden", "Beauty", "Automotive", "Grocery"}
-	brands := []string{"Alpha", "Beta", "Gamma", "Delta", "Epsilon", "Zeta", "Omega"}
+	// Products (and their slugs) are generated in parallel chunks; the maps
+	// are then filled serially
+	seeded := make([]Product, n)
+	workers := runtime.GOMAXPROCS(0)
+	chunk := (n + workers - 1) / workers
+	var g errgroup.Group
+	for start := 0; start < n; start += chunk {
+		start, end := start, min(start+chunk, n)
+		g.Go(func() error {
+			for i := start; i < end; i++ {
+				seeded[i] = seedProduct(i + 1)
+			}
+			return nil
+		})
+	}
+	g.Wait()
+
+	// Capacity hints keep the bulk load from rehashing. The whole catalog
+	// changes at once, so the change history restarts here
+	products := make(map[int32]Product, n)
+	slugs := make(map[string]int32, n)
+	keys := make([]int32, 0, n)
+	rebuiltAt := time.Now().UTC()
+	for _, p := range seeded {
+		p.UpdatedAt = rebuiltAt
+		products[p.ID] = p
+		slugs[p.Slug] = p.ID
+		// IDs are generated in increasing order, so keys are already sorted
+		keys = append(keys, p.ID)
+	}
 
 	s.mu.Lock()
-	// Recreate map with a capacity hint for performance during bulk load
-	s.products = make(map[int32]Product, n)
+	s.products = products
+	s.slugs = slugs
+	s.sortedKeys = keys
+	s.nextID = int32(n) + 1
+	s.changes.reset(rebuiltAt)
+	s.similar.clear()
+	s.mu.Unlock()
+}
+
+// seedShard replaces the store contents with the seed products whose ID maps
+// to this shard (id % shards == index).
+func (s *Store) seedShard(n, index, shards int) {
+	products := make(map[int32]Product, n/shards+1)
+	slugs := make(map[string]int32, n/shards+1)
+	keys := make([]int32, 0, n/shards+1)
+	seededAt := time.Now().UTC()
 	for i := 1; i <= n; i++ {
-		id := int32(i)
-		brand := brands[(i-1)%len(brands)]
-		category := categories[(i-1)%len(categories)]
-		name := fmt.Sprintf("Product %s %d", brand, i)
-		description := fmt.Sprintf("Description for %s", name)
-		// Deterministic price pattern in range ~1.00 - 110.99
-		price := float64((i%110)+1) + float64(i%100)/100.0
-
-		s.products[id] = Product{
-			ID:          id,
-			Name:        name,
-			Category:    category,
-			Description: description,
-			Brand:       brand,
-			Price:       price,
+		if i%shards != index {
+			continue
 		}
+		p := seedProduct(i)
+		p.UpdatedAt = seededAt
+		products[p.ID] = p
+		slugs[p.Slug] = p.ID
+		keys = append(keys, p.ID)
 	}
+
+	s.mu.Lock()
+	s.products = products
+	s.slugs = slugs
+	s.sortedKeys = keys
 	s.nextID = int32(n) + 1
+	s.changes.reset(seededAt)
+	s.similar.clear()
 	s.mu.Unlock()
 }
 
-// SearchLimited scans up to maxCheck products and returns up to maxReturn matches,
-// along with the total number of matches found among the scanned products.
+var (
+	seedCategories = []string{"Electronics", "Books", "Home", "Toys", "Clothing", "Sports", "Garden", "Beauty", "Automotive", "Grocery"}
+	seedBrands     = []string{"Alpha", "Beta", "Gamma", "Delta", "Epsilon", "Zeta", "Omega"}
+)
+
+// seedImageURL is the CDN location of the i-th seed product's image.
+const seedImageURL = "https://cdn.example.com/products/%d.jpg"
+
+// seedProduct builds the i-th (1-based) deterministic seed product.
+func seedProduct(i int) Product {
+	brand := seedBrands[(i-1)%len(seedBrands)]
+	category := seedCategories[(i-1)%len(seedCategories)]
+	name := fmt.Sprintf("Product %s %d", brand, i)
+	description := fmt.Sprintf("Description for %s", name)
+	// Deterministic price pattern in range ~1.00 - 110.99
+	price := float64((i%110)+1) + float64(i%100)/100.0
+	stock := (i * 37) % 1000
+
+	return withSlug(withFeatures(Product{
+		ID:                int32(i),
+		Name:              name,
+		Category:          category,
+		Description:       description,
+		Brand:             brand,
+		Price:             price,
+		Stock:             stock,
+		LowStockThreshold: DefaultLowStockThreshold,
+		ImageURL:          fmt.Sprintf(seedImageURL, i),
+	}))
+}
+
+// SearchLimited scans up to maxCheck products in ascending ID order and returns up to
+// maxReturn matches, along with the total number of matches found among the scanned products.
 // Matching is case-insensitive on name and category substrings. Empty filters match all.
 func (s *Store) SearchLimited(nameFilter, categoryFilter string, maxCheck, maxReturn int) ([]Product, int) {
+	return s.SearchLimitedWhere(nameFilter, categoryFilter, ProductFilter{}, nil, maxCheck, maxReturn)
+}
+
+// SearchLimitedWhere is SearchLimited that also applies filter and then an
+// extra predicate (nil matches everything) after the name and category filters.
+func (s *Store) SearchLimitedWhere(nameFilter, categoryFilter string, filter ProductFilter, where func(Product) bool, maxCheck, maxReturn int) ([]Product, int) {
+	defer s.analytics.Record(nameFilter, categoryFilter)
 	if maxCheck <= 0 {
 		return nil, 0
 	}
@@ -150,34 +454,22 @@ func (s *Store) SearchLimited(nameFilter, categoryFilter string, maxCheck, maxRe
 		maxReturn = 0
 	}
 
+	match := searchMatcher(nameFilter, categoryFilter, filter, where)
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	lowerName := strings.ToLower(nameFilter)
-	lowerCategory := strings.ToLower(categoryFilter)
-
 	results := make([]Product, 0, maxReturn)
 	checked := 0
 	totalFound := 0
 
-	for _, p := range s.products {
+	for _, id := range s.sortedKeys {
 		if checked >= maxCheck {
 			break
 		}
+		p := s.products[id]
 		checked++ // increment for EVERY product checked
-
-		matches := true
-		if lowerName != "" {
-			if !strings.Contains(strings.ToLower(p.Name), lowerName) {
-				matches = false
-			}
-		}
-		if lowerCategory != "" {
-			if !strings.Contains(strings.ToLower(p.Category), lowerCategory) {
-				matches = false
-			}
-		}
-		if matches {
+		if match(p) {
 			totalFound++
 			if len(results) < maxReturn {
 				results = append(results, p)
@@ -187,3 +479,114 @@ func (s *Store) SearchLimited(nameFilter, categoryFilter string, maxCheck, maxRe
 
 	return results, totalFound
 }
+
+// SearchPage returns up to limit products with IDs greater than afterID whose
+// name and category contain the filters (case-insensitive), in ID order,
+// and whether more matches follow the page. It starts at afterID and stops
+// at the first match past the page, so it does not count every match.
+func (s *Store) SearchPage(nameFilter, categoryFilter string, afterID int32, limit int) ([]Product, bool) {
+	return s.SearchPageWhere(nameFilter, categoryFilter, ProductFilter{}, nil, afterID, limit)
+}
+
+// SearchPageWhere is SearchPage that also applies filter and then an extra
+// predicate (nil matches everything) after the name and category filters.
+func (s *Store) SearchPageWhere(nameFilter, categoryFilter string, filter ProductFilter, where func(Product) bool, afterID int32, limit int) ([]Product, bool) {
+	defer s.analytics.Record(nameFilter, categoryFilter)
+	if limit <= 0 {
+		return nil, false
+	}
+
+	match := searchMatcher(nameFilter, categoryFilter, filter, where)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	results := make([]Product, 0, limit)
+	start := sort.Search(len(s.sortedKeys), func(i int) bool { return s.sortedKeys[i] > afterID })
+	for _, id := range s.sortedKeys[start:] {
+		p := s.products[id]
+		if !match(p) {
+			continue
+		}
+		// One match past the page means there is another page
+		if len(results) == limit {
+			return results, true
+		}
+		results = append(results, p)
+	}
+	return results, false
+}
+
+// searchMatcher combines the name and category substrings, filter and where
+// (nil matches everything) into the predicate List and the searches apply
+// under the read lock.
+func searchMatcher(nameFilter, categoryFilter string, filter ProductFilter, where func(Product) bool) func(Product) bool {
+	lowerName := strings.ToLower(nameFilter)
+	lowerCategory := strings.ToLower(categoryFilter)
+	return func(p Product) bool {
+		return matchesSearch(p, lowerName, lowerCategory) && filter.Matches(p) && (where == nil || where(p))
+	}
+}
+
+// matchesSearch applies the SearchLimited filters; the filters must already be lowercased.
+func matchesSearch(p Product, lowerName, lowerCategory string) bool {
+	if lowerName != "" && !strings.Contains(strings.ToLower(p.Name), lowerName) {
+		return false
+	}
+	if lowerCategory != "" && !strings.Contains(strings.ToLower(p.Category), lowerCategory) {
+		return false
+	}
+	return true
+}
+
+// TopSearches returns the most frequent searches of the last 24 hours.
+func (s *Store) TopSearches(limit int) []SearchEntry {
+	return s.analytics.Top(limit)
+}
+
+// Analytics exposes the store's search analytics (e.g. to enable persistence).
+func (s *Store) Analytics() *SearchAnalytics {
+	return s.analytics
+}
+
+// ResetAnalytics clears recorded searches.
+func (s *Store) ResetAnalytics() {
+	s.analytics.Reset()
+}
+
+// CountMatching returns the number of products matching the query.
+func (s *Store) CountMatching(q ProductQuery) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	count := 0
+	for _, p := range s.products {
+		if q.Matches(p) {
+			count++
+		}
+	}
+	return count
+}
+
+// BulkUpdatePrice multiplies the price of every product matching the query,
+// rounding to whole cents, and returns the number of products updated.
+func (s *Store) BulkUpdatePrice(q ProductQuery, multiplier float64) (int, error) {
+	if multiplier < MinPriceMultiplier || multiplier > MaxPriceMultiplier {
+		return 0, ErrInvalidMultiplier
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	updated := 0
+	for id, p := range s.products {
+		if !q.Matches(p) {
+			continue
+		}
+		p.Price = math.Round(p.Price*multiplier*100) / 100
+		s.products[id] = s.touch(withFeatures(p))
+		updated++
+	}
+	if updated > 0 {
+		s.similar.clear()
+	}
+	return updated, nil
+}
@@ -0,0 +1,273 @@
+package product
+
+import (
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+// benchProducts is the catalog size the benchmarks run against.
+const benchProducts = 100_000
+
+// minGetOpsPerSec is the BenchmarkGet floor TestGetThroughput enforces on
+// machines with at least 4 cores. Reads scale with cores, so the floor is
+// only meaningful for a given core count: a single Intel Xeon vCPU
+// already does about 2.8M ops/sec (358 ns/op), leaving 4+ cores wide margin.
+const minGetOpsPerSec = 1_000_000
+
+// benchStore holds benchProducts seed products. TestMain seeds it once,
+// and only when benchmarks or the throughput check will run.
+var benchStore *Store
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if flag.Lookup("test.bench").Value.String() != "" || os.Getenv("PRODUCT_BENCH_THRESHOLDS") != "" {
+		benchStore = newSeededStore(benchProducts)
+	}
+	os.Exit(m.Run())
+}
+
+// benchSearches are the filter combinations the search benchmarks cycle through.
+var benchSearches = []struct{ name, category string }{
+	{"", ""},
+	{"alpha", ""},
+	{"", "electronics"},
+	{"omega", "books"},
+	{"product 99", ""},
+}
+
+func BenchmarkGet(b *testing.B) {
+	b.ReportAllocs()
+	b.SetParallelism(runtime.NumCPU())
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			benchStore.Get(rand.Int32N(benchProducts) + 1)
+		}
+	})
+}
+
+func BenchmarkSearchLimited(b *testing.B) {
+	b.ReportAllocs()
+	b.SetParallelism(runtime.NumCPU())
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			q := benchSearches[i%len(benchSearches)]
+			benchStore.SearchLimited(q.name, q.category, 100, 20)
+			i++
+		}
+	})
+}
+
+// BenchmarkSearchPage pages through searches from random cursors, which
+// should cost about a page of matches rather than a catalog scan.
+func BenchmarkSearchPage(b *testing.B) {
+	b.ReportAllocs()
+	b.SetParallelism(runtime.NumCPU())
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			q := benchSearches[i%len(benchSearches)]
+			benchStore.SearchPage(q.name, q.category, rand.Int32N(benchProducts), 2)
+			i++
+		}
+	})
+}
+
+// BenchmarkShardedGet runs BenchmarkGet's read load against ShardedStores
+// of increasing shard counts, so throughput can be compared across them.
+func BenchmarkShardedGet(b *testing.B) {
+	for _, shards := range []int{1, 4, 16} {
+		s := NewShardedStore(shards)
+		s.SeedBulk(benchProducts)
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetParallelism(runtime.NumCPU())
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					s.Get(rand.Int32N(benchProducts) + 1)
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkShardedUpdate measures concurrent single-product writes, which
+// only contend on the shard holding the product.
+func BenchmarkShardedUpdate(b *testing.B) {
+	for _, shards := range []int{1, 4, 16} {
+		s := NewShardedStore(shards)
+		s.SeedBulk(benchProducts)
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetParallelism(runtime.NumCPU())
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					s.UpdateDetails(rand.Int32N(benchProducts)+1, Product{Price: float64(rand.IntN(10000)+1) / 100})
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkSearchSorted compares an unsorted search returning every one of
+// the benchProducts products with the same search sorted by each field.
+func BenchmarkSearchSorted(b *testing.B) {
+	for _, field := range []SortField{"", SortByID, SortByName, SortByPrice, SortByBrand} {
+		name := "unsorted"
+		if field != "" {
+			name = "sort_by=" + string(field)
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				products, _ := benchStore.SearchLimited("", "", benchProducts, benchProducts)
+				if field != "" {
+					SortProducts(products, field, true)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkSimilarProducts measures an uncached similarity scan over the
+// whole catalog.
+func BenchmarkSimilarProducts(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		benchStore.similar.clear()
+		benchStore.SimilarProducts(rand.Int32N(benchProducts)+1, 10)
+	}
+}
+
+// BenchmarkCreate creates products one after another in a fresh store, so
+// it measures the cost of taking the write lock and indexing each product.
+func BenchmarkCreate(b *testing.B) {
+	b.ReportAllocs()
+	s := NewStore()
+	for b.Loop() {
+		s.Create(Product{Name: "Bench Product", Category: "Electronics", Brand: "Alpha", Price: 9.99, Stock: 10})
+	}
+}
+
+func BenchmarkSeedBulk(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		NewStore().SeedBulk(benchProducts)
+	}
+}
+
+// BenchmarkSearchLimited_ConcurrentWrite mixes one price update into every
+// ten searches, so searches contend with writers for the store lock.
+func BenchmarkSearchLimited_ConcurrentWrite(b *testing.B) {
+	s := newSeededStore(benchProducts)
+	b.ReportAllocs()
+	b.SetParallelism(runtime.NumCPU())
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if i%10 == 0 {
+				s.UpdateDetails(rand.Int32N(benchProducts)+1, Product{Price: float64(rand.IntN(10000)+1) / 100})
+			} else {
+				q := benchSearches[i%len(benchSearches)]
+				s.SearchLimited(q.name, q.category, 100, 20)
+			}
+			i++
+		}
+	})
+}
+
+// benchSNSTopicARN is the topic BenchmarkSNSPublish publishes to.
+const benchSNSTopicARN = "arn:aws:sns:us-east-1:123456789012:orders"
+
+// BenchmarkSNSPublish compares publishing through an SNS client created for
+// every request, as CreateOrderAsync used to, with the one client
+// orders.AsyncHandlers shares across requests. Both publish to a local fake
+// SNS endpoint, so the difference is the session and client setup.
+func BenchmarkSNSPublish(b *testing.B) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(`<PublishResponse><PublishResult><MessageId>bench</MessageId></PublishResult></PublishResponse>`))
+	}))
+	defer srv.Close()
+	cfg := &aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(srv.URL),
+		Credentials: credentials.NewStaticCredentials("bench", "bench", ""),
+	}
+	newClient := func() (*sns.SNS, error) {
+		sess, err := session.NewSession(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return sns.New(sess), nil
+	}
+	publish := func(client *sns.SNS) error {
+		_, err := client.Publish(&sns.PublishInput{
+			TopicArn: aws.String(benchSNSTopicARN),
+			Message:  aws.String(`{"order_id":"bench","customer_id":1}`),
+		})
+		return err
+	}
+
+	b.Run("client per request", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetParallelism(runtime.NumCPU())
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				client, err := newClient()
+				if err == nil {
+					err = publish(client)
+				}
+				if err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+	b.Run("shared client", func(b *testing.B) {
+		client, err := newClient()
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.ReportAllocs()
+		b.SetParallelism(runtime.NumCPU())
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if err := publish(client); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+}
+
+// TestGetThroughput fails if BenchmarkGet drops below minGetOpsPerSec. It
+// is a manual check, run only with PRODUCT_BENCH_THRESHOLDS set and on 4+
+// cores; no CI job runs it.
+func TestGetThroughput(t *testing.T) {
+	if os.Getenv("PRODUCT_BENCH_THRESHOLDS") == "" {
+		t.Skip("set PRODUCT_BENCH_THRESHOLDS to enforce benchmark thresholds")
+	}
+	if runtime.NumCPU() < 4 {
+		t.Skipf("threshold applies to 4+ cores, have %d", runtime.NumCPU())
+	}
+	res := testing.Benchmark(BenchmarkGet)
+	if opsPerSec := float64(res.N) / res.T.Seconds(); opsPerSec < minGetOpsPerSec {
+		t.Errorf("BenchmarkGet: %.0f ops/sec, want at least %d", opsPerSec, minGetOpsPerSec)
+	}
+}
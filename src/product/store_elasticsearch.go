@@ -0,0 +1,256 @@
+package product
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// esBulkSize is how many products are sent per _bulk request.
+	esBulkSize = 1000
+	// esFailureThreshold consecutive failures open the circuit breaker.
+	esFailureThreshold = 3
+	// esOpenFor is how long searches skip Elasticsearch once the breaker opens.
+	esOpenFor = 30 * time.Second
+)
+
+// esWildcardEscaper makes a string match literally inside a wildcard query.
+var esWildcardEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`)
+
+// ErrSearchUnavailable is returned while the circuit breaker is open.
+var ErrSearchUnavailable = errors.New("elasticsearch unavailable")
+
+// errIndexNotFound is returned for a 404 from Elasticsearch.
+var errIndexNotFound = errors.New("index not found")
+
+// esDocument is the indexed form of a product. Only search and filter
+// fields are indexed; hits are resolved against the in-memory store so
+// prices and stock are always current.
+type esDocument struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Brand       string  `json:"brand,omitempty"`
+	Category    string  `json:"category,omitempty"`
+	Price       float64 `json:"price"`
+}
+
+// SearchOptions is a relevance-ranked search request.
+type SearchOptions struct {
+	// Query is matched fuzzily against name (boosted), description, brand and category.
+	Query string
+	// Category, when set, must match exactly.
+	Category string
+	// Filter.Brand is matched as a case-insensitive substring and the price
+	// bounds are inclusive, as in the in-memory store.
+	Filter ProductFilter
+	Limit  int
+}
+
+// ElasticsearchStore adds typo-tolerant, relevance-ranked search on top of
+// a Store using the Elasticsearch REST API. After esFailureThreshold
+// consecutive errors it stops calling Elasticsearch for esOpenFor and
+// Search returns ErrSearchUnavailable so callers fall back to the store.
+type ElasticsearchStore struct {
+	store   *Store
+	baseURL string
+	index   string
+	client  *http.Client
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+func NewElasticsearchStore(store *Store, baseURL, index string) *ElasticsearchStore {
+	return &ElasticsearchStore{
+		store:   store,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		index:   index,
+		client:  &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// esPriceMapping maps price as a double; left to dynamic mapping, a whole
+// first price would make it a long.
+const esPriceMapping = `{"properties":{"price":{"type":"double"}}}`
+
+// IndexAll bulk-indexes every product in the store, esBulkSize per request.
+func (e *ElasticsearchStore) IndexAll(ctx context.Context) (int, error) {
+	if err := e.mapPrice(ctx); err != nil {
+		return 0, err
+	}
+	indexed := 0
+	var after int32
+	for {
+		page := e.store.ListAfter(after, esBulkSize)
+		if len(page) == 0 {
+			return indexed, nil
+		}
+		if err := e.bulkIndex(ctx, page); err != nil {
+			return indexed, err
+		}
+		indexed += len(page)
+		after = page[len(page)-1].ID
+	}
+}
+
+// mapPrice adds esPriceMapping to the index, creating the index if needed.
+func (e *ElasticsearchStore) mapPrice(ctx context.Context) error {
+	err := e.do(ctx, http.MethodPut, "/"+e.index+"/_mapping", "application/json", strings.NewReader(esPriceMapping), nil)
+	if errors.Is(err, errIndexNotFound) {
+		err = e.do(ctx, http.MethodPut, "/"+e.index, "application/json", strings.NewReader(`{"mappings":`+esPriceMapping+`}`), nil)
+	}
+	return err
+}
+
+func (e *ElasticsearchStore) bulkIndex(ctx context.Context, products []Product) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, p := range products {
+		enc.Encode(map[string]any{"index": map[string]any{"_index": e.index, "_id": strconv.Itoa(int(p.ID))}})
+		enc.Encode(esDocument{Name: p.Name, Description: p.Description, Brand: p.Brand, Category: p.Category, Price: p.Price})
+	}
+	var res struct {
+		Errors bool `json:"errors"`
+	}
+	if err := e.do(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", &body, &res); err != nil {
+		return err
+	}
+	if res.Errors {
+		return fmt.Errorf("elasticsearch rejected some documents in a bulk request of %d", len(products))
+	}
+	return nil
+}
+
+// Search returns matching products ordered by relevance with Relevance set
+// to the hit score, plus the total number of hits. Hits whose products have
+// since been deleted, or repriced out of the filter's bounds, are skipped.
+func (e *ElasticsearchStore) Search(ctx context.Context, opts SearchOptions) ([]Product, int, error) {
+	if !e.allow() {
+		return nil, 0, ErrSearchUnavailable
+	}
+
+	must := []any{map[string]any{"match_all": map[string]any{}}}
+	if opts.Query != "" {
+		must = []any{map[string]any{"multi_match": map[string]any{
+			"query":     opts.Query,
+			"fields":    []string{"name^3", "description", "brand", "category"},
+			"fuzziness": "AUTO",
+		}}}
+	}
+	filter := []any{}
+	if opts.Category != "" {
+		filter = append(filter, map[string]any{"term": map[string]any{"category.keyword": opts.Category}})
+	}
+	if opts.Filter.Brand != "" {
+		filter = append(filter, map[string]any{"wildcard": map[string]any{"brand.keyword": map[string]any{
+			"value":            "*" + esWildcardEscaper.Replace(opts.Filter.Brand) + "*",
+			"case_insensitive": true,
+		}}})
+	}
+	if opts.Filter.MinPrice != nil || opts.Filter.MaxPrice != nil {
+		bounds := map[string]any{}
+		if opts.Filter.MinPrice != nil {
+			bounds["gte"] = *opts.Filter.MinPrice
+		}
+		if opts.Filter.MaxPrice != nil {
+			bounds["lte"] = *opts.Filter.MaxPrice
+		}
+		filter = append(filter, map[string]any{"range": map[string]any{"price": bounds}})
+	}
+	query, _ := json.Marshal(map[string]any{
+		"size":             opts.Limit,
+		"_source":          false,
+		"track_total_hits": true,
+		"query":            map[string]any{"bool": map[string]any{"must": must, "filter": filter}},
+	})
+
+	var res struct {
+		Hits struct {
+			Total struct {
+				Value int `json:"value"`
+			} `json:"total"`
+			Hits []struct {
+				ID    string  `json:"_id"`
+				Score float64 `json:"_score"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	err := e.do(ctx, http.MethodPost, "/"+e.index+"/_search", "application/json", bytes.NewReader(query), &res)
+	// A client hanging up says nothing about Elasticsearch's health
+	if ctx.Err() == nil {
+		e.record(err)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	e.store.analytics.Record(opts.Query, opts.Category)
+
+	products := make([]Product, 0, len(res.Hits.Hits))
+	for _, hit := range res.Hits.Hits {
+		id, err := strconv.ParseInt(hit.ID, 10, 32)
+		if err != nil {
+			continue
+		}
+		if p, ok := e.store.Get(int32(id)); ok && opts.Filter.Matches(p) {
+			p.Relevance = hit.Score
+			products = append(products, p)
+		}
+	}
+	return products, res.Hits.Total.Value, nil
+}
+
+// do sends the request and decodes the response into out, unless out is nil.
+func (e *ElasticsearchStore) do(ctx context.Context, method, path, contentType string, body io.Reader, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, e.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("elasticsearch %s: %w", path, errIndexNotFound)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("elasticsearch %s: unexpected status %d", path, resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// allow reports whether the breaker lets a request through.
+func (e *ElasticsearchStore) allow() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return time.Now().After(e.openUntil)
+}
+
+// record counts consecutive failures, opening the breaker at the threshold.
+func (e *ElasticsearchStore) record(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err == nil {
+		e.failures = 0
+		return
+	}
+	e.failures++
+	if e.failures >= esFailureThreshold {
+		e.failures = 0
+		e.openUntil = time.Now().Add(esOpenFor)
+	}
+}
@@ -0,0 +1,185 @@
+package product
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultShardCount is used when NewShardedStore is given a non-positive shard count.
+const DefaultShardCount = 16
+
+// ShardedStore spreads products over N independent Stores (shard = id % N) so
+// that single-product reads and writes only contend on one shard's lock.
+// Multi-product queries fan out to every shard and merge the results by ID.
+type ShardedStore struct {
+	shards []*Store
+	lastID atomic.Int32
+}
+
+func NewShardedStore(n int) *ShardedStore {
+	if n <= 0 {
+		n = DefaultShardCount
+	}
+	s := &ShardedStore{shards: make([]*Store, n)}
+	for i := range s.shards {
+		s.shards[i] = NewStore()
+	}
+	return s
+}
+
+func (s *ShardedStore) shard(id int32) *Store {
+	n := int32(len(s.shards))
+	return s.shards[((id%n)+n)%n]
+}
+
+func (s *ShardedStore) Get(id int32) (Product, bool) {
+	return s.shard(id).Get(id)
+}
+
+func (s *ShardedStore) Create(incoming Product) Product {
+	id := s.lastID.Add(1)
+	created := Product{
+		ID:                id,
+		Name:              incoming.Name,
+		Category:          incoming.Category,
+		Description:       incoming.Description,
+		Brand:             incoming.Brand,
+		Price:             incoming.Price,
+		Stock:             incoming.Stock,
+		LowStockThreshold: incoming.LowStockThreshold,
+		IsPreOrder:        incoming.IsPreOrder,
+		PreOrderShipDate:  incoming.PreOrderShipDate,
+	}
+	return s.shard(id).put(withFeatures(created))
+}
+
+func (s *ShardedStore) UpdateDetails(id int32, incoming Product) (Product, bool) {
+	return s.shard(id).UpdateDetails(id, incoming)
+}
+
+// Delete removes the product and reports whether it existed.
+func (s *ShardedStore) Delete(id int32) bool {
+	return s.shard(id).remove(id)
+}
+
+// GetChangedSince merges every shard's changes, oldest first; the sync
+// token is the latest change on any shard.
+func (s *ShardedStore) GetChangedSince(since time.Time) ([]ChangedProduct, time.Time, error) {
+	var changed []ChangedProduct
+	var token time.Time
+	for _, shard := range s.shards {
+		c, t, err := shard.GetChangedSince(since)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		changed = append(changed, c...)
+		if t.After(token) {
+			token = t
+		}
+	}
+	sort.SliceStable(changed, func(i, j int) bool { return changed[i].UpdatedAt.Before(changed[j].UpdatedAt) })
+	return changed, token, nil
+}
+
+// List returns all products matching the optional name and category
+// substrings (case-insensitive) and filter, ordered by ID.
+func (s *ShardedStore) List(nameFilter, categoryFilter string, filter ProductFilter) []Product {
+	parts := make([][]Product, len(s.shards))
+	var g errgroup.Group
+	for i, shard := range s.shards {
+		g.Go(func() error {
+			parts[i] = shard.List(nameFilter, categoryFilter, filter)
+			return nil
+		})
+	}
+	g.Wait()
+
+	var results []Product
+	for _, part := range parts {
+		results = append(results, part...)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].ID < results[j].ID })
+	return results
+}
+
+// SearchLimited has the same semantics as Store.SearchLimited: the first
+// maxCheck products by ID are scanned, regardless of which shard holds them.
+func (s *ShardedStore) SearchLimited(nameFilter, categoryFilter string, maxCheck, maxReturn int) ([]Product, int) {
+	return s.SearchLimitedWhere(nameFilter, categoryFilter, ProductFilter{}, nil, maxCheck, maxReturn)
+}
+
+// SearchLimitedWhere has the same semantics as Store.SearchLimitedWhere.
+func (s *ShardedStore) SearchLimitedWhere(nameFilter, categoryFilter string, filter ProductFilter, where func(Product) bool, maxCheck, maxReturn int) ([]Product, int) {
+	if maxCheck <= 0 {
+		return nil, 0
+	}
+	if maxReturn < 0 {
+		maxReturn = 0
+	}
+
+	match := searchMatcher(nameFilter, categoryFilter, filter, where)
+
+	// The global first maxCheck IDs are always within the union of each shard's first maxCheck.
+	checkedParts := make([][]int32, len(s.shards))
+	matchParts := make([][]Product, len(s.shards))
+	var g errgroup.Group
+	for i, shard := range s.shards {
+		g.Go(func() error {
+			checkedParts[i], matchParts[i] = shard.scanPrefix(match, maxCheck)
+			return nil
+		})
+	}
+	g.Wait()
+
+	var checked []int32
+	for _, part := range checkedParts {
+		checked = append(checked, part...)
+	}
+	sort.Slice(checked, func(i, j int) bool { return checked[i] < checked[j] })
+	if len(checked) > maxCheck {
+		checked = checked[:maxCheck]
+	}
+	if len(checked) == 0 {
+		return make([]Product, 0, maxReturn), 0
+	}
+	lastChecked := checked[len(checked)-1]
+
+	var matches []Product
+	for _, part := range matchParts {
+		for _, p := range part {
+			if p.ID <= lastChecked {
+				matches = append(matches, p)
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+
+	results := make([]Product, 0, maxReturn)
+	for _, p := range matches {
+		if len(results) >= maxReturn {
+			break
+		}
+		results = append(results, p)
+	}
+	return results, len(matches)
+}
+
+// SeedBulk generates the same products as Store.SeedBulk, seeding every shard concurrently.
+func (s *ShardedStore) SeedBulk(n int) {
+	if n <= 0 {
+		return
+	}
+
+	var g errgroup.Group
+	for i, shard := range s.shards {
+		g.Go(func() error {
+			shard.seedShard(n, i, len(s.shards))
+			return nil
+		})
+	}
+	g.Wait()
+	s.lastID.Store(int32(n))
+}
@@ -0,0 +1,1726 @@
+package product
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+// newSeededStore returns a store holding n seed products.
+func newSeededStore(n int) *Store {
+	s := NewStore()
+	s.SeedBulk(n)
+	return s
+}
+
+func TestStoreGet(t *testing.T) {
+	s := newSeededStore(10)
+	s.Delete(4)
+
+	tests := []struct {
+		name   string
+		id     int32
+		wantOK bool
+	}{
+		{"found", 3, true},
+		{"first", 1, true},
+		{"last", 10, true},
+		{"not found", 11, false},
+		{"zero", 0, false},
+		{"negative", -1, false},
+		{"deleted", 4, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ok := s.Get(tt.id)
+			if ok != tt.wantOK {
+				t.Fatalf("Get(%d) ok = %v, want %v", tt.id, ok, tt.wantOK)
+			}
+			if ok && p.ID != tt.id {
+				t.Errorf("Get(%d) returned product %d", tt.id, p.ID)
+			}
+		})
+	}
+}
+
+func TestStoreGetMany(t *testing.T) {
+	s := newSeededStore(5)
+	found, missing := s.GetMany([]int32{2, 9, 5, 0})
+	if len(found) != 2 || found[2].ID != 2 || found[5].ID != 5 {
+		t.Errorf("found = %v, want products 2 and 5", found)
+	}
+	if fmt.Sprint(missing) != "[9 0]" {
+		t.Errorf("missing = %v, want [9 0]", missing)
+	}
+}
+
+func TestStoreCreate(t *testing.T) {
+	tests := []struct {
+		name string
+		// existing is put into the store before Create
+		existing []Product
+		incoming Product
+		wantID   int32
+	}{
+		{"first product", nil, Product{Name: "Desk", Price: 10}, 1},
+		{"after seeded", []Product{{ID: 1, Name: "A"}, {ID: 2, Name: "B"}}, Product{Name: "Desk"}, 3},
+		{"after manually set ID", []Product{{ID: 10, Name: "A"}}, Product{Name: "Desk"}, 11},
+		{"incoming ID of an existing product is ignored", []Product{{ID: 1, Name: "A"}}, Product{ID: 1, Name: "Desk"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStore()
+			for _, p := range tt.existing {
+				s.put(p)
+			}
+			created := s.Create(tt.incoming)
+			if created.ID != tt.wantID {
+				t.Fatalf("created ID = %d, want %d", created.ID, tt.wantID)
+			}
+			if created.Slug == "" || created.UpdatedAt.IsZero() {
+				t.Errorf("created product has no slug or update time: %+v", created)
+			}
+			for _, p := range tt.existing {
+				if got, _ := s.Get(p.ID); got.Name != p.Name {
+					t.Errorf("product %d was overwritten: %+v", p.ID, got)
+				}
+			}
+			if got, ok := s.GetBySlug(created.Slug); !ok || got.ID != created.ID {
+				t.Errorf("GetBySlug(%q) = %+v, %v", created.Slug, got, ok)
+			}
+		})
+	}
+}
+
+func TestStoreUpdateDetails(t *testing.T) {
+	original := Product{ID: 1, Name: "Desk", Category: "Home", Description: "Oak", Brand: "Alpha", Price: 100, Stock: 5}
+	tests := []struct {
+		name     string
+		id       int32
+		incoming Product
+		want     Product
+		wantOK   bool
+	}{
+		{"name only keeps the rest", 1, Product{Name: "Desk v2"}, Product{Name: "Desk v2", Category: "Home", Description: "Oak", Brand: "Alpha", Price: 100}, true},
+		{"every field", 1, Product{Name: "Table", Category: "Office", Description: "Pine", Brand: "Beta", Price: 80}, Product{Name: "Table", Category: "Office", Description: "Pine", Brand: "Beta", Price: 80}, true},
+		{"zero price is ignored", 1, Product{Brand: "Gamma", Price: 0}, Product{Name: "Desk", Category: "Home", Description: "Oak", Brand: "Gamma", Price: 100}, true},
+		{"not found", 2, Product{Name: "Chair"}, Product{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStore()
+			s.put(original)
+			got, ok := s.UpdateDetails(tt.id, tt.incoming)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if got.Name != tt.want.Name || got.Category != tt.want.Category || got.Description != tt.want.Description || got.Brand != tt.want.Brand || got.Price != tt.want.Price {
+				t.Errorf("updated = %+v, want %+v", got, tt.want)
+			}
+			if got.Stock != original.Stock {
+				t.Errorf("stock = %d, want it unchanged at %d", got.Stock, original.Stock)
+			}
+			if stored, _ := s.Get(tt.id); stored.Name != got.Name || stored.Price != got.Price {
+				t.Errorf("stored %+v differs from returned %+v", stored, got)
+			}
+		})
+	}
+}
+
+func TestStoreDelete(t *testing.T) {
+	s := newSeededStore(3)
+	deleted, _ := s.Get(2)
+
+	steps := []struct {
+		name string
+		id   int32
+		want bool
+	}{
+		{"existing", 2, true},
+		{"twice", 2, false},
+		{"never existed", 9, false},
+	}
+	for _, step := range steps {
+		if got := s.Delete(step.id); got != step.want {
+			t.Errorf("%s: Delete(%d) = %v, want %v", step.name, step.id, got, step.want)
+		}
+	}
+	if _, ok := s.GetBySlug(deleted.Slug); ok {
+		t.Error("deleted product is still found by slug")
+	}
+	if ids := productIDs(s.ListAfter(0, 10)); ids != "[1 3]" {
+		t.Errorf("ListAfter after delete = %s, want [1 3]", ids)
+	}
+	changed, _, _ := s.GetChangedSince(deleted.UpdatedAt)
+	if len(changed) != 1 || !changed[0].Deleted || changed[0].ID != 2 {
+		t.Errorf("changes after delete = %+v, want product 2 deleted", changed)
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		name string
+		id   int32
+		want string
+	}{
+		{"Product Alpha", 12345, "product-alpha-12345"},
+		{"  Desk -- Lamp  ", 7, "desk-lamp-7"},
+		{"Café & Bar!", 3, "caf-bar-3"},
+		{"snake_case name", 4, "snake-case-name-4"},
+		{"Product Alpha 12", 12, "product-alpha-12"},
+		{"Product Alpha 12", 112, "product-alpha-12-112"},
+		{"!!!", 5, "5"},
+		{"", 6, "6"},
+	}
+	for _, tt := range tests {
+		if got := Slugify(tt.name, tt.id); got != tt.want {
+			t.Errorf("Slugify(%q, %d) = %q, want %q", tt.name, tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestStoreGetBySlug(t *testing.T) {
+	s := newSeededStore(3)
+	if p, ok := s.GetBySlug("product-gamma-3"); !ok || p.ID != 3 {
+		t.Errorf("GetBySlug(product-gamma-3) = %d, %v, want seed product 3", p.ID, ok)
+	}
+
+	created := s.Create(Product{Name: "Desk Lamp", Price: 20})
+	if created.Slug != "desk-lamp-4" {
+		t.Fatalf("created slug = %q, want desk-lamp-4", created.Slug)
+	}
+	// Renaming keeps the published slug
+	s.UpdateDetails(created.ID, Product{Name: "Floor Lamp"})
+	if p, ok := s.GetBySlug("desk-lamp-4"); !ok || p.Name != "Floor Lamp" {
+		t.Errorf("GetBySlug after rename = %+v, %v", p, ok)
+	}
+	s.Delete(created.ID)
+	if _, ok := s.GetBySlug("desk-lamp-4"); ok {
+		t.Error("deleted product is still found by slug")
+	}
+}
+
+func TestStoreSlugsUniqueUnderConcurrentCreates(t *testing.T) {
+	s := NewStore()
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				s.Create(Product{Name: "Same Name", Price: 1})
+			}
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for _, p := range s.List("", "", ProductFilter{}) {
+		if seen[p.Slug] {
+			t.Fatalf("slug %q assigned twice", p.Slug)
+		}
+		seen[p.Slug] = true
+		if got, ok := s.GetBySlug(p.Slug); !ok || got.ID != p.ID {
+			t.Errorf("GetBySlug(%q) = %d, want %d", p.Slug, got.ID, p.ID)
+		}
+	}
+	if len(seen) != 400 {
+		t.Errorf("%d distinct slugs, want 400", len(seen))
+	}
+}
+
+func TestStoreGetChangedSince(t *testing.T) {
+	s := newSeededStore(3)
+	_, ref, err := s.GetChangedSince(s.changes.start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := s.Create(Product{Name: "Lamp", Price: 10})
+	s.UpdateDetails(1, Product{Price: 11})
+	s.UpdateDetails(1, Product{Price: 12})
+	s.Delete(2)
+	// Stock movements are not catalog changes
+	s.DecrementStock(3, 1)
+
+	changed, token, err := s.GetChangedSince(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		id      int32
+		deleted bool
+	}{{created.ID, false}, {1, false}, {2, true}}
+	if len(changed) != len(want) {
+		t.Fatalf("got %d changes, want %d: %+v", len(changed), len(want), changed)
+	}
+	for i, w := range want {
+		c := changed[i]
+		if c.ID != w.id || c.Deleted != w.deleted || !c.UpdatedAt.After(ref) {
+			t.Errorf("change %d = product %d deleted %v at %v, want product %d deleted %v after %v", i, c.ID, c.Deleted, c.UpdatedAt, w.id, w.deleted, ref)
+		}
+	}
+	if changed[1].Price != 12 {
+		t.Errorf("updated product has price %v, want its latest 12", changed[1].Price)
+	}
+
+	if changed, _, _ := s.GetChangedSince(token); len(changed) != 0 {
+		t.Errorf("changes since the sync token = %+v, want none", changed)
+	}
+	if _, _, err := s.GetChangedSince(ref.Add(-time.Hour)); !errors.Is(err, ErrChangesExpired) {
+		t.Errorf("err = %v for a time before the history, want ErrChangesExpired", err)
+	}
+}
+
+func TestStoreGetChangedSinceAfterCompaction(t *testing.T) {
+	s := newSeededStore(2)
+	_, ref, _ := s.GetChangedSince(s.changes.start)
+	for i := 0; i < 3*changeCompactMin; i++ {
+		s.UpdateDetails(int32(i%2+1), Product{Price: float64(i + 1)})
+	}
+	changed, _, err := s.GetChangedSince(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changedIDs(changed) != "[1 2]" || changed[1].Price != 3*changeCompactMin {
+		t.Errorf("changes = %+v, want products 1 and 2 at their latest prices", changed)
+	}
+	if len(s.changes.entries) > changeCompactMin {
+		t.Errorf("change log holds %d entries for 2 products", len(s.changes.entries))
+	}
+}
+
+func TestStoreSnapshotRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		store func() *Store
+	}{
+		{"seeded", func() *Store {
+			s := newSeededStore(50)
+			s.Delete(7)
+			s.Create(Product{Name: "Desk Lamp", Price: 20, PricingTiers: []PricingTier{{MinQuantity: 10, DiscountPercent: 5}}})
+			return s
+		}},
+		{"empty", NewStore},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := tt.store()
+			var buf bytes.Buffer
+			if err := src.WriteSnapshot(&buf); err != nil {
+				t.Fatal(err)
+			}
+			dst := NewStore()
+			dst.SeedBulk(3)
+			if err := dst.LoadSnapshot(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(dst.products, src.products) {
+				t.Error("products differ after the round trip")
+			}
+			if !slices.Equal(dst.sortedKeys, src.sortedKeys) || !maps.Equal(dst.slugs, src.slugs) || dst.nextID != src.nextID {
+				t.Errorf("indexes differ after the round trip: %d keys, %d slugs, next ID %d, want %d, %d, %d",
+					len(dst.sortedKeys), len(dst.slugs), dst.nextID, len(src.sortedKeys), len(src.slugs), src.nextID)
+			}
+			if created := dst.Create(Product{Name: "Next"}); created.ID != src.nextID {
+				t.Errorf("Create after loading got ID %d, want %d", created.ID, src.nextID)
+			}
+		})
+	}
+}
+
+func TestStoreLoadSnapshotRejectsBadSnapshots(t *testing.T) {
+	encode := func(snap snapshot) *bytes.Buffer {
+		var buf bytes.Buffer
+		gob.NewEncoder(&buf).Encode(snap)
+		return &buf
+	}
+	p := seedProduct(1)
+	tests := []struct {
+		name string
+		r    io.Reader
+	}{
+		{"not gob", strings.NewReader("products")},
+		{"other version", encode(snapshot{Version: snapshotVersion + 1, Products: map[int32]Product{1: p}, SortedKeys: []int32{1}, Slugs: map[string]int32{p.Slug: 1}})},
+		{"indexes out of step", encode(snapshot{Version: snapshotVersion, Products: map[int32]Product{1: p}, Slugs: map[string]int32{p.Slug: 1}})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSeededStore(3)
+			if err := s.LoadSnapshot(tt.r); err == nil {
+				t.Fatal("LoadSnapshot accepted a bad snapshot")
+			}
+			if _, ok := s.Get(3); !ok {
+				t.Error("a rejected snapshot replaced the catalog")
+			}
+		})
+	}
+}
+
+func TestStoreLoad(t *testing.T) {
+	s := newSeededStore(3)
+	s.Load([]Product{{ID: 20, Name: "Desk", Price: 50}, {ID: 5, Name: "Lamp", Price: 10}, {ID: 20, Name: "Desk v2", Price: 55}})
+	if got := productIDs(s.ListAfter(0, 10)); got != "[5 20]" {
+		t.Errorf("loaded products %s, want [5 20]", got)
+	}
+	if p, ok := s.GetBySlug("desk-v2-20"); !ok || p.Price != 55 {
+		t.Errorf("GetBySlug(desk-v2-20) = %+v, %v, want the later duplicate", p, ok)
+	}
+	if created := s.Create(Product{Name: "Next"}); created.ID != 21 {
+		t.Errorf("Create after Load got ID %d, want 21", created.ID)
+	}
+}
+
+func TestStoreProductInUse(t *testing.T) {
+	s := newSeededStore(4)
+	if _, err := s.CreateValidatedBundle(Bundle{Name: "Kit", ComponentIDs: []int32{1, 2}, BundlePrice: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Reserve([]ReservationItem{{ProductID: 3, Quantity: 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id   int32
+		want bool
+	}{
+		{1, true},  // bundle component
+		{3, true},  // reserved
+		{4, false}, // free
+	}
+	for _, tt := range tests {
+		if got := s.ProductInUse(tt.id); got != tt.want {
+			t.Errorf("ProductInUse(%d) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestStoreSeedBulk(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+	}{
+		{"none", 0},
+		{"one", 1},
+		{"fewer than the brands", 5},
+		{"many", 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSeededStore(tt.n)
+			if got := len(s.List("", "", ProductFilter{})); got != tt.n {
+				t.Fatalf("seeded %d products, want %d", got, tt.n)
+			}
+			for i := 1; i <= tt.n; i++ {
+				p, ok := s.Get(int32(i))
+				if !ok {
+					t.Fatalf("product %d missing", i)
+				}
+				wantBrand := seedBrands[(i-1)%len(seedBrands)]
+				wantPrice := float64(i%110+1) + float64(i%100)/100
+				if p.Brand != wantBrand || p.Category != seedCategories[(i-1)%len(seedCategories)] {
+					t.Errorf("product %d brand/category = %s/%s", i, p.Brand, p.Category)
+				}
+				if math.Abs(p.Price-wantPrice) > 1e-9 {
+					t.Errorf("product %d price = %v, want %v", i, p.Price, wantPrice)
+				}
+				if p.Name != fmt.Sprintf("Product %s %d", wantBrand, i) {
+					t.Errorf("product %d name = %q", i, p.Name)
+				}
+			}
+			if created := s.Create(Product{Name: "Next"}); created.ID != int32(tt.n)+1 {
+				t.Errorf("Create after seeding got ID %d, want %d", created.ID, tt.n+1)
+			}
+		})
+	}
+}
+
+func TestStoreSeedBulkReplacesCatalog(t *testing.T) {
+	s := newSeededStore(50)
+	s.SeedBulk(10)
+	if got := len(s.List("", "", ProductFilter{})); got != 10 {
+		t.Errorf("reseeded store holds %d products, want 10", got)
+	}
+	if _, ok := s.Get(11); ok {
+		t.Error("product 11 survived reseeding with 10")
+	}
+}
+
+func TestStoreRebuildDoesNotBlockReads(t *testing.T) {
+	s := newSeededStore(10)
+	took := make(chan time.Duration)
+	go func() {
+		start := time.Now()
+		s.Rebuild(300000)
+		took <- time.Since(start)
+	}()
+
+	var reads int
+	var slowest time.Duration
+	for {
+		select {
+		case d := <-took:
+			if reads == 0 {
+				t.Fatal("no reads completed during the rebuild")
+			}
+			// Only the swap holds the lock, so no read waits for a
+			// meaningful part of the rebuild
+			if slowest > d/10 {
+				t.Errorf("slowest of %d reads took %v during a %v rebuild", reads, slowest, d)
+			}
+			if _, ok := s.Get(300000); !ok {
+				t.Error("rebuilt catalog is missing product 300000")
+			}
+			return
+		default:
+		}
+		start := time.Now()
+		// Products 1-10 are in both the old and the new catalog
+		if _, ok := s.Get(int32(reads%10 + 1)); !ok {
+			t.Fatalf("Get(%d) failed during the rebuild", reads%10+1)
+		}
+		slowest = max(slowest, time.Since(start))
+		reads++
+	}
+}
+
+func TestStoreStartRebuild(t *testing.T) {
+	s := newSeededStore(10)
+	if !s.StartRebuild(200000) {
+		t.Fatal("StartRebuild refused with no rebuild running")
+	}
+	if s.StartRebuild(5) {
+		t.Error("a second rebuild started while one was running")
+	}
+	if status := s.RebuildStatus(); !status.Rebuilding || status.Products != 200000 || status.StartedAt == nil {
+		t.Errorf("status while rebuilding = %+v", status)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for s.RebuildStatus().Rebuilding {
+		if time.Now().After(deadline) {
+			t.Fatal("rebuild did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status := s.RebuildStatus(); status.CompletedAt == nil {
+		t.Errorf("finished rebuild has no completion time: %+v", status)
+	}
+	if _, ok := s.Get(200000); !ok {
+		t.Error("rebuilt catalog is missing product 200000")
+	}
+	if !s.StartRebuild(5) {
+		t.Error("StartRebuild refused after the last rebuild finished")
+	}
+}
+
+func TestStoreSearchLimited(t *testing.T) {
+	// 70 seed products: 10 per brand, 7 per category
+	s := newSeededStore(70)
+
+	tests := []struct {
+		name      string
+		nameQ     string
+		category  string
+		maxCheck  int
+		maxReturn int
+		wantIDs   string
+		wantTotal int
+	}{
+		{"no filters", "", "", 5, 10, "[1 2 3 4 5]", 5},
+		{"name filter", "alpha", "", 70, 3, "[1 8 15]", 10},
+		{"name is case-insensitive", "ALPHA", "", 70, 3, "[1 8 15]", 10},
+		{"category filter", "", "books", 70, 2, "[2 12]", 7},
+		{"both filters", "alpha", "electronics", 70, 10, "[1]", 1},
+		{"both filters, second brand", "beta", "books", 70, 10, "[2]", 1},
+		{"maxCheck bounds the scan", "alpha", "", 8, 10, "[1 8]", 2},
+		{"maxCheck one short of a match", "alpha", "", 7, 10, "[1]", 1},
+		{"maxCheck past the catalog", "", "", 1000, 2, "[1 2]", 70},
+		{"maxReturn truncates but total counts", "", "", 50, 3, "[1 2 3]", 50},
+		{"zero maxReturn", "alpha", "", 70, 0, "[]", 10},
+		{"negative maxReturn", "alpha", "", 70, -1, "[]", 10},
+		{"zero maxCheck", "", "", 0, 10, "[]", 0},
+		{"no match", "nothing", "", 70, 10, "[]", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total := s.SearchLimited(tt.nameQ, tt.category, tt.maxCheck, tt.maxReturn)
+			if total != tt.wantTotal {
+				t.Errorf("total = %d, want %d", total, tt.wantTotal)
+			}
+			if ids := productIDs(got); ids != tt.wantIDs {
+				t.Errorf("ids = %s, want %s", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestStoreSearchLimitedIsDeterministic(t *testing.T) {
+	s := newSeededStore(500)
+	// Out-of-order writes must keep the scan in ID order
+	s.Delete(3)
+	s.Delete(250)
+	s.put(Product{ID: 1000, Name: "Product Alpha 1000", Category: "Books", Brand: "Alpha"})
+	s.Create(Product{Name: "Product Alpha new", Brand: "Alpha"})
+
+	tests := []struct {
+		name      string
+		nameQ     string
+		category  string
+		maxCheck  int
+		maxReturn int
+	}{
+		{"no filters", "", "", 100, 20},
+		{"name", "alpha", "", 600, 50},
+		{"category", "", "books", 600, 20},
+		{"whole catalog", "", "", 1000, 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, firstTotal := s.SearchLimited(tt.nameQ, tt.category, tt.maxCheck, tt.maxReturn)
+			for i := 0; i < 5; i++ {
+				got, total := s.SearchLimited(tt.nameQ, tt.category, tt.maxCheck, tt.maxReturn)
+				if productIDs(got) != productIDs(first) || total != firstTotal {
+					t.Fatalf("call %d returned %s (%d), first returned %s (%d)", i+2, productIDs(got), total, productIDs(first), firstTotal)
+				}
+			}
+			for i := 1; i < len(first); i++ {
+				if first[i-1].ID >= first[i].ID {
+					t.Fatalf("results not in ID order: %s", productIDs(first))
+				}
+			}
+		})
+	}
+}
+
+func TestStoreBrandFilter(t *testing.T) {
+	catalog := []Product{
+		{Name: "Desk", Brand: "Alpha", Category: "Home", Price: 50},
+		{Name: "Desk lamp", Brand: "Beta", Category: "Home", Price: 20},
+		{Name: "Phone", Brand: "alphabet", Category: "Electronics", Price: 500},
+		{Name: "Phone case", Brand: "ALPHA", Category: "Electronics", Price: 10},
+		{Name: "Chair", Brand: "", Category: "Home", Price: 80},
+	}
+	s := NewStore()
+	sharded := NewShardedStore(3)
+	for _, p := range catalog {
+		s.Create(p)
+		sharded.Create(p)
+	}
+
+	tests := []struct {
+		name     string
+		nameQ    string
+		category string
+		brand    string
+		want     string
+	}{
+		{"brand only", "", "", "alpha", "[1 3 4]"},
+		{"brand is a substring", "", "", "PHA", "[1 3 4]"},
+		{"brand and category", "", "electronics", "Alpha", "[3 4]"},
+		{"brand and name", "desk", "", "alpha", "[1]"},
+		{"brand, name and category", "phone", "electronics", "bet", "[3]"},
+		{"no match", "", "", "omega", "[]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := ProductFilter{Brand: tt.brand}
+			got, total := s.SearchLimitedWhere(tt.nameQ, tt.category, filter, nil, 100, 100)
+			if productIDs(got) != tt.want || total != len(got) {
+				t.Errorf("SearchLimitedWhere = %s (%d), want %s", productIDs(got), total, tt.want)
+			}
+			listed := s.List(tt.nameQ, tt.category, filter)
+			slices.SortFunc(listed, func(a, b Product) int { return int(a.ID - b.ID) })
+			if productIDs(listed) != tt.want {
+				t.Errorf("List = %s, want %s", productIDs(listed), tt.want)
+			}
+			if got, _ := sharded.SearchLimitedWhere(tt.nameQ, tt.category, filter, nil, 100, 100); productIDs(got) != tt.want {
+				t.Errorf("sharded SearchLimitedWhere = %s, want %s", productIDs(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestSortProducts(t *testing.T) {
+	catalog := []Product{
+		{ID: 3, Name: "banana", Brand: "Beta", Category: "Grocery", Price: 2},
+		{ID: 1, Name: "Apple", Brand: "alpha", Category: "grocery", Price: 2},
+		{ID: 4, Name: "cherry", Brand: "Alpha", Category: "Books", Price: 9},
+		{ID: 2, Name: "Date", Brand: "Gamma", Category: "Home", Price: 0.5},
+	}
+	tests := []struct {
+		field SortField
+		desc  bool
+		want  string
+	}{
+		{SortByID, false, "[1 2 3 4]"},
+		{SortByID, true, "[4 3 2 1]"},
+		{SortByName, false, "[1 3 4 2]"},
+		{SortByName, true, "[2 4 3 1]"},
+		// Ties (equal prices, brands or categories) stay in ascending ID order
+		{SortByPrice, false, "[2 1 3 4]"},
+		{SortByPrice, true, "[4 1 3 2]"},
+		{SortByBrand, false, "[1 4 3 2]"},
+		{SortByCategory, true, "[2 1 3 4]"},
+	}
+	for _, tt := range tests {
+		products := slices.Clone(catalog)
+		SortProducts(products, tt.field, tt.desc)
+		if got := productIDs(products); got != tt.want {
+			t.Errorf("SortProducts(%s, desc=%v) = %s, want %s", tt.field, tt.desc, got, tt.want)
+		}
+	}
+
+	for _, name := range []string{"id", "name", "price", "category", "brand"} {
+		if f, ok := ParseSortField(name); !ok || string(f) != name {
+			t.Errorf("ParseSortField(%q) = %q, %v", name, f, ok)
+		}
+	}
+	for _, name := range []string{"", "Price", "stock"} {
+		if _, ok := ParseSortField(name); ok {
+			t.Errorf("ParseSortField(%q) accepted an unknown field", name)
+		}
+	}
+}
+
+func TestStoreSearchLimitedWhere(t *testing.T) {
+	s := newSeededStore(70)
+	max := 20.0
+	got, total := s.SearchLimitedWhere("", "", ProductFilter{Brand: "gam", MaxPrice: &max}, func(p Product) bool { return p.ID%2 == 1 }, 70, 10)
+	for _, p := range got {
+		if p.Brand != "Gamma" || p.Price > max || p.ID%2 != 1 {
+			t.Errorf("product %+v does not match", p)
+		}
+	}
+	if total != len(got) || total == 0 {
+		t.Errorf("total = %d for %d products", total, len(got))
+	}
+}
+
+func TestStoreSearchPage(t *testing.T) {
+	s := newSeededStore(70)
+
+	tests := []struct {
+		name     string
+		afterID  int32
+		limit    int
+		wantIDs  string
+		wantMore bool
+	}{
+		{"first page", 0, 3, "[1 8 15]", true},
+		{"middle page", 15, 3, "[22 29 36]", true},
+		{"after an ID that is not a match", 16, 3, "[22 29 36]", true},
+		{"exactly the last page", 43, 3, "[50 57 64]", false},
+		{"past the end", 64, 3, "[]", false},
+		{"zero limit", 0, 0, "[]", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, more := s.SearchPage("alpha", "", tt.afterID, tt.limit)
+			if ids := productIDs(got); ids != tt.wantIDs || more != tt.wantMore {
+				t.Errorf("got %s more %v, want %s %v", ids, more, tt.wantIDs, tt.wantMore)
+			}
+		})
+	}
+}
+
+func TestStoreList(t *testing.T) {
+	s := newSeededStore(70)
+	min, max := 10.0, 30.0
+
+	tests := []struct {
+		name     string
+		nameQ    string
+		category string
+		filter   ProductFilter
+		want     func(Product) bool
+	}{
+		{"empty filters return all", "", "", ProductFilter{}, func(Product) bool { return true }},
+		{"name", "delta", "", ProductFilter{}, func(p Product) bool { return p.Brand == "Delta" }},
+		{"category", "", "toys", ProductFilter{}, func(p Product) bool { return p.Category == "Toys" }},
+		{"brand", "", "", ProductFilter{Brand: "OMEGA"}, func(p Product) bool { return p.Brand == "Omega" }},
+		{"price range", "", "", ProductFilter{MinPrice: &min, MaxPrice: &max}, func(p Product) bool { return p.Price >= min && p.Price <= max }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := s.List(tt.nameQ, tt.category, tt.filter)
+			want := 0
+			for _, p := range s.ListAfter(0, 100) {
+				if tt.want(p) {
+					want++
+				}
+			}
+			if len(got) != want || want == 0 {
+				t.Errorf("List returned %d products, want %d", len(got), want)
+			}
+			for _, p := range got {
+				if !tt.want(p) {
+					t.Errorf("product %d should not match", p.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestStoreListAfter(t *testing.T) {
+	s := newSeededStore(5)
+	tests := []struct {
+		after int32
+		limit int
+		want  string
+	}{
+		{0, 2, "[1 2]"},
+		{2, 10, "[3 4 5]"},
+		{5, 10, "[]"},
+	}
+	for _, tt := range tests {
+		if got := productIDs(s.ListAfter(tt.after, tt.limit)); got != tt.want {
+			t.Errorf("ListAfter(%d, %d) = %s, want %s", tt.after, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestStoreBulkCreate(t *testing.T) {
+	s := newSeededStore(2)
+	created := s.BulkCreate([]Product{{Name: "A"}, {Name: "B", ID: 1}})
+	if productIDs(created) != "[3 4]" {
+		t.Fatalf("created IDs = %s, want [3 4]", productIDs(created))
+	}
+	if productIDs(s.ListAfter(0, 10)) != "[1 2 3 4]" {
+		t.Errorf("catalog = %s", productIDs(s.ListAfter(0, 10)))
+	}
+	if p, _ := s.Get(1); p.Name == "B" {
+		t.Error("BulkCreate overwrote product 1")
+	}
+}
+
+func TestStoreSetPricingTiers(t *testing.T) {
+	s := newSeededStore(1)
+	tiers := []PricingTier{{MinQuantity: 10, DiscountPercent: 5}}
+	if p, ok := s.SetPricingTiers(1, tiers); !ok || len(p.PricingTiers) != 1 {
+		t.Errorf("SetPricingTiers(1) = %+v, %v", p, ok)
+	}
+	tiers[0].DiscountPercent = 50
+	if p, _ := s.Get(1); p.PricingTiers[0].DiscountPercent != 5 {
+		t.Error("stored tiers share the caller's slice")
+	}
+	if _, ok := s.SetPricingTiers(2, tiers); ok {
+		t.Error("SetPricingTiers on a missing product succeeded")
+	}
+}
+
+func TestPriceForQuantity(t *testing.T) {
+	p := Product{Price: 20, PricingTiers: []PricingTier{{MinQuantity: 10, DiscountPercent: 0.05}, {MinQuantity: 100, DiscountPercent: 0.15}}}
+	tests := []struct {
+		qty  int
+		want float64
+	}{
+		{1, 20},
+		{9, 20},
+		{10, 19},
+		{99, 19},
+		{100, 17},
+		{5000, 17},
+	}
+	for _, tt := range tests {
+		if got := p.PriceForQuantity(tt.qty); got != tt.want {
+			t.Errorf("PriceForQuantity(%d) = %v, want %v", tt.qty, got, tt.want)
+		}
+	}
+	if got := (Product{Price: 9.99}).PriceForQuantity(1000); got != 9.99 {
+		t.Errorf("untiered PriceForQuantity = %v, want 9.99", got)
+	}
+}
+
+func TestValidatePricingTiers(t *testing.T) {
+	tests := []struct {
+		name    string
+		tiers   []PricingTier
+		wantErr bool
+	}{
+		{"none", nil, false},
+		{"ascending", []PricingTier{{10, 0.05}, {100, 0.1}}, false},
+		{"largest discount", []PricingTier{{1, MaxTierDiscount}}, false},
+		{"unsorted", []PricingTier{{100, 0.1}, {10, 0.05}}, true},
+		{"overlapping", []PricingTier{{10, 0.05}, {10, 0.1}}, true},
+		{"zero quantity", []PricingTier{{0, 0.05}}, true},
+		{"negative discount", []PricingTier{{10, -0.05}}, true},
+		{"discount too large", []PricingTier{{10, 1}}, true},
+	}
+	for _, tt := range tests {
+		if err := ValidatePricingTiers(tt.tiers); (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestStoreBulkUpdatePrice(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      ProductQuery
+		multiplier float64
+		wantCount  int
+		wantErr    error
+	}{
+		{"by brand", ProductQuery{Brand: "alpha"}, 2, 10, nil},
+		{"by brand and category", ProductQuery{Brand: "Alpha", Category: "Electronics"}, 0.5, 1, nil},
+		{"no match", ProductQuery{Brand: "None"}, 2, 0, nil},
+		{"multiplier too small", ProductQuery{}, 0.001, 0, ErrInvalidMultiplier},
+		{"multiplier too large", ProductQuery{}, 11, 0, ErrInvalidMultiplier},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSeededStore(70)
+			before, _ := s.Get(1)
+			if n := s.CountMatching(tt.query); tt.wantErr == nil && n != tt.wantCount {
+				t.Errorf("CountMatching = %d, want %d", n, tt.wantCount)
+			}
+			n, err := s.BulkUpdatePrice(tt.query, tt.multiplier)
+			if !errors.Is(err, tt.wantErr) || n != tt.wantCount {
+				t.Fatalf("BulkUpdatePrice = %d, %v, want %d, %v", n, err, tt.wantCount, tt.wantErr)
+			}
+			after, _ := s.Get(1)
+			if tt.wantCount > 0 && after.Price != math.Round(before.Price*tt.multiplier*100)/100 {
+				t.Errorf("product 1 price %v -> %v with multiplier %v", before.Price, after.Price, tt.multiplier)
+			}
+		})
+	}
+}
+
+func TestStoreSeedSample(t *testing.T) {
+	s := NewStore()
+	s.SeedSample()
+	s.SeedSample()
+	if p, ok := s.Get(1); !ok || p.Name != "Sample Product" {
+		t.Fatalf("Get(1) = %+v, %v", p, ok)
+	}
+	if created := s.Create(Product{Name: "Next"}); created.ID != 2 {
+		t.Errorf("Create after SeedSample got ID %d, want 2", created.ID)
+	}
+}
+
+func TestStoreReserve(t *testing.T) {
+	tests := []struct {
+		name             string
+		items            []ReservationItem
+		wantErr          bool
+		wantMissing      []int32
+		wantInsufficient []int32
+		// wantStock is the stock of products 1 and 2 afterwards
+		wantStock [2]int
+	}{
+		{"reserves every item", []ReservationItem{{1, 3}, {2, 5}}, false, nil, nil, [2]int{7, 0}},
+		{"repeated IDs are summed", []ReservationItem{{1, 3}, {1, 4}}, false, nil, nil, [2]int{3, 5}},
+		{"short product reserves nothing", []ReservationItem{{1, 3}, {2, 6}}, true, nil, []int32{2}, [2]int{10, 5}},
+		{"summed quantity is short", []ReservationItem{{2, 3}, {2, 3}}, true, nil, []int32{2}, [2]int{10, 5}},
+		{"missing product reserves nothing", []ReservationItem{{1, 3}, {9, 1}}, true, []int32{9}, nil, [2]int{10, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStore()
+			s.put(Product{ID: 1, Name: "A", Stock: 10})
+			s.put(Product{ID: 2, Name: "B", Stock: 5})
+			r, err := s.Reserve(tt.items)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Reserve err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				var failed *ReservationError
+				if !errors.As(err, &failed) || !errors.Is(err, ErrPartialReservation) {
+					t.Fatalf("err = %v, want a *ReservationError", err)
+				}
+				if fmt.Sprint(failed.Missing) != fmt.Sprint(tt.wantMissing) || fmt.Sprint(failed.Insufficient) != fmt.Sprint(tt.wantInsufficient) {
+					t.Errorf("failed = %+v, want missing %v insufficient %v", failed, tt.wantMissing, tt.wantInsufficient)
+				}
+			} else if r.ID == "" || r.ExpiresAt.IsZero() {
+				t.Errorf("reservation = %+v", r)
+			}
+			for i, want := range tt.wantStock {
+				if p, _ := s.Get(int32(i + 1)); p.Stock != want {
+					t.Errorf("product %d stock = %d, want %d", i+1, p.Stock, want)
+				}
+			}
+		})
+	}
+}
+
+func TestStoreReleaseReservation(t *testing.T) {
+	s := NewStore()
+	s.put(Product{ID: 1, Name: "A", Stock: 10})
+	r, err := s.Reserve([]ReservationItem{{1, 4}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.ReleaseReservation(r.ID); !ok {
+		t.Fatal("ReleaseReservation failed")
+	}
+	if _, ok := s.ReleaseReservation(r.ID); ok {
+		t.Error("a reservation was released twice")
+	}
+	if p, _ := s.Get(1); p.Stock != 10 {
+		t.Errorf("stock after release = %d, want 10", p.Stock)
+	}
+
+	// Expired reservations are released once, by expireReservations
+	r, _ = s.Reserve([]ReservationItem{{1, 4}})
+	if n := s.expireReservations(r.ExpiresAt.Add(-time.Second)); n != 0 {
+		t.Errorf("expired %d reservations before their TTL", n)
+	}
+	if n := s.expireReservations(r.ExpiresAt.Add(time.Second)); n != 1 {
+		t.Errorf("expired %d reservations, want 1", n)
+	}
+	if _, ok := s.ReleaseReservation(r.ID); ok {
+		t.Error("an expired reservation was released")
+	}
+	if p, _ := s.Get(1); p.Stock != 10 {
+		t.Errorf("stock after expiry = %d, want 10", p.Stock)
+	}
+}
+
+func TestStoreLowStockAlerts(t *testing.T) {
+	s := NewStore()
+	s.put(Product{ID: 1, Name: "Desk", Price: 50, Stock: 20, LowStockThreshold: 10})
+	alerts := s.StockAlerts().Events()
+
+	tests := []struct {
+		name      string
+		by        int
+		wantAlert bool
+	}{
+		{"staying above the threshold", 5, false},
+		{"reaching the threshold", 5, true},
+		{"already below the threshold", 4, false},
+	}
+	for _, tt := range tests {
+		if err := s.DecrementStock(1, tt.by); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case e := <-alerts:
+			if !tt.wantAlert {
+				t.Errorf("%s: got alert %+v", tt.name, e)
+			} else if e.ProductID != 1 || e.CurrentStock != 10 || e.Threshold != 10 {
+				t.Errorf("%s: alert = %+v, want product 1 at 10 of 10", tt.name, e)
+			}
+		default:
+			if tt.wantAlert {
+				t.Errorf("%s: no alert", tt.name)
+			}
+		}
+	}
+	if got := productIDs(s.LowStock()); got != "[1]" {
+		t.Errorf("LowStock() = %s, want [1]", got)
+	}
+}
+
+// fakeSNS fails the first failures Publish calls and records the messages
+// of the rest.
+type fakeSNS struct {
+	mu        sync.Mutex
+	failures  int
+	calls     int
+	published []string
+}
+
+func (f *fakeSNS) Publish(in *sns.PublishInput) (*sns.PublishOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.calls <= f.failures {
+		return nil, errors.New("sns unavailable")
+	}
+	f.published = append(f.published, aws.StringValue(in.Message))
+	return &sns.PublishOutput{}, nil
+}
+
+func TestLowStockPublisherRetriesSpooledAlerts(t *testing.T) {
+	client := &fakeSNS{failures: 2}
+	spool := filepath.Join(t.TempDir(), "low-stock.jsonl")
+	bus := NewStockAlertBus()
+	NewLowStockPublisher(client, "arn:aws:sns:us-west-2:123456789012:low-stock", spool).Run(bus, 10*time.Millisecond)
+	bus.Publish(LowStockEvent{ProductID: 7, CurrentStock: 3, Threshold: 10})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		client.mu.Lock()
+		published := client.published
+		client.mu.Unlock()
+		if len(published) > 0 {
+			var e LowStockEvent
+			if err := json.Unmarshal([]byte(published[0]), &e); err != nil || e.ProductID != 7 || len(published) != 1 {
+				t.Fatalf("published %q, want product 7 once", published)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("spooled alert was never published")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// The spool is removed once it has been drained
+	for {
+		if _, err := os.Stat(spool); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("spool was not removed after delivery")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestShardedStoreMatchesStore(t *testing.T) {
+	s := newSeededStore(300)
+	sharded := NewShardedStore(4)
+	sharded.SeedBulk(300)
+	min := 50.0
+
+	tests := []struct {
+		name      string
+		nameQ     string
+		category  string
+		filter    ProductFilter
+		maxCheck  int
+		maxReturn int
+	}{
+		{"no filters", "", "", ProductFilter{}, 100, 20},
+		{"name", "zeta", "", ProductFilter{}, 300, 20},
+		{"category", "", "garden", ProductFilter{}, 150, 5},
+		{"brand and price", "", "", ProductFilter{Brand: "beta", MinPrice: &min}, 300, 50},
+		{"maxCheck inside one shard's prefix", "", "", ProductFilter{}, 3, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, wantTotal := s.SearchLimitedWhere(tt.nameQ, tt.category, tt.filter, nil, tt.maxCheck, tt.maxReturn)
+			got, total := sharded.SearchLimitedWhere(tt.nameQ, tt.category, tt.filter, nil, tt.maxCheck, tt.maxReturn)
+			if productIDs(got) != productIDs(want) || total != wantTotal {
+				t.Errorf("sharded %s (%d), store %s (%d)", productIDs(got), total, productIDs(want), wantTotal)
+			}
+			if len(sharded.List(tt.nameQ, tt.category, tt.filter)) != len(s.List(tt.nameQ, tt.category, tt.filter)) {
+				t.Error("List results differ")
+			}
+		})
+	}
+}
+
+func TestShardedStoreSingleProduct(t *testing.T) {
+	s := NewShardedStore(4)
+	s.SeedBulk(10)
+
+	created := s.Create(Product{Name: "Desk", Price: 10})
+	if created.ID != 11 {
+		t.Fatalf("created ID = %d, want 11", created.ID)
+	}
+	if got := s.shard(11); got != s.shards[3] {
+		t.Error("product 11 is not on shard 11 % 4")
+	}
+
+	tests := []struct {
+		name   string
+		id     int32
+		wantOK bool
+	}{
+		{"seeded", 5, true},
+		{"created", 11, true},
+		{"missing", 12, false},
+		{"negative", -3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if p, ok := s.Get(tt.id); ok != tt.wantOK || (ok && p.ID != tt.id) {
+				t.Fatalf("Get(%d) = %d, %v, want ok %v", tt.id, p.ID, ok, tt.wantOK)
+			}
+			if _, ok := s.UpdateDetails(tt.id, Product{Price: 42}); ok != tt.wantOK {
+				t.Errorf("UpdateDetails(%d) ok = %v, want %v", tt.id, ok, tt.wantOK)
+			}
+			if ok := s.Delete(tt.id); ok != tt.wantOK {
+				t.Errorf("Delete(%d) = %v, want %v", tt.id, ok, tt.wantOK)
+			}
+			if _, ok := s.Get(tt.id); ok {
+				t.Errorf("product %d still found after Delete", tt.id)
+			}
+		})
+	}
+	if got := len(s.List("", "", ProductFilter{})); got != 9 {
+		t.Errorf("List returned %d products, want 9", got)
+	}
+}
+
+func TestStoreSearchAnalytics(t *testing.T) {
+	s := newSeededStore(10)
+	s.SearchLimited("alpha", "", 10, 10)
+	s.SearchLimited("alpha", "", 10, 10)
+	s.SearchPage("beta", "", 0, 10)
+	top := s.TopSearches(1)
+	if len(top) != 1 || top[0].Count != 2 {
+		t.Fatalf("TopSearches(1) = %+v, want the alpha search twice", top)
+	}
+	if s.Analytics() == nil {
+		t.Error("Analytics() = nil")
+	}
+	s.ResetAnalytics()
+	if top := s.TopSearches(10); len(top) != 0 {
+		t.Errorf("TopSearches after reset = %+v", top)
+	}
+}
+
+func TestStoreSearchAnalyticsConcurrent(t *testing.T) {
+	s := newSeededStore(100)
+	const workers, searches = 8, 250
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < searches; i++ {
+				if i%2 == 0 {
+					s.SearchLimited(" Alpha ", "", 100, 10)
+				} else {
+					s.SearchLimited("beta", "BOOKS", 100, 10)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	top := s.TopSearches(10)
+	if len(top) != 2 {
+		t.Fatalf("TopSearches = %+v, want 2 queries", top)
+	}
+	for _, e := range top {
+		if e.Count != workers*searches/2 {
+			t.Errorf("%q/%q counted %d times, want %d", e.Name, e.Category, e.Count, workers*searches/2)
+		}
+	}
+	if top[0].Name != "alpha" || top[1].Category != "books" {
+		t.Errorf("queries were not normalized: %+v", top)
+	}
+}
+
+func TestSearchAnalyticsWindow(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	a := NewSearchAnalytics()
+	a.now = func() time.Time { return now }
+
+	a.Record("old", "")
+	now = now.Add(2 * time.Hour)
+	a.Record("old", "")
+	a.Record("new", "")
+	a.Record("", "") // unfiltered searches are not recorded
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		want    string
+	}{
+		{"both hours in the window", 0, "[old:2 new:1]"},
+		{"first hour leaves the window", 23 * time.Hour, "[new:1 old:1]"},
+		{"evicted after 24 hours unseen", 2 * time.Hour, "[]"},
+	}
+	for _, tt := range tests {
+		now = now.Add(tt.advance)
+		var got []string
+		for _, e := range a.Top(10) {
+			got = append(got, fmt.Sprintf("%s:%d", e.Name, e.Count))
+		}
+		if fmt.Sprintf("%v", got) != tt.want {
+			t.Errorf("%s: Top = %v, want %s", tt.name, got, tt.want)
+		}
+	}
+	if a.size.Load() != 0 {
+		t.Errorf("%d queries still tracked after eviction", a.size.Load())
+	}
+}
+
+func TestSearchAnalyticsBoundsTrackedQueries(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	a := NewSearchAnalytics()
+	a.maxQueries = 100
+	a.now = func() time.Time { return now }
+	for i := 0; i < 1000; i++ {
+		now = now.Add(time.Second)
+		a.Record(fmt.Sprintf("query %d", i), "")
+	}
+	if n := a.size.Load(); n > a.maxQueries {
+		t.Fatalf("%d queries tracked, want at most %d", n, a.maxQueries)
+	}
+	// The least recently seen queries are evicted first
+	found := false
+	for _, e := range a.Top(-1) {
+		found = found || e.Name == "query 999"
+	}
+	if !found {
+		t.Error("the latest query was evicted")
+	}
+}
+
+func TestExperimentSplit(t *testing.T) {
+	m := NewABTestManager()
+	tests := []struct {
+		name  string
+		split float64
+	}{
+		{"even", 0.5},
+		{"mostly A", 0.1},
+		{"all A", 0},
+		{"all B", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := m.Add(tt.name, nil, nil, tt.split)
+			if err != nil {
+				t.Fatal(err)
+			}
+			const customers = 10000
+			b := 0
+			for id := 1; id <= customers; id++ {
+				variant := e.Variant(id)
+				if variant == VariantB {
+					b++
+				}
+				if e.Variant(id) != variant {
+					t.Fatalf("customer %d changed variant", id)
+				}
+			}
+			if got := float64(b) / customers; math.Abs(got-tt.split) > 0.02 {
+				t.Errorf("%.3f of customers in B, want %.2f ± 0.02", got, tt.split)
+			}
+		})
+	}
+	for _, split := range []float64{-0.1, 1.1} {
+		if _, err := m.Add("bad", nil, nil, split); err == nil {
+			t.Errorf("Add accepted traffic split %v", split)
+		}
+	}
+}
+
+func TestExperimentResults(t *testing.T) {
+	s := newSeededStore(70)
+	m := NewABTestManager()
+	e, _ := m.Add(DefaultExperiment, s.SameCategory(), s.SameBrand(), 0.5)
+
+	// Find one customer in each arm
+	customers := map[string]int{}
+	for id := 1; len(customers) < 2; id++ {
+		if _, ok := customers[e.Variant(id)]; !ok {
+			customers[e.Variant(id)] = id
+		}
+	}
+	for _, variant := range []string{VariantA, VariantB} {
+		products := e.Recommend(context.Background(), 1, customers[variant])
+		if len(products) != RecommendationLimit {
+			t.Fatalf("variant %s recommended %d products", variant, len(products))
+		}
+		source, _ := s.Get(1)
+		for _, p := range products {
+			if p.ID == 1 || (variant == VariantA && p.Category != source.Category) || (variant == VariantB && p.Brand != source.Brand) {
+				t.Errorf("variant %s recommended %+v for %+v", variant, p, source)
+			}
+		}
+	}
+	e.Recommend(context.Background(), 2, customers[VariantA])
+	e.RecordClick(customers[VariantA])
+
+	res := e.Results(10)
+	want := map[string][2]int64{VariantA: {2, 1}, VariantB: {1, 0}}
+	for _, v := range res.Variants {
+		if w := want[v.Variant]; v.Impressions != w[0] || v.Clicks != w[1] || v.CTR != float64(w[1])/float64(w[0]) {
+			t.Errorf("variant %s = %+v, want %d impressions and %d clicks", v.Variant, v, w[0], w[1])
+		}
+	}
+	if len(res.Recent) != 3 || res.Recent[2].ProductID != 2 {
+		t.Errorf("recent impressions = %+v, want 3 ending with product 2", res.Recent)
+	}
+}
+
+func TestTwoProportionZTest(t *testing.T) {
+	tests := []struct {
+		name           string
+		x1, n1, x2, n2 int64
+		wantZ, wantP   float64
+	}{
+		// 20% vs 25% of 1000 each: z = 0.05 / sqrt(0.225 * 0.775 * 0.002)
+		{"treatment converts better", 200, 1000, 250, 1000, 2.6774, 0.0074},
+		{"treatment converts worse", 250, 1000, 200, 1000, -2.6774, 0.0074},
+		{"not significant", 30, 100, 20, 100, -1.6330, 0.1025},
+		{"equal rates", 50, 100, 50, 100, 0, 1},
+		{"no variation", 0, 100, 0, 100, 0, 1},
+		{"no data", 0, 0, 5, 10, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z, p := TwoProportionZTest(tt.x1, tt.n1, tt.x2, tt.n2)
+			if math.Abs(z-tt.wantZ) > 1e-4 || math.Abs(p-tt.wantP) > 1e-4 {
+				t.Errorf("z, p = %.4f, %.4f, want %.4f, %.4f", z, p, tt.wantZ, tt.wantP)
+			}
+		})
+	}
+}
+
+// customerInVariant returns the first customer ID e assigns to variant.
+func customerInVariant(e PriceExperiment, variant string) int {
+	for id := 1; ; id++ {
+		if e.Variant(id) == variant {
+			return id
+		}
+	}
+}
+
+func TestStoreGetPriceForExperiment(t *testing.T) {
+	s := NewStore()
+	s.put(Product{ID: 1, Name: "Desk", Price: 100})
+	s.put(Product{ID: 2, Name: "Lamp", Price: 20})
+	e := PriceExperiment{
+		ID: "desk-price", ProductIDs: []int32{1},
+		ControlMultiplier: 1, TreatmentMultiplier: 1.1, TrafficSplit: 0.5,
+		StartAt: time.Now().Add(-time.Hour), EndAt: time.Now().Add(time.Hour),
+	}
+	if err := s.PriceExperiments().Add(e); err != nil {
+		t.Fatal(err)
+	}
+	control, treatment := customerInVariant(e, VariantControl), customerInVariant(e, VariantTreatment)
+
+	tests := []struct {
+		name     string
+		product  int32
+		customer int
+		want     float64
+	}{
+		{"control", 1, control, 100},
+		{"treatment", 1, treatment, 110},
+		{"not in the experiment", 2, treatment, 20},
+		{"unknown product", 9, treatment, 0},
+	}
+	for _, tt := range tests {
+		if got := s.GetPriceForExperiment(tt.product, tt.customer); got != tt.want {
+			t.Errorf("%s: price = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Customers count once however often they see the price or buy
+	s.GetPriceForExperiment(1, control)
+	s.PriceExperiments().RecordPurchase("desk-price", treatment)
+	s.PriceExperiments().RecordPurchase("desk-price", treatment)
+	res, err := s.PriceExperiments().Results("desk-price")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Control.Customers != 1 || res.Control.Conversions != 0 || res.Treatment.Customers != 1 || res.Treatment.Conversions != 1 {
+		t.Errorf("control %+v, treatment %+v, want 1 customer each and 1 treatment conversion", res.Control, res.Treatment)
+	}
+	if _, err := s.PriceExperiments().RecordPurchase("nope", control); !errors.Is(err, ErrPriceExperimentNotFound) {
+		t.Errorf("RecordPurchase on an unknown experiment: err = %v", err)
+	}
+}
+
+func TestPriceExperimentsAdd(t *testing.T) {
+	now := time.Now()
+	valid := PriceExperiment{ID: "a", ProductIDs: []int32{1, 2}, ControlMultiplier: 1, TreatmentMultiplier: 1.1, TrafficSplit: 0.5, StartAt: now, EndAt: now.Add(time.Hour)}
+	with := func(change func(e *PriceExperiment)) PriceExperiment {
+		e := valid
+		e.ID = "b"
+		change(&e)
+		return e
+	}
+	tests := []struct {
+		name    string
+		e       PriceExperiment
+		wantErr error
+	}{
+		{"other products", with(func(e *PriceExperiment) { e.ProductIDs = []int32{3} }), nil},
+		{"same products later", with(func(e *PriceExperiment) { e.StartAt, e.EndAt = now.Add(time.Hour), now.Add(2*time.Hour) }), nil},
+		{"replacing itself", with(func(e *PriceExperiment) { e.ID = "a" }), nil},
+		{"overlapping product", with(func(e *PriceExperiment) { e.ProductIDs = []int32{2, 3} }), ErrPriceExperimentOverlap},
+		{"ends before it starts", with(func(e *PriceExperiment) { e.EndAt = now.Add(-time.Hour) }), ErrInvalidPriceExperiment},
+		{"multiplier too large", with(func(e *PriceExperiment) { e.TreatmentMultiplier = 11 }), ErrInvalidPriceExperiment},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewPriceExperiments()
+			if err := m.Add(valid); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.Add(tt.e); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Add: err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	desk := featureVector(Product{Price: 50, Category: "Home", Brand: "Alpha"})
+	tests := []struct {
+		name string
+		a, b [featureDims]float32
+		want float64
+	}{
+		{"identical features", desk, featureVector(Product{Name: "Other desk", Price: 50, Category: "Home", Brand: "Alpha"}), 1},
+		{"same vector", [featureDims]float32{1, 2, 3}, [featureDims]float32{1, 2, 3}, 1},
+		{"scaled vector", [featureDims]float32{1, 2, 3}, [featureDims]float32{2, 4, 6}, 1},
+		{"orthogonal", [featureDims]float32{1, 0, 0}, [featureDims]float32{0, 1, 0}, 0},
+		{"orthogonal one-hots", [featureDims]float32{featureCategorySlot: 1}, [featureDims]float32{featureBrandSlot: 1}, 0},
+		{"zero vector", [featureDims]float32{}, desk, 0},
+		{"half", [featureDims]float32{1, 1}, [featureDims]float32{1, 0}, 1 / math.Sqrt2},
+	}
+	for _, tt := range tests {
+		if got := CosineSimilarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-6 {
+			t.Errorf("%s: CosineSimilarity = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStoreSimilarProducts(t *testing.T) {
+	s := NewStore()
+	s.put(Product{ID: 1, Name: "Desk", Price: 50, Category: "Home", Brand: "Alpha"})
+	s.put(Product{ID: 2, Name: "Desk twin", Price: 50, Category: "Home", Brand: "Alpha"})
+	s.put(Product{ID: 3, Name: "Pricier desk", Price: 150, Category: "Home", Brand: "Alpha"})
+	s.put(Product{ID: 4, Name: "Phone", Price: 50, Category: "Electronics", Brand: "Omega"})
+
+	got, err := s.SimilarProducts(1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := productIDs(got); ids != "[2 3 4]" {
+		t.Errorf("SimilarProducts(1) = %s, want [2 3 4]", ids)
+	}
+	if got, _ := s.SimilarProducts(1, 1); productIDs(got) != "[2]" {
+		t.Errorf("SimilarProducts(1, 1) = %s, want [2]", productIDs(got))
+	}
+	if _, err := s.SimilarProducts(9, 10); !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("SimilarProducts(9) err = %v, want ErrProductNotFound", err)
+	}
+
+	// Changing a product's features invalidates cached neighbours
+	s.UpdateDetails(4, Product{Category: "Home", Brand: "Alpha"})
+	if got, _ := s.SimilarProducts(1, 2); productIDs(got) != "[2 4]" {
+		t.Errorf("SimilarProducts(1, 2) after update = %s, want [2 4]", productIDs(got))
+	}
+}
+
+// fakeElasticsearch answers the Elasticsearch endpoints the store uses.
+// The index does not exist until created, each _search returns hits and
+// status is returned instead while non-zero.
+type fakeElasticsearch struct {
+	*httptest.Server
+	mu          sync.Mutex
+	created     bool
+	bulkSizes   []int
+	lastQuery   map[string]any
+	hits        []map[string]any
+	status      int
+	searchCalls int
+}
+
+func newFakeElasticsearch(t *testing.T) *fakeElasticsearch {
+	es := &fakeElasticsearch{}
+	es.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		es.mu.Lock()
+		defer es.mu.Unlock()
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/products/_mapping" && !es.created:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPut && r.URL.Path == "/products":
+			es.created = true
+		case r.URL.Path == "/_bulk":
+			es.bulkSizes = append(es.bulkSizes, bytes.Count(body, []byte("\n"))/2)
+			w.Write([]byte(`{"errors":false}`))
+		case r.URL.Path == "/products/_search":
+			es.searchCalls++
+			if es.status != 0 {
+				w.WriteHeader(es.status)
+				return
+			}
+			json.Unmarshal(body, &es.lastQuery)
+			json.NewEncoder(w).Encode(map[string]any{"hits": map[string]any{
+				"total": map[string]any{"value": len(es.hits)},
+				"hits":  es.hits,
+			}})
+		}
+	}))
+	t.Cleanup(es.Close)
+	return es
+}
+
+func TestElasticsearchIndexAll(t *testing.T) {
+	es := newFakeElasticsearch(t)
+	e := NewElasticsearchStore(newSeededStore(2500), es.URL, "products")
+	indexed, err := e.IndexAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if indexed != 2500 || fmt.Sprint(es.bulkSizes) != "[1000 1000 500]" {
+		t.Errorf("indexed %d in bulk requests of %v, want 2500 in [1000 1000 500]", indexed, es.bulkSizes)
+	}
+	if !es.created {
+		t.Error("missing index was not created")
+	}
+}
+
+func TestElasticsearchSearch(t *testing.T) {
+	es := newFakeElasticsearch(t)
+	s := NewStore()
+	s.put(Product{ID: 1, Name: "Laptop", Price: 900, Brand: "Alpha", Category: "Electronics"})
+	s.put(Product{ID: 2, Name: "Laptop bag", Price: 40, Brand: "Alpha", Category: "Electronics"})
+	es.hits = []map[string]any{
+		{"_id": "2", "_score": 7.5},
+		{"_id": "1", "_score": 2.0},
+		// Deleted since it was indexed
+		{"_id": "3", "_score": 1.0},
+	}
+	e := NewElasticsearchStore(s, es.URL, "products")
+
+	maxPrice := 100.0
+	got, total, err := e.Search(context.Background(), SearchOptions{
+		Query:    "labtop",
+		Category: "Electronics",
+		Filter:   ProductFilter{Brand: "alp", MaxPrice: &maxPrice},
+		Limit:    10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Product 1 is over the price bound in the store, whatever the index says
+	if productIDs(got) != "[2]" || total != 3 {
+		t.Fatalf("Search = %s, total %d, want [2], total 3", productIDs(got), total)
+	}
+	if got[0].Relevance != 7.5 {
+		t.Errorf("Relevance = %v, want the hit score 7.5", got[0].Relevance)
+	}
+
+	query, _ := json.Marshal(es.lastQuery)
+	for _, want := range []string{
+		`"multi_match":{"fields":["name^3","description","brand","category"],"fuzziness":"AUTO","query":"labtop"}`,
+		`{"term":{"category.keyword":"Electronics"}}`,
+		`"value":"*alp*"`,
+		`{"range":{"price":{"lte":100}}}`,
+		`"size":10`,
+	} {
+		if !strings.Contains(string(query), want) {
+			t.Errorf("query %s does not contain %s", query, want)
+		}
+	}
+}
+
+func TestElasticsearchCircuitBreaker(t *testing.T) {
+	es := newFakeElasticsearch(t)
+	es.status = http.StatusServiceUnavailable
+	e := NewElasticsearchStore(newSeededStore(5), es.URL, "products")
+
+	for i := 0; i < esFailureThreshold; i++ {
+		if _, _, err := e.Search(context.Background(), SearchOptions{Query: "product"}); err == nil || errors.Is(err, ErrSearchUnavailable) {
+			t.Fatalf("search %d: err = %v, want the Elasticsearch error", i+1, err)
+		}
+	}
+	if _, _, err := e.Search(context.Background(), SearchOptions{Query: "product"}); !errors.Is(err, ErrSearchUnavailable) {
+		t.Errorf("err = %v once the breaker opened, want ErrSearchUnavailable", err)
+	}
+	if es.searchCalls != esFailureThreshold {
+		t.Errorf("Elasticsearch was called %d times, want %d", es.searchCalls, esFailureThreshold)
+	}
+
+	// Once the breaker closes again, searches go through
+	e.openUntil = time.Now()
+	es.status = 0
+	if _, _, err := e.Search(context.Background(), SearchOptions{Query: "product"}); err != nil {
+		t.Errorf("err = %v after the breaker closed", err)
+	}
+}
+
+func TestStoreCacheStats(t *testing.T) {
+	s := newSeededStore(20)
+	if got := s.CacheStats(); got != (CacheStats{}) || s.CacheHitRate() != 0 {
+		t.Fatalf("stats before any lookups = %+v, hit rate %v, want zeros", got, s.CacheHitRate())
+	}
+
+	steps := []struct {
+		name string
+		do   func()
+		want CacheStats
+	}{
+		{"first lookup misses", func() { s.SimilarProducts(1, 5) }, CacheStats{Misses: 1, CacheSize: 1}},
+		{"second lookup hits", func() { s.SimilarProducts(1, 5) }, CacheStats{Hits: 1, Misses: 1, HitRate: 0.5, CacheSize: 1}},
+		{"each call counts", func() {
+			s.SimilarProducts(1, 3)
+			s.SimilarProducts(2, 3)
+		}, CacheStats{Hits: 2, Misses: 2, HitRate: 0.5, CacheSize: 2}},
+		{"unknown products are not lookups", func() { s.SimilarProducts(99, 3) }, CacheStats{Hits: 2, Misses: 2, HitRate: 0.5, CacheSize: 2}},
+		{"feature changes evict the cache", func() { s.UpdateDetails(3, Product{Brand: "Acme"}) }, CacheStats{Hits: 2, Misses: 2, Evictions: 2, HitRate: 0.5}},
+		{"lookups after eviction miss", func() { s.SimilarProducts(1, 5) }, CacheStats{Hits: 2, Misses: 3, Evictions: 2, HitRate: 0.4, CacheSize: 1}},
+	}
+	for _, step := range steps {
+		step.do()
+		if got := s.CacheStats(); got != step.want {
+			t.Errorf("%s: stats = %+v, want %+v", step.name, got, step.want)
+		}
+	}
+}
+
+func TestStoreConcurrentAccess(t *testing.T) {
+	s := newSeededStore(200)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				switch i % 5 {
+				case 0:
+					s.Create(Product{Name: fmt.Sprintf("Worker %d %d", w, i), Price: 1})
+				case 1:
+					s.UpdateDetails(int32(i+1), Product{Price: float64(i + 1)})
+				case 2:
+					s.SearchLimited("product", "", 100, 10)
+				case 3:
+					s.List("", "books", ProductFilter{})
+				case 4:
+					s.Get(int32(i))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if got := len(s.List("", "", ProductFilter{})); got != 200+8*20 {
+		t.Errorf("store holds %d products, want %d", got, 200+8*20)
+	}
+}
+
+// productIDs formats the IDs of products like fmt.Sprint([]int32).
+func productIDs(products []Product) string {
+	ids := make([]int32, 0, len(products))
+	for _, p := range products {
+		ids = append(ids, p.ID)
+	}
+	return fmt.Sprint(ids)
+}
+
+// changedIDs formats the product IDs of a change feed like fmt.Sprint([]int32).
+func changedIDs(changed []ChangedProduct) string {
+	ids := make([]int32, 0, len(changed))
+	for _, c := range changed {
+		ids = append(ids, c.ID)
+	}
+	return fmt.Sprint(ids)
+}
@@ -1,5 +1,13 @@
 package product
 
+import (
+	"errors"
+	"math"
+	"strings"
+	"text/main/pkg/currency"
+	"time"
+)
+
 // Product represents a product entity.
 type Product struct {
 	ID          int32   `json:"id"`
@@ -8,11 +16,237 @@ type Product struct {
 	Description string  `json:"description,omitempty"`
 	Brand       string  `json:"brand,omitempty"`
 	Price       float64 `json:"price,omitempty"`
+	Stock       int     `json:"stock"`
+	// LowStockThreshold is the stock level at or below which the product is
+	// reported as low stock.
+	LowStockThreshold int `json:"low_stock_threshold"`
+	// Slug is the URL-friendly name assigned at creation, e.g.
+	// "product-alpha-12345". It does not change when the product is renamed.
+	Slug string `json:"slug,omitempty"`
+	// ImageURL points at the product's CDN image; seeded products get
+	// seedImageURL.
+	ImageURL string `json:"image_url,omitempty"`
+	// UpdatedAt is when the product was created or its details last
+	// changed; stock movements do not count. See Store.GetChangedSince.
+	UpdatedAt time.Time `json:"updated_at"`
+	// IsPreOrder products may be sold before they are in stock; their stock
+	// can go negative (back-ordered) and they ship on PreOrderShipDate.
+	IsPreOrder       bool       `json:"is_pre_order,omitempty"`
+	PreOrderShipDate *time.Time `json:"pre_order_ship_date,omitempty"`
+	// PricingTiers are volume discounts, sorted by ascending MinQuantity.
+	PricingTiers []PricingTier `json:"pricing_tiers,omitempty"`
+	// Metadata holds free-form attributes such as an EAN or hazmat class.
+	// It is replaced, never modified in place; see Store.SetMetadata.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Relevance is the search score; it is only set on Elasticsearch results.
+	Relevance float64 `json:"relevance,omitempty"`
+	// FeatureVector is derived from price, category, brand and pre-order
+	// status for SimilarProducts; see featureVector.
+	FeatureVector [featureDims]float32 `json:"-"`
 }
 
-// ErrorResponse is a basic error payload.
-type ErrorResponse struct {
-	Message string `json:"message"`
+// PricingTier discounts the unit price by DiscountPercent (a fraction in
+// [0, 0.9]) when at least MinQuantity units are bought.
+type PricingTier struct {
+	MinQuantity     int     `json:"min_quantity"`
+	DiscountPercent float64 `json:"discount_percent"`
+}
+
+// MaxTierDiscount is the largest discount a pricing tier may apply.
+const MaxTierDiscount = 0.9
+
+// ErrInvalidPricingTiers is returned when tiers are unsorted or out of range.
+var ErrInvalidPricingTiers = errors.New("pricing tiers must have min_quantity >= 1 in strictly ascending order and discount_percent between 0 and 0.9")
+
+// canDecrement reports whether qty units can be taken from stock. Pre-order
+// products are back-ordered instead of running out.
+func (p Product) canDecrement(qty int) bool {
+	return p.IsPreOrder || p.Stock >= qty
+}
+
+// ValidatePricingTiers checks ordering and discount bounds.
+func ValidatePricingTiers(tiers []PricingTier) error {
+	for i, t := range tiers {
+		if t.MinQuantity < 1 || t.DiscountPercent < 0 || t.DiscountPercent > MaxTierDiscount {
+			return ErrInvalidPricingTiers
+		}
+		if i > 0 && t.MinQuantity <= tiers[i-1].MinQuantity {
+			return ErrInvalidPricingTiers
+		}
+	}
+	return nil
+}
+
+// PriceForQuantity returns the per-unit price for qty units, applying the
+// largest tier whose MinQuantity is met, rounded to the nearest cent.
+func (p Product) PriceForQuantity(qty int) float64 {
+	discount := 0.0
+	for _, t := range p.PricingTiers {
+		if qty < t.MinQuantity {
+			break
+		}
+		discount = t.DiscountPercent
+	}
+	return math.Round(p.Price*(1-discount)*100) / 100
+}
+
+// ConvertedPrice returns the price (stored in USD) in the given currency
+// using the process-wide converter. Unknown codes yield currency.ErrUnsupportedCurrency.
+func (p Product) ConvertedPrice(code string) (float64, error) {
+	return currency.Default().Convert(p.Price, code)
+}
+
+// CreateProductRequest is the body accepted by POST /products.
+type CreateProductRequest struct {
+	Name        string  `json:"name" binding:"productname"`
+	Category    string  `json:"category"`
+	Description string  `json:"description"`
+	Brand       string  `json:"brand"`
+	Price       float64 `json:"price" binding:"price"`
+	Stock       int     `json:"stock" binding:"gte=0"`
+	// LowStockThreshold defaults to DefaultLowStockThreshold.
+	LowStockThreshold *int       `json:"low_stock_threshold" binding:"omitempty,gte=0"`
+	IsPreOrder        bool       `json:"is_pre_order"`
+	PreOrderShipDate  *time.Time `json:"pre_order_ship_date"`
+}
+
+// StockResponse is returned by GET /products/{productId}/stock. Stock is
+// negative for back-ordered pre-order products.
+type StockResponse struct {
+	ProductID  int32 `json:"product_id"`
+	Stock      int   `json:"stock"`
+	IsPreOrder bool  `json:"is_pre_order"`
+}
+
+// MaxBulkCreate bounds the number of products in a POST /products/bulk body.
+const MaxBulkCreate = 500
+
+// BulkCreateResult is the outcome for one item of POST /products/bulk.
+// Status is 201 with the created Product, or 422 with the validation Error.
+type BulkCreateResult struct {
+	Index   int         `json:"index"`
+	Status  int         `json:"status"`
+	Product interface{} `json:"product,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// BulkCreateResponse is returned by POST /products/bulk, with one result
+// per submitted product in request order.
+type BulkCreateResponse struct {
+	Created int                `json:"created"`
+	Failed  int                `json:"failed"`
+	Results []BulkCreateResult `json:"results"`
+}
+
+// ProductDetailsRequest is the body accepted by POST /products/{productId}/details.
+// Every field is optional; empty fields leave the stored value unchanged.
+type ProductDetailsRequest struct {
+	Name        string  `json:"name" binding:"omitempty,productname"`
+	Category    string  `json:"category"`
+	Description string  `json:"description"`
+	Brand       string  `json:"brand"`
+	Price       float64 `json:"price" binding:"price"`
+}
+
+// Product converts the request into a Product.
+func (r CreateProductRequest) Product() Product {
+	threshold := DefaultLowStockThreshold
+	if r.LowStockThreshold != nil {
+		threshold = *r.LowStockThreshold
+	}
+	return Product{Name: r.Name, Category: r.Category, Description: r.Description, Brand: r.Brand, Price: r.Price, Stock: r.Stock,
+		LowStockThreshold: threshold, IsPreOrder: r.IsPreOrder, PreOrderShipDate: r.PreOrderShipDate}
+}
+
+// Product converts the request into a partial Product for UpdateDetails.
+func (r ProductDetailsRequest) Product() Product {
+	return Product{Name: r.Name, Category: r.Category, Description: r.Description, Brand: r.Brand, Price: r.Price}
+}
+
+// ProductV1 is the v1 view of a product. It predates the brand field, so
+// v1 clients never see it.
+type ProductV1 struct {
+	ID          int32   `json:"id"`
+	Name        string  `json:"name"`
+	Category    string  `json:"category,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Price       float64 `json:"price,omitempty"`
+}
+
+// V1 converts a product to its v1 view.
+func (p Product) V1() ProductV1 {
+	return ProductV1{
+		ID:          p.ID,
+		Name:        p.Name,
+		Category:    p.Category,
+		Description: p.Description,
+		Price:       p.Price,
+	}
+}
+
+// ProductQuery selects products for bulk operations. Non-empty fields must
+// match exactly (case-insensitive); an empty query matches every product.
+type ProductQuery struct {
+	Category string
+	Brand    string
+}
+
+// IsEmpty reports whether the query has no filters.
+func (q ProductQuery) IsEmpty() bool {
+	return q.Category == "" && q.Brand == ""
+}
+
+// Matches reports whether p satisfies the query.
+func (q ProductQuery) Matches(p Product) bool {
+	if q.Category != "" && !strings.EqualFold(p.Category, q.Category) {
+		return false
+	}
+	if q.Brand != "" && !strings.EqualFold(p.Brand, q.Brand) {
+		return false
+	}
+	return true
+}
+
+// ProductFilter holds the GET /products filters applied after the name and
+// category match. Nil bounds are not applied.
+type ProductFilter struct {
+	// Brand is matched as a case-insensitive substring, like name and category.
+	Brand    string   `json:"brand,omitempty"`
+	MinPrice *float64 `json:"min_price,omitempty"`
+	MaxPrice *float64 `json:"max_price,omitempty"`
+}
+
+// IsEmpty reports whether the filter has no conditions.
+func (f ProductFilter) IsEmpty() bool {
+	return f.Brand == "" && f.MinPrice == nil && f.MaxPrice == nil
+}
+
+// Matches reports whether p satisfies the filter. Price bounds are inclusive.
+func (f ProductFilter) Matches(p Product) bool {
+	if f.Brand != "" && !strings.Contains(strings.ToLower(p.Brand), strings.ToLower(f.Brand)) {
+		return false
+	}
+	if f.MinPrice != nil && p.Price < *f.MinPrice {
+		return false
+	}
+	if f.MaxPrice != nil && p.Price > *f.MaxPrice {
+		return false
+	}
+	return true
+}
+
+// BulkPriceUpdateRequest is the body accepted by PATCH /products/price.
+type BulkPriceUpdateRequest struct {
+	Category   string  `json:"category"`
+	Brand      string  `json:"brand"`
+	Multiplier float64 `json:"multiplier" binding:"required"`
+	DryRun     bool    `json:"dry_run"`
+}
+
+// BulkPriceUpdateResponse reports how many products were (or would be) repriced.
+type BulkPriceUpdateResponse struct {
+	Updated int  `json:"updated"`
+	DryRun  bool `json:"dry_run"`
 }
 
 // SearchResponse is the response envelope for limited searches.
@@ -20,4 +254,106 @@ type SearchResponse struct {
 	Products   []Product `json:"products"`
 	TotalFound int       `json:"total_found"`
 	SearchTime string    `json:"search_time,omitempty"`
+	// NextCursor is the after_id of the next page of a paged search; it is
+	// omitted on the last page.
+	NextCursor int32 `json:"next_cursor,omitempty"`
+	// Filter echoes the filters applied, if any.
+	Filter *ProductFilter `json:"filter,omitempty"`
+}
+
+// SearchResponseV1 is the v1 envelope for limited searches.
+type SearchResponseV1 struct {
+	Products   []ProductV1    `json:"products"`
+	TotalFound int            `json:"total_found"`
+	SearchTime string         `json:"search_time,omitempty"`
+	NextCursor int32          `json:"next_cursor,omitempty"`
+	Filter     *ProductFilter `json:"filter,omitempty"`
+}
+
+// Bundle is a kit sold as a unit. Quantities maps each component ID to how
+// many units the bundle contains (1 when omitted on creation).
+type Bundle struct {
+	ID           int32         `json:"id"`
+	Name         string        `json:"name"`
+	ComponentIDs []int32       `json:"component_ids"`
+	Quantities   map[int32]int `json:"quantities"`
+	BundlePrice  float64       `json:"bundle_price"`
+}
+
+// BundleResponse is a bundle together with the current price of its
+// components bought separately.
+type BundleResponse struct {
+	Bundle
+	ComponentTotal float64 `json:"component_total"`
+	Savings        float64 `json:"savings"`
+}
+
+// PricingTiersRequest is the body accepted by POST /products/{productId}/pricing-tiers.
+type PricingTiersRequest struct {
+	Tiers []PricingTier `json:"tiers"`
+}
+
+// PricingTiersResponse lists a product's pricing tiers.
+type PricingTiersResponse struct {
+	ProductID int32         `json:"product_id"`
+	Tiers     []PricingTier `json:"tiers"`
+}
+
+// MaxBatchProducts is the most IDs POST /products/batch accepts.
+const MaxBatchProducts = 100
+
+// BatchGetRequest is the body accepted by POST /products/batch.
+type BatchGetRequest struct {
+	IDs []int32 `json:"ids" binding:"required,min=1,max=100,unique,dive,gte=1"`
+}
+
+// BatchGetResponse lists the found products in request order; IDs with no
+// product are listed in missing_ids, also in request order.
+type BatchGetResponse struct {
+	Products   []Product `json:"products"`
+	MissingIDs []int32   `json:"missing_ids"`
+}
+
+// MetadataRequest is the body accepted by PUT /products/{productId}/metadata/{key}.
+type MetadataRequest struct {
+	Value *string `json:"value" binding:"required"`
+}
+
+// MetadataEntry is one metadata key/value pair of a product.
+type MetadataEntry struct {
+	ProductID int32  `json:"product_id"`
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+}
+
+// RowError reports why a single import row was skipped.
+type RowError struct {
+	Row     int    `json:"row"`
+	Message string `json:"message"`
+}
+
+// ImportSummary is the response for catalog imports.
+type ImportSummary struct {
+	Imported int        `json:"imported"`
+	Skipped  int        `json:"skipped"`
+	Errors   []RowError `json:"errors"`
+}
+
+// ImportProgress is one line of the NDJSON import response. A line is
+// streamed every 1000 input lines; the last one has Done set and lists the
+// rejected lines.
+type ImportProgress struct {
+	Processed int        `json:"processed"`
+	Imported  int        `json:"imported"`
+	Errors    int        `json:"errors"`
+	Done      bool       `json:"done,omitempty"`
+	RowErrors []RowError `json:"row_errors,omitempty"`
+	// Error is set when the upload could not be read to the end.
+	Error string `json:"error,omitempty"`
 }
+
+// CSVRecords implements response.Collection.
+func (r SearchResponse) CSVRecords() interface{} { return r.Products }
+
+// CSVRecords implements response.Collection.
+func (r SearchResponseV1) CSVRecords() interface{} { return r.Products }
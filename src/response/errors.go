@@ -0,0 +1,65 @@
+package response
+
+import "github.com/gin-gonic/gin"
+
+// RequestIDKey is the gin context key holding the request ID (see middleware.RequestID).
+const RequestIDKey = "request_id"
+
+// Error codes let clients branch on the failure without parsing messages.
+const (
+	ErrCodeInvalidJSON           = "INVALID_JSON"
+	ErrCodeInvalidRequest        = "INVALID_REQUEST"
+	ErrCodeInvalidProductID      = "INVALID_PRODUCT_ID"
+	ErrCodeProductNotFound       = "PRODUCT_NOT_FOUND"
+	ErrCodeProductInUse          = "PRODUCT_IN_USE"
+	ErrCodeBundleNotFound        = "BUNDLE_NOT_FOUND"
+	ErrCodeInvalidBundle         = "INVALID_BUNDLE"
+	ErrCodeInvalidPricingTiers   = "INVALID_PRICING_TIERS"
+	ErrCodeInvalidMultiplier     = "INVALID_MULTIPLIER"
+	ErrCodeExperimentNotFound    = "EXPERIMENT_NOT_FOUND"
+	ErrCodeInvalidExperiment     = "INVALID_EXPERIMENT"
+	ErrCodeExperimentConflict    = "EXPERIMENT_CONFLICT"
+	ErrCodeInsufficientStock     = "INSUFFICIENT_STOCK"
+	ErrCodeReservationNotFound   = "RESERVATION_NOT_FOUND"
+	ErrCodeInvalidMetadata       = "INVALID_METADATA"
+	ErrCodeMetadataNotFound      = "METADATA_NOT_FOUND"
+	ErrCodeRebuildInProgress     = "REBUILD_IN_PROGRESS"
+	ErrCodeSyncTokenExpired      = "SYNC_TOKEN_EXPIRED"
+	ErrCodeFileTooLarge          = "FILE_TOO_LARGE"
+	ErrCodeRequestTooLarge       = "REQUEST_TOO_LARGE"
+	ErrCodeNotAcceptable         = "NOT_ACCEPTABLE"
+	ErrCodeEmptyOrder            = "EMPTY_ORDER"
+	ErrCodeOrderNotFound         = "ORDER_NOT_FOUND"
+	ErrCodeOrderNotCancellable   = "ORDER_NOT_CANCELLABLE"
+	ErrCodeOrderCancelled        = "ORDER_CANCELLED"
+	ErrCodeOrderExists           = "ORDER_EXISTS"
+	ErrCodePaymentFailed         = "PAYMENT_FAILED"
+	ErrCodeInvalidIdempotencyKey = "INVALID_IDEMPOTENCY_KEY"
+	ErrCodeIdempotencyKeyReused  = "IDEMPOTENCY_KEY_REUSED"
+	ErrCodeIdempotencyKeyInUse   = "IDEMPOTENCY_KEY_IN_USE"
+	ErrCodeMessagingUnavailable  = "MESSAGING_UNAVAILABLE"
+	ErrCodeWebhookNotFound       = "WEBHOOK_NOT_FOUND"
+	ErrCodeUnauthorized          = "UNAUTHORIZED"
+	ErrCodeForbidden             = "FORBIDDEN"
+	ErrCodeRateLimited           = "RATE_LIMITED"
+	ErrCodeOverloaded            = "OVERLOADED"
+	ErrCodeInternal              = "INTERNAL_ERROR"
+)
+
+// APIError is the error payload returned by every endpoint.
+type APIError struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// WriteError aborts the request with an APIError carrying the request's ID.
+func WriteError(c *gin.Context, status int, code string, message string, details interface{}) {
+	c.AbortWithStatusJSON(status, APIError{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: c.GetString(RequestIDKey),
+	})
+}
@@ -0,0 +1,49 @@
+package response
+
+import (
+	"bytes"
+	"net/http"
+	"text/main/csvenc"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+)
+
+// FormatKey is the gin context key holding the negotiated response format
+// (see middleware.ContentNegotiation).
+const FormatKey = "response_format"
+
+// Supported response formats.
+const (
+	FormatJSON    = "application/json"
+	FormatMsgPack = "application/msgpack"
+	FormatCSV     = "text/csv"
+)
+
+// Collection is implemented by response envelopes that can be flattened to
+// CSV. CSVRecords must return a slice of structs.
+type Collection interface {
+	CSVRecords() interface{}
+}
+
+// Write encodes data in the negotiated format, defaulting to JSON.
+// CSV is only available for slices and Collection envelopes.
+func Write(c *gin.Context, status int, data interface{}) {
+	switch c.GetString(FormatKey) {
+	case FormatMsgPack:
+		c.Render(status, render.MsgPack{Data: data})
+	case FormatCSV:
+		records := data
+		if coll, ok := data.(Collection); ok {
+			records = coll.CSVRecords()
+		}
+		var buf bytes.Buffer
+		if err := csvenc.Encode(&buf, records); err != nil {
+			WriteError(c, http.StatusNotAcceptable, ErrCodeNotAcceptable, "text/csv is only available for collections", nil)
+			return
+		}
+		c.Data(status, FormatCSV+"; charset=utf-8", buf.Bytes())
+	default:
+		c.JSON(status, data)
+	}
+}
@@ -0,0 +1,134 @@
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// MaxNameLength is the longest product name accepted by the productname rule.
+const MaxNameLength = 100
+
+// FieldError describes a single failed validation rule.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Response is the 422 body returned when struct-tag validation fails.
+type Response struct {
+	Errors []FieldError `json:"errors"`
+}
+
+// Custom rules available in `binding` tags alongside the built-in ones
+// (use the built-in `uuid` rule for UUID formatted fields):
+//
+//	price        finite, non-negative number
+//	productname  non-blank, at most MaxNameLength characters
+func init() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	// Report fields by their JSON names so clients can map errors back to the payload
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return f.Name
+		}
+		return name
+	})
+	v.RegisterValidation("price", func(fl validator.FieldLevel) bool {
+		p := fl.Field().Float()
+		return p >= 0 && !math.IsInf(p, 0) && !math.IsNaN(p)
+	})
+	v.RegisterValidation("productname", func(fl validator.FieldLevel) bool {
+		name := fl.Field().String()
+		return strings.TrimSpace(name) != "" && utf8.RuneCountInString(name) <= MaxNameLength
+	})
+}
+
+// Middleware renders validation failures recorded by Reject as a structured
+// 422 response once the handler returns.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if c.Writer.Written() {
+			return
+		}
+		for _, e := range c.Errors.ByType(gin.ErrorTypeBind) {
+			var verrs validator.ValidationErrors
+			if errors.As(e.Err, &verrs) {
+				c.JSON(http.StatusUnprocessableEntity, Response{Errors: fieldErrors(verrs)})
+				return
+			}
+		}
+	}
+}
+
+// Reject records err for Middleware and aborts the request when it is a
+// struct-tag validation failure. It returns false for any other error (e.g.
+// malformed JSON) so the handler can respond itself.
+func Reject(c *gin.Context, err error) bool {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return false
+	}
+	c.Error(err).SetType(gin.ErrorTypeBind)
+	c.Abort()
+	return true
+}
+
+// Errors returns the field errors in err, or nil when err is not a
+// struct-tag validation failure.
+func Errors(err error) []FieldError {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return nil
+	}
+	return fieldErrors(verrs)
+}
+
+func fieldErrors(verrs validator.ValidationErrors) []FieldError {
+	out := make([]FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		out = append(out, FieldError{Field: fe.Field(), Message: message(fe)})
+	}
+	return out
+}
+
+func message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "max":
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", fe.Param())
+	case "gte":
+		return fmt.Sprintf("must be greater than or equal to %s", fe.Param())
+	case "price":
+		return "must be a non-negative number"
+	case "productname":
+		return fmt.Sprintf("must be between 1 and %d characters", MaxNameLength)
+	case "uuid":
+		return "must be a valid UUID"
+	case "unique":
+		return "must not contain duplicates"
+	default:
+		return fmt.Sprintf("failed the %q rule", fe.Tag())
+	}
+}
@@ -49,6 +49,8 @@ module "ecs" {
   sqs_queue_url      = module.messaging.sqs_queue_url
   # Pass worker count for scaling payment processors
   worker_count       = var.worker_count
+  # Gateway whose X-Customer-ID identifies customers to the order routes
+  trusted_proxies    = var.trusted_proxies
 }
 
 
@@ -39,6 +39,10 @@ resource "aws_ecs_task_definition" "this" {
       {
         name  = "WORKER_COUNT"
         value = tostring(var.worker_count)
+      },
+      {
+        name  = "TRUSTED_PROXIES"
+        value = var.trusted_proxies
       }
     ]
 
@@ -79,4 +79,10 @@ variable "worker_count" {
   type        = number
   default     = 1
   description = "Number of concurrent payment processing workers (goroutines)"
-}
\ No newline at end of file
+}
+
+variable "trusted_proxies" {
+  type        = string
+  default     = ""
+  description = "CIDRs whose X-Customer-ID and X-Forwarded-For headers are trusted"
+}
@@ -37,4 +37,11 @@ variable "worker_count" {
   type        = number
   default     = 1
   description = "Number of concurrent payment processing workers (goroutines). Increase to scale throughput."
-}
\ No newline at end of file
+}
+
+# Gateway that sets X-Customer-ID/X-Customer-Tier in front of the service
+variable "trusted_proxies" {
+  type        = string
+  default     = ""
+  description = "Comma-separated CIDRs of the gateway that sets X-Customer-ID. Without it customers cannot list or cancel their own orders; only ADMIN_API_KEY callers can."
+}
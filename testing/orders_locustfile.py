@@ -48,3 +48,38 @@ class OrdersUser(FastHttpUser):
         # POST to synchronous endpoint (expect ~3 second response)
         self.client.post("/orders/sync", json=order_data, name="POST /orders/sync")
 
+
+    @task
+    def create_catalog_order_sync(self):
+        """
+        Create orders for seeded catalog products (numeric IDs 1-100000),
+        which take stock from the catalog when accepted. "PROD-###" IDs in
+        create_order_sync hold no stock, so only this task exercises the
+        stock path. Products that run out answer 409 INSUFFICIENT_STOCK,
+        which is expected under sustained load.
+        """
+        self.order_counter += 1
+
+        order_data = {
+            "order_id": f"ORD-{self.order_counter}",
+            "customer_id": random.randint(1000, 9999),
+            "status": "pending",
+            "items": [
+                {
+                    "product_id": str(random.randint(1, 100000)),
+                    "quantity": random.randint(1, 5),
+                    "price": round(random.uniform(10.0, 200.0), 2)
+                }
+            ]
+        }
+
+        with self.client.post(
+            "/orders/sync",
+            json=order_data,
+            catch_response=True,
+            name="POST /orders/sync (catalog stock)"
+        ) as response:
+            if response.status_code in (200, 409):
+                response.success()
+            else:
+                response.failure(f"Expected 200 or 409, got {response.status_code}")